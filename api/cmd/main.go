@@ -1,69 +1,171 @@
+// Command main runs the storm API and the consumer that saves transformed
+// reports. The migrate subcommand manages the database schema instead.
+//
+//	go run cmd/main.go
+//	go run cmd/main.go migrate up|down|status|baseline
 package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"weather-api/internal/migrate"
 	"weather-api/internal/weather"
+	"weather-contract/telemetry"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/zap"
 )
 
 func main() {
-	logger, _ := zap.NewProduction()
-	defer logger.Sync()
 	err := godotenv.Load()
 	if err != nil {
-		logger.Error(err.Error())
+		fmt.Println(err)
 		os.Exit(1)
 	}
-
-	// Create a new Gin router
-	router := gin.Default()
-	dbRepo, err := weather.NewMysqlRepository(os.Getenv("DATABASE_URL"))
+	logger, err := telemetry.NewLogger()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer logger.Sync()
+	store, err := weather.OpenStore(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		logger.Error("Unable to initialize DB connection.",
 			zap.String("error", err.Error()))
 		os.Exit(1)
 	}
-	stormRepo := weather.NewModelsRepo(dbRepo)
-	process, err := weather.InitProcess(stormRepo)
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" {
+			fmt.Print(migrate.Usage)
+			os.Exit(2)
+		}
+		err := migrate.Command(store.DB, store.Driver, os.Args[2:], os.Stdout)
+		store.DB.Close()
+		if errors.Is(err, migrate.ErrUsage) {
+			fmt.Print(migrate.Usage)
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	serverConfig, err := weather.ParseServerEnv()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	healthConfig, err := telemetry.ParseHealthEnv()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	tracingConfig, err := telemetry.ParseTracingEnv()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	shutdownTracing, err := telemetry.InitTracing(tracingConfig, "weather-api")
+	if err != nil {
+		logger.Error("Unable to initialize tracing.", zap.Error(err))
+		os.Exit(1)
+	}
+	if serverConfig.RequireCurrentSchema {
+		migrator, err := migrate.New(store.DB, store.Driver)
+		if err == nil {
+			err = migrator.CheckCurrent()
+		}
+		if err != nil {
+			logger.Error("Refusing to start with an outdated schema.",
+				zap.String("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+
+	// Create a new Gin router
+	router := gin.Default()
+	router.Use(otelgin.Middleware("weather-api"))
+	router.Use(weather.HttpMetrics())
+	weather.RegisterMetrics(router)
+	prometheus.MustRegister(collectors.NewDBStatsCollector(store.DB, store.Driver))
+	stormRepo := weather.NewModelsRepo(store)
+	process, err := weather.InitProcess(stormRepo, logger)
 	if err != nil {
 		logger.Error("Unable to initialize Kafka connection.",
 			zap.String("error", err.Error()))
 		os.Exit(1)
 	}
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	go process.Start(ctx)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	consumerCtx, stopConsumer := context.WithCancel(context.Background())
+	defer stopConsumer()
+	consumerDone := make(chan error, 1)
+	go func() {
+		consumerDone <- process.Start(consumerCtx)
+	}()
 
-	// Define a simple GET route
-	router.GET("/storm", func(c *gin.Context) {
-		dateStr := c.Query("date")
+	weather.NewHandler(&stormRepo, logger).RegisterRoutes(router)
+	weather.NewHealthChecker(process, store, healthConfig).RegisterRoutes(router)
+	server := &http.Server{
+		Addr:    serverConfig.Addr,
+		Handler: router,
+	}
+	serverDone := make(chan error, 1)
+	go func() {
+		serverDone <- server.ListenAndServe()
+	}()
 
-		location := c.Query("location")
-		_, err := time.Parse("2006-01-02", dateStr)
-		if dateStr == "" || err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": "date format must be specified and be in the format YYYY-MM-DD",
-			},
-			)
-			return
+	select {
+	case err := <-serverDone:
+		if !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server stopped.", zap.String("error", err.Error()))
 		}
+	case err := <-consumerDone:
+		logger.Error("Kafka consumer stopped.", zap.Error(err))
+		consumerDone <- err
+	case <-ctx.Done():
+		logger.Info("Received shutdown signal.")
+	}
+	// A second signal kills the process immediately.
+	stop()
 
-		response, err := stormRepo.GetStorms(location, dateStr)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"Failure": err,
-			})
-			return
-		}
-		c.JSON(http.StatusOK, response)
-	})
-	// Start the server on port 8080
-	router.Run(":8080")
+	// Stop accepting requests and let active ones finish.
+	httpCtx, cancelHttp := context.WithTimeout(context.Background(), serverConfig.HttpShutdownTimeout)
+	defer cancelHttp()
+	if err := server.Shutdown(httpCtx); err != nil {
+		logger.Error("Unable to shut down HTTP server.", zap.String("error", err.Error()))
+	}
+
+	// Stop the consumer once its current message has been written.
+	stopConsumer()
+	select {
+	case <-consumerDone:
+	case <-time.After(serverConfig.ConsumerShutdownTimeout):
+		logger.Error("Timed out waiting for the Kafka consumer to stop.")
+	}
+
+	if err := store.Close(serverConfig.DbCloseTimeout); err != nil {
+		logger.Error("Unable to close DB connection.", zap.String("error", err.Error()))
+	}
+
+	// Export the spans of the last batch and requests.
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		logger.Error("Unable to flush traces.", zap.Error(err))
+	}
+	logger.Info("Service stopped.")
 }
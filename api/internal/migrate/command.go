@@ -0,0 +1,101 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const Usage = `usage: api migrate <command> [flags]
+
+commands:
+  up        apply pending migrations, all of them or up to -to VERSION
+  down      revert the latest migration, or the latest -steps of them
+  status    list migrations and when each was applied
+  baseline  record migrations up to VERSION as applied without running them
+`
+
+// ErrUsage is returned for an unknown command or missing arguments.
+var ErrUsage = errors.New(Usage)
+
+// Command runs the migrate subcommand given by args on a database of driver
+// and reports to out.
+func Command(db *sql.DB, driver string, args []string, out io.Writer) error {
+	if len(args) < 1 {
+		return ErrUsage
+	}
+	migrator, err := New(db, driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		flags := flag.NewFlagSet("up", flag.ContinueOnError)
+		target := flags.Int("to", 0, "apply migrations up to and including this version")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		applied, err := migrator.Up(*target)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %s\n", migration)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(out, "no pending migrations")
+		}
+	case "down":
+		flags := flag.NewFlagSet("down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to revert")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(*steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "reverted %s\n", migration)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(out, "no applied migrations")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, "MIGRATION\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(writer, "%s\t%s\n", status.Migration, appliedAt)
+		}
+		return writer.Flush()
+	case "baseline":
+		if len(args) != 2 {
+			return ErrUsage
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return ErrUsage
+		}
+		if err := migrator.Baseline(version); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "recorded migrations up to %s as applied\n", migrator.Migrations[version-1])
+	default:
+		return ErrUsage
+	}
+	return nil
+}
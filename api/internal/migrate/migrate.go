@@ -0,0 +1,344 @@
+// Package migrate creates and evolves the storms schema from SQL migrations
+// embedded in the api binary.
+package migrate
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// embedded holds a directory of migrations for each database driver.
+//
+//go:embed migrations/*/*.sql
+var embedded embed.FS
+
+// versionTable records every migration applied to the database.
+const versionTable = "schema_migrations"
+
+// migrationName matches files such as 0001_create_storm_tables.up.sql.
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one step of the schema, with the SQL that applies and reverts
+// it. Statements are separated by a semicolon at the end of a line.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Load reads the migrations in dir of fsys, ordered by version. Each version
+// must have both an up and a down file and versions must count up from 1.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, errors.New("Migration " + entry.Name() + " must be named VERSION_NAME.up.sql or VERSION_NAME.down.sql.")
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("Migration %d has two names, %s and %s.", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("Migration %d is missing.", i+1)
+		}
+		if strings.TrimSpace(migration.Up) == "" || strings.TrimSpace(migration.Down) == "" {
+			return nil, fmt.Errorf("Migration %s needs both an up and a down file.", migration)
+		}
+	}
+	return migrations, nil
+}
+
+// statements splits a migration into the statements to execute one at a
+// time, dropping comment lines.
+func statements(script string) []string {
+	var result []string
+	var current []string
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statement := strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";")
+			result = append(result, statement)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		result = append(result, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return result
+}
+
+// Migrator applies migrations to a database and tracks them in versionTable.
+type Migrator struct {
+	DB *sql.DB
+	// Driver is the database/sql driver name, postgres needs numbered
+	// placeholders.
+	Driver     string
+	Migrations []Migration
+}
+
+// New returns a migrator for the migrations of driver embedded in the binary.
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	if _, err := fs.Stat(embedded, "migrations/"+driver); err != nil {
+		return nil, errors.New("There are no migrations for database driver " + driver + ".")
+	}
+	migrations, err := Load(embedded, "migrations/"+driver)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: db, Driver: driver, Migrations: migrations}, nil
+}
+
+// exec runs a statement with ? placeholders.
+func (m *Migrator) exec(query string, args ...interface{}) error {
+	if m.Driver == "postgres" {
+		for i := 1; strings.Contains(query, "?"); i++ {
+			query = strings.Replace(query, "?", "$"+strconv.Itoa(i), 1)
+		}
+	}
+	_, err := m.DB.Exec(query, args...)
+	return err
+}
+
+// Latest is the version the api expects the schema to be at.
+func (m *Migrator) Latest() int {
+	return len(m.Migrations)
+}
+
+func (m *Migrator) ensureVersionTable() error {
+	_, err := m.DB.Exec("CREATE TABLE IF NOT EXISTS " + versionTable + ` (
+    version INT NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMP NOT NULL
+)`)
+	return err
+}
+
+// applied returns when each recorded version was applied.
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureVersionTable(); err != nil {
+		return nil, err
+	}
+	rows, err := m.DB.Query("SELECT version, applied_at FROM " + versionTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt interface{}
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		// PostgreSQL returns a time, MySQL and SQLite may return text.
+		switch v := appliedAt.(type) {
+		case time.Time:
+			applied[version] = v.UTC()
+		case []byte:
+			appliedAt = string(v)
+		}
+		if text, ok := appliedAt.(string); ok {
+			parsed, err := time.Parse("2006-01-02 15:04:05", text)
+			if err != nil {
+				return nil, err
+			}
+			applied[version] = parsed
+		}
+	}
+	return applied, rows.Err()
+}
+
+// Version returns the highest applied version, 0 for an empty database.
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version, nil
+}
+
+// Status is whether a migration has been applied and when.
+type Status struct {
+	Migration Migration
+	AppliedAt *time.Time
+}
+
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		statuses[i].Migration = migration
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// run executes the statements of script one at a time. MySQL commits DDL
+// implicitly, so a failure leaves the earlier statements applied.
+func (m *Migrator) run(migration Migration, script string) error {
+	for _, statement := range statements(script) {
+		if _, err := m.DB.Exec(statement); err != nil {
+			return fmt.Errorf("Migration %s failed: %w", migration, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) record(migration Migration) error {
+	return m.exec("INSERT INTO "+versionTable+" (version, name, applied_at) VALUES (?, ?, ?)",
+		migration.Version, migration.Name, time.Now().UTC().Format("2006-01-02 15:04:05"))
+}
+
+// Up applies the pending migrations up to and including target, or all of
+// them when target is 0, and returns the ones it applied.
+func (m *Migrator) Up(target int) ([]Migration, error) {
+	if target == 0 {
+		target = m.Latest()
+	}
+	if target < 0 || target > m.Latest() {
+		return nil, fmt.Errorf("Version must be from 1 to %d.", m.Latest())
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range m.Migrations[:target] {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if err := m.run(migration, migration.Up); err != nil {
+			return done, err
+		}
+		err := m.record(migration)
+		if err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the latest steps applied migrations and returns the ones it
+// reverted.
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	if steps < 1 {
+		return nil, errors.New("Steps must be at least 1.")
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if err := m.run(migration, migration.Down); err != nil {
+			return done, err
+		}
+		if err := m.exec("DELETE FROM "+versionTable+" WHERE version = ?", migration.Version); err != nil {
+			return done, err
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Baseline records migrations up to version as applied without running
+// them, for databases that were created by hand before migrations existed.
+func (m *Migrator) Baseline(version int) error {
+	if version < 1 || version > m.Latest() {
+		return fmt.Errorf("Version must be from 1 to %d.", m.Latest())
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return err
+	}
+	if len(applied) > 0 {
+		return errors.New("Migrations have already been recorded, baseline is only for untracked databases.")
+	}
+	for _, migration := range m.Migrations[:version] {
+		err := m.record(migration)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckCurrent returns an error when migrations are pending.
+func (m *Migrator) CheckCurrent() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, status.Migration.String())
+		}
+	}
+	if len(pending) > 0 {
+		return errors.New("Database schema is behind, pending migrations: " + strings.Join(pending, ", ") + ". Run migrate up.")
+	}
+	return nil
+}
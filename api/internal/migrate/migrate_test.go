@@ -0,0 +1,145 @@
+package migrate
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+type loadCase struct {
+	files         fstest.MapFS
+	expectedError string
+}
+
+func TestLoad(t *testing.T) {
+	for _, driver := range []string{"mysql", "postgres", "sqlite"} {
+		migrator, err := New(nil, driver)
+		assert.Nil(t, err, driver)
+		assert.Equal(t, "0001_create_storm_tables", migrator.Migrations[0].String(), driver)
+	}
+	_, err := New(nil, "oracle")
+	assert.EqualError(t, err, "There are no migrations for database driver oracle.")
+
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	testCases := []loadCase{
+		{
+			files:         fstest.MapFS{"m/0001_a.up.sql": sql, "m/0001_a.down.sql": sql, "m/0003_c.up.sql": sql, "m/0003_c.down.sql": sql},
+			expectedError: "Migration 2 is missing.",
+		},
+		{
+			files:         fstest.MapFS{"m/0001_a.up.sql": sql},
+			expectedError: "Migration 0001_a needs both an up and a down file.",
+		},
+		{
+			files:         fstest.MapFS{"m/0001_a.up.sql": sql, "m/0001_b.down.sql": sql},
+			expectedError: "Migration 1 has two names, a and b.",
+		},
+		{
+			files:         fstest.MapFS{"m/create.sql": sql},
+			expectedError: "Migration create.sql must be named VERSION_NAME.up.sql or VERSION_NAME.down.sql.",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := Load(tc.files, "m")
+		assert.EqualError(t, err, tc.expectedError)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := "-- Two tables.\nCREATE TABLE a (\n    id INT\n);\n\nALTER TABLE b ADD COLUMN c INT,\n    ADD COLUMN d INT;\n"
+	assert.Equal(t, []string{
+		"CREATE TABLE a (\n    id INT\n)",
+		"ALTER TABLE b ADD COLUMN c INT,\n    ADD COLUMN d INT",
+	}, statements(script))
+}
+
+func testMigrator(t *testing.T) (*Migrator, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+	return &Migrator{DB: db, Driver: "mysql", Migrations: []Migration{
+		{Version: 1, Name: "create", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "add_b", Up: "ALTER TABLE a ADD COLUMN b INT;", Down: "ALTER TABLE a DROP COLUMN b;"},
+	}}, mock
+}
+
+func expectApplied(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "applied_at"})
+	for _, version := range versions {
+		rows.AddRow(version, "2024-05-06 20:10:00")
+	}
+	mock.ExpectQuery("SELECT version, applied_at FROM schema_migrations").WillReturnRows(rows)
+}
+
+func TestUp(t *testing.T) {
+	migrator, mock := testMigrator(t)
+	expectApplied(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a ADD COLUMN b INT")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(2, "add_b", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	applied, err := migrator.Up(0)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{migrator.Migrations[1]}, applied)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	_, err = migrator.Up(3)
+	assert.EqualError(t, err, "Version must be from 1 to 2.")
+}
+
+func TestDown(t *testing.T) {
+	migrator, mock := testMigrator(t)
+	expectApplied(mock, 1, 2)
+	mock.ExpectExec(regexp.QuoteMeta("ALTER TABLE a DROP COLUMN b")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM schema_migrations WHERE version = ?").
+		WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	reverted, err := migrator.Down(1)
+	assert.Nil(t, err)
+	assert.Equal(t, []Migration{migrator.Migrations[1]}, reverted)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckCurrent(t *testing.T) {
+	migrator, mock := testMigrator(t)
+	expectApplied(mock, 1)
+	assert.EqualError(t, migrator.CheckCurrent(), "Database schema is behind, pending migrations: 0002_add_b. Run migrate up.")
+
+	expectApplied(mock, 1, 2)
+	assert.Nil(t, migrator.CheckCurrent())
+
+	expectApplied(mock, 1)
+	version, err := migrator.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, version)
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSqliteMigrations(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	assert.Nil(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	migrator, err := New(db, "sqlite")
+	assert.Nil(t, err)
+
+	applied, err := migrator.Up(0)
+	assert.Nil(t, err)
+	assert.Len(t, applied, migrator.Latest())
+	assert.Nil(t, migrator.CheckCurrent())
+	_, err = db.Exec("INSERT INTO hail_events (event_id, event_time, convective_day) VALUES ('a', '2024-05-06 20:10:00', '2024-05-06')")
+	assert.Nil(t, err)
+
+	reverted, err := migrator.Down(migrator.Latest())
+	assert.Nil(t, err)
+	assert.Len(t, reverted, migrator.Latest())
+	version, err := migrator.Version()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+}
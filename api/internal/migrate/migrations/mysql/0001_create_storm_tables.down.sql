@@ -0,0 +1,3 @@
+DROP TABLE tornado_events;
+DROP TABLE wind_events;
+DROP TABLE hail_events;
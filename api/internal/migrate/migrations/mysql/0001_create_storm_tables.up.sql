@@ -0,0 +1,33 @@
+-- The tables as they were first created by hand, see database_schema/.
+CREATE TABLE hail_events (
+    event_time DATETIME NOT NULL,
+    size INT,
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE,
+    lon DOUBLE,
+    comments VARCHAR(240)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE wind_events (
+    event_time TIMESTAMP NOT NULL,
+    speed VARCHAR(10),
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE,
+    lon DOUBLE,
+    comments VARCHAR(240)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE tornado_events (
+    event_time DATETIME NOT NULL,
+    f_scale VARCHAR(10),
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE,
+    lon DOUBLE,
+    comments VARCHAR(240)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
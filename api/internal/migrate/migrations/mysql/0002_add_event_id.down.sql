@@ -0,0 +1,3 @@
+ALTER TABLE tornado_events DROP INDEX uq_tornado_events_event_id, DROP COLUMN event_id;
+ALTER TABLE wind_events DROP INDEX uq_wind_events_event_id, DROP COLUMN event_id;
+ALTER TABLE hail_events DROP INDEX uq_hail_events_event_id, DROP COLUMN event_id;
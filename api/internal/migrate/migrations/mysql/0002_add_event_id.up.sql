@@ -0,0 +1,37 @@
+-- The etl derives event IDs from the report and the api upserts on them.
+-- Existing rows get the ID the etl derives from type|event time|lat|lon|
+-- location|magnitude, so a re-sent report updates its row, and copies of the
+-- same report collapse into the first one saved. legacy_row only orders the
+-- copies. event_time holds UTC; wind_events stores it as a TIMESTAMP.
+-- Rows saved before the etl knew about convective days put a report stamped
+-- 0000-1159 on the date it was listed under instead of the next one, so
+-- their event_time is moved a day forward first, to the time the etl now
+-- derives the ID from. Going down leaves the corrected times.
+ALTER TABLE hail_events ADD COLUMN event_id CHAR(32) NULL FIRST,
+    ADD COLUMN legacy_row BIGINT NOT NULL AUTO_INCREMENT UNIQUE;
+UPDATE hail_events SET event_time = event_time + INTERVAL 1 DAY WHERE HOUR(event_time) < 12;
+UPDATE hail_events SET event_id = LEFT(SHA2(CONCAT_WS('|', 'hail', TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', event_time),
+    CAST(ROUND(COALESCE(lat, 0), 4) AS DECIMAL(10,4)), CAST(ROUND(COALESCE(lon, 0), 4) AS DECIMAL(10,4)),
+    UPPER(TRIM(COALESCE(location, ''))), UPPER(TRIM(COALESCE(size, '')))), 256), 32);
+DELETE dup FROM hail_events dup JOIN hail_events kept ON kept.event_id = dup.event_id AND kept.legacy_row < dup.legacy_row;
+ALTER TABLE hail_events DROP COLUMN legacy_row, MODIFY event_id CHAR(32) NOT NULL FIRST,
+    ADD UNIQUE KEY uq_hail_events_event_id (event_id);
+ALTER TABLE wind_events ADD COLUMN event_id CHAR(32) NULL FIRST,
+    ADD COLUMN legacy_row BIGINT NOT NULL AUTO_INCREMENT UNIQUE;
+UPDATE wind_events SET event_time = FROM_UNIXTIME(UNIX_TIMESTAMP(event_time) + 86400)
+    WHERE HOUR(TIMESTAMPADD(SECOND, UNIX_TIMESTAMP(event_time), '1970-01-01 00:00:00')) < 12;
+UPDATE wind_events SET event_id = LEFT(SHA2(CONCAT_WS('|', 'wind', UNIX_TIMESTAMP(event_time),
+    CAST(ROUND(COALESCE(lat, 0), 4) AS DECIMAL(10,4)), CAST(ROUND(COALESCE(lon, 0), 4) AS DECIMAL(10,4)),
+    UPPER(TRIM(COALESCE(location, ''))), UPPER(TRIM(COALESCE(speed, '')))), 256), 32);
+DELETE dup FROM wind_events dup JOIN wind_events kept ON kept.event_id = dup.event_id AND kept.legacy_row < dup.legacy_row;
+ALTER TABLE wind_events DROP COLUMN legacy_row, MODIFY event_id CHAR(32) NOT NULL FIRST,
+    ADD UNIQUE KEY uq_wind_events_event_id (event_id);
+ALTER TABLE tornado_events ADD COLUMN event_id CHAR(32) NULL FIRST,
+    ADD COLUMN legacy_row BIGINT NOT NULL AUTO_INCREMENT UNIQUE;
+UPDATE tornado_events SET event_time = event_time + INTERVAL 1 DAY WHERE HOUR(event_time) < 12;
+UPDATE tornado_events SET event_id = LEFT(SHA2(CONCAT_WS('|', 'tornado', TIMESTAMPDIFF(SECOND, '1970-01-01 00:00:00', event_time),
+    CAST(ROUND(COALESCE(lat, 0), 4) AS DECIMAL(10,4)), CAST(ROUND(COALESCE(lon, 0), 4) AS DECIMAL(10,4)),
+    UPPER(TRIM(COALESCE(location, ''))), UPPER(TRIM(COALESCE(f_scale, '')))), 256), 32);
+DELETE dup FROM tornado_events dup JOIN tornado_events kept ON kept.event_id = dup.event_id AND kept.legacy_row < dup.legacy_row;
+ALTER TABLE tornado_events DROP COLUMN legacy_row, MODIFY event_id CHAR(32) NOT NULL FIRST,
+    ADD UNIQUE KEY uq_tornado_events_event_id (event_id);
@@ -0,0 +1,3 @@
+ALTER TABLE tornado_events DROP COLUMN convective_day;
+ALTER TABLE wind_events DROP COLUMN convective_day;
+ALTER TABLE hail_events DROP COLUMN convective_day;
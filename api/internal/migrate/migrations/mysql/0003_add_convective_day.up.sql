@@ -0,0 +1,12 @@
+-- Existing rows are placed on the SPC convective day, which runs from 1200
+-- UTC to 1159 UTC the next day. 0002 moved the 0000-1159 reports to the next
+-- day, so this is the date each row was listed under.
+ALTER TABLE hail_events ADD COLUMN convective_day DATE NULL AFTER event_time;
+UPDATE hail_events SET convective_day = DATE(event_time - INTERVAL 12 HOUR);
+ALTER TABLE hail_events MODIFY convective_day DATE NOT NULL;
+ALTER TABLE wind_events ADD COLUMN convective_day DATE NULL AFTER event_time;
+UPDATE wind_events SET convective_day = DATE(TIMESTAMPADD(SECOND, UNIX_TIMESTAMP(event_time), '1970-01-01 00:00:00') - INTERVAL 12 HOUR);
+ALTER TABLE wind_events MODIFY convective_day DATE NOT NULL;
+ALTER TABLE tornado_events ADD COLUMN convective_day DATE NULL AFTER event_time;
+UPDATE tornado_events SET convective_day = DATE(event_time - INTERVAL 12 HOUR);
+ALTER TABLE tornado_events MODIFY convective_day DATE NOT NULL;
@@ -0,0 +1,5 @@
+-- Sizes that aren't numbers, such as UNK, can't go back to INT.
+UPDATE hail_events SET size = NULL WHERE size NOT REGEXP '^[0-9]+$';
+ALTER TABLE tornado_events DROP COLUMN rating_scale, DROP COLUMN rating;
+ALTER TABLE wind_events DROP COLUMN speed_unknown, DROP COLUMN speed_estimated, DROP COLUMN speed_kts, DROP COLUMN speed_mph;
+ALTER TABLE hail_events DROP COLUMN size_mm, DROP COLUMN size_in, MODIFY size INT;
@@ -0,0 +1,7 @@
+-- Raw magnitude text is kept next to the parsed values, NULL when unknown.
+ALTER TABLE hail_events MODIFY size VARCHAR(10), ADD COLUMN size_in DECIMAL(5,2) NULL AFTER size,
+    ADD COLUMN size_mm DECIMAL(6,1) NULL AFTER size_in;
+ALTER TABLE wind_events ADD COLUMN speed_mph DOUBLE NULL AFTER speed, ADD COLUMN speed_kts DOUBLE NULL AFTER speed_mph,
+    ADD COLUMN speed_estimated BOOLEAN NOT NULL DEFAULT FALSE AFTER speed_kts,
+    ADD COLUMN speed_unknown BOOLEAN NOT NULL DEFAULT FALSE AFTER speed_estimated;
+ALTER TABLE tornado_events ADD COLUMN rating TINYINT NULL AFTER f_scale, ADD COLUMN rating_scale VARCHAR(2) NOT NULL DEFAULT '' AFTER rating;
@@ -0,0 +1,3 @@
+ALTER TABLE tornado_events DROP INDEX idx_tornado_events_lat_lon;
+ALTER TABLE wind_events DROP INDEX idx_wind_events_lat_lon;
+ALTER TABLE hail_events DROP INDEX idx_hail_events_lat_lon;
@@ -0,0 +1,4 @@
+-- Spatial queries prefilter on a lat/lon bounding box.
+ALTER TABLE hail_events ADD INDEX idx_hail_events_lat_lon (lat, lon);
+ALTER TABLE wind_events ADD INDEX idx_wind_events_lat_lon (lat, lon);
+ALTER TABLE tornado_events ADD INDEX idx_tornado_events_lat_lon (lat, lon);
@@ -0,0 +1,3 @@
+ALTER TABLE tornado_events DROP INDEX idx_tornado_events_rating_id, DROP INDEX idx_tornado_events_time_id;
+ALTER TABLE wind_events DROP INDEX idx_wind_events_speed_id, DROP INDEX idx_wind_events_time_id;
+ALTER TABLE hail_events DROP INDEX idx_hail_events_size_id, DROP INDEX idx_hail_events_time_id;
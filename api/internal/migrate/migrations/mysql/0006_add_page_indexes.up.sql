@@ -0,0 +1,4 @@
+-- Listings page in (event_time, event_id) order or by magnitude and event_id.
+ALTER TABLE hail_events ADD INDEX idx_hail_events_time_id (event_time, event_id), ADD INDEX idx_hail_events_size_id (size_in, event_id);
+ALTER TABLE wind_events ADD INDEX idx_wind_events_time_id (event_time, event_id), ADD INDEX idx_wind_events_speed_id (speed_mph, event_id);
+ALTER TABLE tornado_events ADD INDEX idx_tornado_events_time_id (event_time, event_id), ADD INDEX idx_tornado_events_rating_id (rating, event_id);
@@ -0,0 +1,6 @@
+ALTER TABLE tornado_events DROP COLUMN ingested_at, DROP COLUMN kafka_offset, DROP COLUMN kafka_partition,
+    DROP COLUMN kafka_topic, DROP COLUMN emitted_at, DROP COLUMN source;
+ALTER TABLE wind_events DROP COLUMN ingested_at, DROP COLUMN kafka_offset, DROP COLUMN kafka_partition,
+    DROP COLUMN kafka_topic, DROP COLUMN emitted_at, DROP COLUMN source;
+ALTER TABLE hail_events DROP COLUMN ingested_at, DROP COLUMN kafka_offset, DROP COLUMN kafka_partition,
+    DROP COLUMN kafka_topic, DROP COLUMN emitted_at, DROP COLUMN source;
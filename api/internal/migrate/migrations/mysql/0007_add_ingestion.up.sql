@@ -0,0 +1,10 @@
+-- How each row was ingested, empty for rows saved before it was recorded.
+ALTER TABLE hail_events ADD COLUMN source VARCHAR(16) NOT NULL DEFAULT '', ADD COLUMN emitted_at DATETIME(3) NULL,
+    ADD COLUMN kafka_topic VARCHAR(255) NOT NULL DEFAULT '', ADD COLUMN kafka_partition INT NULL,
+    ADD COLUMN kafka_offset BIGINT NULL, ADD COLUMN ingested_at DATETIME NULL;
+ALTER TABLE wind_events ADD COLUMN source VARCHAR(16) NOT NULL DEFAULT '', ADD COLUMN emitted_at DATETIME(3) NULL,
+    ADD COLUMN kafka_topic VARCHAR(255) NOT NULL DEFAULT '', ADD COLUMN kafka_partition INT NULL,
+    ADD COLUMN kafka_offset BIGINT NULL, ADD COLUMN ingested_at DATETIME NULL;
+ALTER TABLE tornado_events ADD COLUMN source VARCHAR(16) NOT NULL DEFAULT '', ADD COLUMN emitted_at DATETIME(3) NULL,
+    ADD COLUMN kafka_topic VARCHAR(255) NOT NULL DEFAULT '', ADD COLUMN kafka_partition INT NULL,
+    ADD COLUMN kafka_offset BIGINT NULL, ADD COLUMN ingested_at DATETIME NULL;
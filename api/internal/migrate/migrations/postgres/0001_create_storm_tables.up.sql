@@ -0,0 +1,86 @@
+-- The schema of the MySQL migrations up to 0007 in one step. geog mirrors
+-- lat and lon for the PostGIS radius and polygon queries.
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE hail_events (
+    event_id CHAR(32) NOT NULL PRIMARY KEY,
+    event_time TIMESTAMP NOT NULL,
+    convective_day DATE NOT NULL,
+    size VARCHAR(10),
+    size_in NUMERIC(5,2),
+    size_mm NUMERIC(6,1),
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE PRECISION,
+    lon DOUBLE PRECISION,
+    comments VARCHAR(240),
+    source VARCHAR(16) NOT NULL DEFAULT '',
+    emitted_at TIMESTAMP(3),
+    kafka_topic VARCHAR(255) NOT NULL DEFAULT '',
+    kafka_partition INT,
+    kafka_offset BIGINT,
+    ingested_at TIMESTAMP,
+    geog GEOGRAPHY(Point, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography) STORED
+);
+CREATE INDEX idx_hail_events_time_id ON hail_events (event_time, event_id);
+CREATE INDEX idx_hail_events_size_id ON hail_events (size_in, event_id);
+CREATE INDEX idx_hail_events_lat_lon ON hail_events (lat, lon);
+CREATE INDEX idx_hail_events_geog ON hail_events USING GIST (geog);
+CREATE INDEX idx_hail_events_geom ON hail_events USING GIST ((geog::geometry));
+
+CREATE TABLE wind_events (
+    event_id CHAR(32) NOT NULL PRIMARY KEY,
+    event_time TIMESTAMP NOT NULL,
+    convective_day DATE NOT NULL,
+    speed VARCHAR(10),
+    speed_mph DOUBLE PRECISION,
+    speed_kts DOUBLE PRECISION,
+    speed_estimated BOOLEAN NOT NULL DEFAULT FALSE,
+    speed_unknown BOOLEAN NOT NULL DEFAULT FALSE,
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE PRECISION,
+    lon DOUBLE PRECISION,
+    comments VARCHAR(240),
+    source VARCHAR(16) NOT NULL DEFAULT '',
+    emitted_at TIMESTAMP(3),
+    kafka_topic VARCHAR(255) NOT NULL DEFAULT '',
+    kafka_partition INT,
+    kafka_offset BIGINT,
+    ingested_at TIMESTAMP,
+    geog GEOGRAPHY(Point, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography) STORED
+);
+CREATE INDEX idx_wind_events_time_id ON wind_events (event_time, event_id);
+CREATE INDEX idx_wind_events_speed_id ON wind_events (speed_mph, event_id);
+CREATE INDEX idx_wind_events_lat_lon ON wind_events (lat, lon);
+CREATE INDEX idx_wind_events_geog ON wind_events USING GIST (geog);
+CREATE INDEX idx_wind_events_geom ON wind_events USING GIST ((geog::geometry));
+
+CREATE TABLE tornado_events (
+    event_id CHAR(32) NOT NULL PRIMARY KEY,
+    event_time TIMESTAMP NOT NULL,
+    convective_day DATE NOT NULL,
+    f_scale VARCHAR(10),
+    rating SMALLINT,
+    rating_scale VARCHAR(2) NOT NULL DEFAULT '',
+    location VARCHAR(100),
+    county VARCHAR(100),
+    state VARCHAR(100),
+    lat DOUBLE PRECISION,
+    lon DOUBLE PRECISION,
+    comments VARCHAR(240),
+    source VARCHAR(16) NOT NULL DEFAULT '',
+    emitted_at TIMESTAMP(3),
+    kafka_topic VARCHAR(255) NOT NULL DEFAULT '',
+    kafka_partition INT,
+    kafka_offset BIGINT,
+    ingested_at TIMESTAMP,
+    geog GEOGRAPHY(Point, 4326) GENERATED ALWAYS AS (ST_SetSRID(ST_MakePoint(lon, lat), 4326)::geography) STORED
+);
+CREATE INDEX idx_tornado_events_time_id ON tornado_events (event_time, event_id);
+CREATE INDEX idx_tornado_events_rating_id ON tornado_events (rating, event_id);
+CREATE INDEX idx_tornado_events_lat_lon ON tornado_events (lat, lon);
+CREATE INDEX idx_tornado_events_geog ON tornado_events USING GIST (geog);
+CREATE INDEX idx_tornado_events_geom ON tornado_events USING GIST ((geog::geometry));
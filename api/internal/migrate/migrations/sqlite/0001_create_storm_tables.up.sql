@@ -0,0 +1,75 @@
+-- The schema of the MySQL migrations up to 0007 in one step. Times are
+-- stored as text in the format written by the api.
+CREATE TABLE hail_events (
+    event_id TEXT NOT NULL PRIMARY KEY,
+    event_time DATETIME NOT NULL,
+    convective_day DATE NOT NULL,
+    size TEXT,
+    size_in REAL,
+    size_mm REAL,
+    location TEXT,
+    county TEXT,
+    state TEXT,
+    lat REAL,
+    lon REAL,
+    comments TEXT,
+    source TEXT NOT NULL DEFAULT '',
+    emitted_at DATETIME,
+    kafka_topic TEXT NOT NULL DEFAULT '',
+    kafka_partition INTEGER,
+    kafka_offset INTEGER,
+    ingested_at DATETIME
+);
+CREATE INDEX idx_hail_events_time_id ON hail_events (event_time, event_id);
+CREATE INDEX idx_hail_events_size_id ON hail_events (size_in, event_id);
+CREATE INDEX idx_hail_events_lat_lon ON hail_events (lat, lon);
+
+CREATE TABLE wind_events (
+    event_id TEXT NOT NULL PRIMARY KEY,
+    event_time DATETIME NOT NULL,
+    convective_day DATE NOT NULL,
+    speed TEXT,
+    speed_mph REAL,
+    speed_kts REAL,
+    speed_estimated BOOLEAN NOT NULL DEFAULT FALSE,
+    speed_unknown BOOLEAN NOT NULL DEFAULT FALSE,
+    location TEXT,
+    county TEXT,
+    state TEXT,
+    lat REAL,
+    lon REAL,
+    comments TEXT,
+    source TEXT NOT NULL DEFAULT '',
+    emitted_at DATETIME,
+    kafka_topic TEXT NOT NULL DEFAULT '',
+    kafka_partition INTEGER,
+    kafka_offset INTEGER,
+    ingested_at DATETIME
+);
+CREATE INDEX idx_wind_events_time_id ON wind_events (event_time, event_id);
+CREATE INDEX idx_wind_events_speed_id ON wind_events (speed_mph, event_id);
+CREATE INDEX idx_wind_events_lat_lon ON wind_events (lat, lon);
+
+CREATE TABLE tornado_events (
+    event_id TEXT NOT NULL PRIMARY KEY,
+    event_time DATETIME NOT NULL,
+    convective_day DATE NOT NULL,
+    f_scale TEXT,
+    rating INTEGER,
+    rating_scale TEXT NOT NULL DEFAULT '',
+    location TEXT,
+    county TEXT,
+    state TEXT,
+    lat REAL,
+    lon REAL,
+    comments TEXT,
+    source TEXT NOT NULL DEFAULT '',
+    emitted_at DATETIME,
+    kafka_topic TEXT NOT NULL DEFAULT '',
+    kafka_partition INTEGER,
+    kafka_offset INTEGER,
+    ingested_at DATETIME
+);
+CREATE INDEX idx_tornado_events_time_id ON tornado_events (event_time, event_id);
+CREATE INDEX idx_tornado_events_rating_id ON tornado_events (rating, event_id);
+CREATE INDEX idx_tornado_events_lat_lon ON tornado_events (lat, lon);
@@ -0,0 +1,139 @@
+package weather
+
+import (
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// maxInsertRows bounds the rows of one INSERT, keeping its placeholders well
+// under the limits of MySQL, PostgreSQL and SQLite.
+const maxInsertRows = 500
+
+// Batch holds the events of several messages to be written together.
+type Batch struct {
+	Hail    []HailEvent
+	Wind    []WindEvent
+	Tornado []TornadoEvent
+}
+
+func (b Batch) Len() int {
+	return len(b.Hail) + len(b.Wind) + len(b.Tornado)
+}
+
+// events lists every event of the batch.
+func (b Batch) events() []WeatherDbEvent {
+	events := make([]WeatherDbEvent, 0, b.Len())
+	for _, e := range b.Hail {
+		events = append(events, e)
+	}
+	for _, e := range b.Wind {
+		events = append(events, e)
+	}
+	for _, e := range b.Tornado {
+		events = append(events, e)
+	}
+	return events
+}
+
+// BatchStats reports the batches written by the consumer.
+type BatchStats struct {
+	Batches atomic.Int64
+	Events  atomic.Int64
+	// Fallbacks counts batches that failed as a whole and were saved one
+	// event at a time.
+	Fallbacks atomic.Int64
+	// Retries counts writes that failed on a transient error and were
+	// scheduled again, Paused whether the partitions are paused until the
+	// database is back.
+	Retries atomic.Int64
+	Paused  atomic.Bool
+	// LastSize is the number of events of the latest batch, LastWait how
+	// long its first message waited to be written and LastInsert how long
+	// writing it took.
+	LastSize   atomic.Int64
+	LastWait   atomic.Int64
+	LastInsert atomic.Int64
+}
+
+func (s *BatchStats) record(size int, wait time.Duration, insert time.Duration) {
+	s.Batches.Add(1)
+	s.Events.Add(int64(size))
+	s.LastSize.Store(int64(size))
+	s.LastWait.Store(int64(wait))
+	s.LastInsert.Store(int64(insert))
+}
+
+// latestRows keeps the last row of every event_id, the first column, as
+// PostgreSQL rejects an upsert that touches the same row twice.
+func latestRows(rows [][]interface{}) [][]interface{} {
+	last := make(map[interface{}]int, len(rows))
+	for i, row := range rows {
+		last[row[0]] = i
+	}
+	var result [][]interface{}
+	for i, row := range rows {
+		if last[row[0]] == i {
+			result = append(result, row)
+		}
+	}
+	return result
+}
+
+// insertRows upserts rows into table with as few statements as the row
+// limit allows.
+func (s *SqlStore) insertRows(tx *sql.Tx, table string, columns []string, rows [][]interface{}) error {
+	rows = latestRows(rows)
+	for start := 0; start < len(rows); start += maxInsertRows {
+		end := start + maxInsertRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := s.exec(tx, upsertRows(s.dialect, table, columns, rows[start:end]...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SaveBatch upserts every event of batch in one transaction.
+func (s *SqlStore) SaveBatch(batch Batch) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op.
+	defer tx.Rollback()
+
+	hail := make([][]interface{}, len(batch.Hail))
+	for i, e := range batch.Hail {
+		hail[i] = e.values()
+	}
+	if err := s.insertRows(tx, "hail_events", hailColumns, hail); err != nil {
+		return err
+	}
+	wind := make([][]interface{}, len(batch.Wind))
+	for i, e := range batch.Wind {
+		wind[i] = e.values()
+	}
+	if err := s.insertRows(tx, "wind_events", windColumns, wind); err != nil {
+		return err
+	}
+	tornado := make([][]interface{}, len(batch.Tornado))
+	for i, e := range batch.Tornado {
+		tornado[i] = e.values()
+	}
+	if err := s.insertRows(tx, "tornado_events", tornadoColumns, tornado); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *MemoryStore) SaveBatch(batch Batch) error {
+	for _, event := range batch.events() {
+		if err := event.Save(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package weather
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestSaveBatchMysql(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	store := NewSqlStore(db, DriverMysql)
+	eventTime := time.Date(2024, 5, 6, 20, 10, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO hail_events (event_id,event_time,")).
+		WithArgs("h2", eventTime, "2024-05-06", "100", nil, nil, "MOORE", "", "OK", 35.34, -97.49, "", "", nil, "", nil, nil, nil,
+			"h1", eventTime, "2024-05-06", "175", nil, nil, "NORMAN", "", "OK", 35.22, -97.44, "", "", nil, "", nil, nil, nil).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tornado_events")).WillReturnError(errors.New("Data too long for column 'f_scale'"))
+	mock.ExpectRollback()
+
+	err = store.SaveBatch(Batch{
+		Hail: []HailEvent{
+			{EventId: "h1", EventTime: eventTime, ConvectiveDay: "2024-05-06", Size: "100", Location: "NORMAN", State: "OK", Lat: 35.22, Lon: -97.44},
+			{EventId: "h2", EventTime: eventTime, ConvectiveDay: "2024-05-06", Size: "100", Location: "MOORE", State: "OK", Lat: 35.34, Lon: -97.49},
+			// A re-sent report in the same batch overwrites the first copy.
+			{EventId: "h1", EventTime: eventTime, ConvectiveDay: "2024-05-06", Size: "175", Location: "NORMAN", State: "OK", Lat: 35.22, Lon: -97.44},
+		},
+		Tornado: []TornadoEvent{{EventId: "t1", FScale: "EF2 (ESTIMATED)"}},
+	})
+	assert.EqualError(t, err, "Data too long for column 'f_scale'")
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveBatchSqlite(t *testing.T) {
+	repo := sqliteRepo(t)
+	var batch Batch
+	start := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < maxInsertRows+20; i++ {
+		eventTime := start.Add(time.Duration(i) * time.Minute)
+		batch.Wind = append(batch.Wind, WindEvent{EventId: fmt.Sprintf("w%04d", i), EventTime: eventTime,
+			ConvectiveDay: convectiveDay("", eventTime), Speed: "60", State: "OK", Lat: 35, Lon: -97})
+	}
+	assert.Nil(t, repo.Store.SaveBatch(batch))
+	assert.Nil(t, repo.Store.SaveBatch(batch))
+	count, err := repo.Store.Count(Wind, StormFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, maxInsertRows+20, count)
+}
+
+// failingBatchStore fails every batch so the consumer falls back to saving
+// one event at a time.
+type failingBatchStore struct {
+	*MemoryStore
+}
+
+func (failingBatchStore) SaveBatch(Batch) error {
+	return errors.New("Data too long for column 'f_scale'")
+}
+
+type batchCase struct {
+	store             Store
+	batchSize         int
+	flushInterval     time.Duration
+	expectedBatches   int64
+	expectedFallbacks int64
+}
+
+func TestProcessBatches(t *testing.T) {
+	testCases := []batchCase{
+		// Two full batches, the last one written on shutdown.
+		{store: NewMemoryStore(), batchSize: 2, flushInterval: time.Minute, expectedBatches: 2},
+		// One batch per message as the flush interval passes in between.
+		{store: NewMemoryStore(), batchSize: 100, flushInterval: time.Millisecond, expectedBatches: 3},
+		{store: failingBatchStore{NewMemoryStore()}, batchSize: 3, flushInterval: time.Minute, expectedBatches: 1, expectedFallbacks: 1},
+	}
+	for _, tc := range testCases {
+		consumer := NewMemoryConsumer("transformed-weather-data")
+		repo := NewModelsRepo(tc.store)
+		process := NewProcess(consumer, repo, Kakfa{BatchSize: tc.batchSize, FlushInterval: tc.flushInterval}, zap.NewNop())
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- process.Start(ctx)
+		}()
+
+		for i, value := range []string{
+			`{"StormType": "hail", "Time": 1715026200, "Size": "175", "Lat": 35.22, "Lon": -97.44}`,
+			`not json`,
+			`{"StormType": "wind", "Time": 1715047800, "Speed": "60", "Lat": 35.34, "Lon": -97.49}`,
+			`{"StormType": "hail", "Time": 1715026200, "Size": "100", "Lat": 35.3, "Lon": -97.5}`,
+		} {
+			consumer.Add([]byte(fmt.Sprintf("e%d", i)), []byte(value))
+			if tc.flushInterval == time.Millisecond {
+				assert.Eventually(t, func() bool { return consumer.CommittedOffset() == kafka.Offset(i+1) }, time.Second, time.Millisecond)
+			}
+		}
+		if tc.batchSize == 2 {
+			// The bad message doesn't count, so the first batch fills up with
+			// the third message and the last one waits for shutdown.
+			assert.Eventually(t, func() bool { return consumer.CommittedOffset() == 3 }, time.Second, time.Millisecond)
+		}
+		assert.Eventually(t, func() bool { return consumer.Read() == 4 }, time.Second, time.Millisecond)
+		cancel()
+		assert.Nil(t, <-done)
+
+		assert.Equal(t, kafka.Offset(4), consumer.CommittedOffset())
+		assert.Equal(t, tc.expectedBatches, process.Stats.Batches.Load())
+		assert.Equal(t, int64(3), process.Stats.Events.Load())
+		assert.Equal(t, tc.expectedFallbacks, process.Stats.Fallbacks.Load())
+		count, err := repo.countStorms(StormFilter{})
+		assert.Nil(t, err)
+		assert.Equal(t, 3, count)
+	}
+}
+
+// unavailableStore fails every batch as if the database were unreachable
+// while down is set.
+type unavailableStore struct {
+	*MemoryStore
+	down *atomic.Bool
+}
+
+func (s unavailableStore) SaveBatch(batch Batch) error {
+	if s.down.Load() {
+		return driver.ErrBadConn
+	}
+	return s.MemoryStore.SaveBatch(batch)
+}
+
+func TestProcessDatabaseOutage(t *testing.T) {
+	consumer := NewMemoryConsumer("transformed-weather-data")
+	down := &atomic.Bool{}
+	down.Store(true)
+	repo := NewModelsRepo(unavailableStore{MemoryStore: NewMemoryStore(), down: down})
+	process := NewProcess(consumer, repo, Kakfa{BatchSize: 100, FlushInterval: time.Millisecond,
+		RetryBackoff: time.Millisecond, MaxRetryBackoff: 5 * time.Millisecond}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+
+	consumer.Add([]byte("h1"), []byte(`{"StormType": "hail", "Time": 1715026200, "Size": "175", "Lat": 35.22, "Lon": -97.44}`))
+	assert.Eventually(t, func() bool { return process.Stats.Retries.Load() >= 3 }, time.Second, time.Millisecond)
+	// Nothing more is read nor committed until the batch is saved.
+	consumer.Add([]byte("w1"), []byte(`{"StormType": "wind", "Time": 1715047800, "Speed": "60", "Lat": 35.34, "Lon": -97.49}`))
+	time.Sleep(20 * time.Millisecond)
+	assert.True(t, consumer.Paused())
+	assert.True(t, process.Stats.Paused.Load())
+	assert.Equal(t, 1, consumer.Read())
+	assert.Equal(t, kafka.OffsetInvalid, consumer.CommittedOffset())
+
+	down.Store(false)
+	assert.Eventually(t, func() bool { return consumer.CommittedOffset() == 2 }, time.Second, time.Millisecond)
+	cancel()
+	assert.Nil(t, <-done)
+
+	assert.False(t, consumer.Paused())
+	assert.False(t, process.Stats.Paused.Load())
+	assert.Equal(t, int64(0), process.Stats.Fallbacks.Load())
+	count, err := repo.countStorms(StormFilter{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+}
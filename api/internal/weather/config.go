@@ -3,14 +3,39 @@ package weather
 import (
 	"errors"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Kakfa struct {
 	Broker        string
 	ConsumerTopic string
 	GroupId       string
+	// Messages are written in batches of up to BatchSize events, or
+	// whatever has been read once the first one waited FlushInterval.
+	BatchSize     int
+	FlushInterval time.Duration
+	// A batch that fails on a transient database error is retried after
+	// RetryBackoff, doubled on every further failure up to MaxRetryBackoff.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	// PayloadSampling logs the raw payload of one consumed message in every
+	// PayloadSampling at debug level, none when 0.
+	PayloadSampling int
+	// JSON messages are always read. With EncodingAvro, Avro messages are
+	// read too, with the schemas registered in SchemaSubject of the registry
+	// at SchemaRegistryUrl.
+	Encoding          string
+	SchemaRegistryUrl string
+	SchemaSubject     string
 }
 
+// Encodings of the transformed messages selected by MESSAGE_ENCODING.
+const (
+	EncodingJson = "json"
+	EncodingAvro = "avro"
+)
+
 func ParseEnv() (Kakfa, error) {
 	var kafkaConfig Kakfa
 	kafkaConfig.ConsumerTopic = os.Getenv("KAFKA_CONSUMER_TOPIC")
@@ -25,5 +50,104 @@ func ParseEnv() (Kakfa, error) {
 	if kafkaConfig.GroupId == "" {
 		kafkaConfig.GroupId = "go-weather-etl"
 	}
+	kafkaConfig.BatchSize = 500
+	if batchSize := os.Getenv("CONSUMER_BATCH_SIZE"); batchSize != "" {
+		size, err := strconv.Atoi(batchSize)
+		if err != nil || size < 1 {
+			return kafkaConfig, errors.New("CONSUMER_BATCH_SIZE must be a positive integer.")
+		}
+		kafkaConfig.BatchSize = size
+	}
+	flushInterval, err := parseDuration("CONSUMER_FLUSH_INTERVAL", time.Second)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.FlushInterval = flushInterval
+	kafkaConfig.RetryBackoff, err = parseDuration("CONSUMER_RETRY_BACKOFF", 500*time.Millisecond)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.MaxRetryBackoff, err = parseDuration("CONSUMER_MAX_RETRY_BACKOFF", 30*time.Second)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.PayloadSampling = 100
+	if sampling := os.Getenv("LOG_PAYLOAD_SAMPLING"); sampling != "" {
+		every, err := strconv.Atoi(sampling)
+		if err != nil || every < 0 {
+			return kafkaConfig, errors.New("LOG_PAYLOAD_SAMPLING must be a non-negative integer.")
+		}
+		kafkaConfig.PayloadSampling = every
+	}
+	kafkaConfig.Encoding = EncodingJson
+	if encoding := os.Getenv("MESSAGE_ENCODING"); encoding != "" {
+		if encoding != EncodingJson && encoding != EncodingAvro {
+			return kafkaConfig, errors.New("MESSAGE_ENCODING must be json or avro.")
+		}
+		kafkaConfig.Encoding = encoding
+	}
+	kafkaConfig.SchemaRegistryUrl = os.Getenv("SCHEMA_REGISTRY_URL")
+	if kafkaConfig.Encoding == EncodingAvro && kafkaConfig.SchemaRegistryUrl == "" {
+		return kafkaConfig, errors.New("SCHEMA_REGISTRY_URL is required with the avro encoding.")
+	}
+	kafkaConfig.SchemaSubject = os.Getenv("SCHEMA_REGISTRY_SUBJECT")
+	if kafkaConfig.SchemaSubject == "" {
+		kafkaConfig.SchemaSubject = kafkaConfig.ConsumerTopic + "-value"
+	}
 	return kafkaConfig, nil
 }
+
+// Server configures the HTTP listener and the deadlines of each shutdown step.
+type Server struct {
+	Addr string
+	// HttpShutdownTimeout bounds how long active requests may take to finish.
+	HttpShutdownTimeout time.Duration
+	// ConsumerShutdownTimeout bounds how long the Kafka consumer may take to
+	// write its current batch and close.
+	ConsumerShutdownTimeout time.Duration
+	// DbCloseTimeout bounds how long closing the database pool may take.
+	DbCloseTimeout time.Duration
+	// RequireCurrentSchema refuses to start while migrations are pending.
+	RequireCurrentSchema bool
+}
+
+func ParseServerEnv() (Server, error) {
+	var serverConfig Server
+	serverConfig.Addr = os.Getenv("HTTP_ADDR")
+	if serverConfig.Addr == "" {
+		serverConfig.Addr = ":8080"
+	}
+	var err error
+	serverConfig.HttpShutdownTimeout, err = parseDuration("HTTP_SHUTDOWN_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return serverConfig, err
+	}
+	serverConfig.ConsumerShutdownTimeout, err = parseDuration("CONSUMER_SHUTDOWN_TIMEOUT", 15*time.Second)
+	if err != nil {
+		return serverConfig, err
+	}
+	serverConfig.DbCloseTimeout, err = parseDuration("DB_CLOSE_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return serverConfig, err
+	}
+	if requireCurrent := os.Getenv("DB_REQUIRE_CURRENT_SCHEMA"); requireCurrent != "" {
+		serverConfig.RequireCurrentSchema, err = strconv.ParseBool(requireCurrent)
+		if err != nil {
+			return serverConfig, errors.New("DB_REQUIRE_CURRENT_SCHEMA must be true or false.")
+		}
+	}
+	return serverConfig, nil
+}
+
+// parseDuration reads a positive duration such as "500ms" or "10s" from key.
+func parseDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.New(key + " must be a positive duration such as 500ms or 10s.")
+	}
+	return duration, nil
+}
@@ -1,23 +1,108 @@
 package weather
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 )
 
-type MysqlRepository struct {
+// Store saves storm events and queries them back. A nil page reads every
+// event matching the filter, otherwise the events of the page after its
+// cursor, in its order, plus one to tell whether another page follows.
+type Store interface {
+	SaveHail(event HailEvent) error
+	SaveWind(event WindEvent) error
+	SaveTornado(event TornadoEvent) error
+	// SaveBatch saves every event of batch, all of them or none.
+	SaveBatch(batch Batch) error
+	EachHail(filter StormFilter, page *Page, fn func(HailEvent) error) error
+	EachWind(filter StormFilter, page *Page, fn func(WindEvent) error) error
+	EachTornado(filter StormFilter, page *Page, fn func(TornadoEvent) error) error
+	// Count counts the events of stormType matching filter.
+	Count(stormType string, filter StormFilter) (int, error)
+	// Ingestion returns the ingestion metadata of an event.
+	Ingestion(stormType string, eventId string) (Ingestion, error)
+	// Ping checks that the database can be reached.
+	Ping(ctx context.Context) error
+	Close(timeout time.Duration) error
+}
+
+// SqlStore is the Store of the MySQL, PostgreSQL and SQLite backends.
+type SqlStore struct {
 	DB *sql.DB
+	// Driver is one of DriverMysql, DriverPostgres or DriverSqlite.
+	Driver  string
+	dialect dialect
 }
 
-func NewMysqlRepository(connString string) (*MysqlRepository, error) {
-	db, err := sql.Open("mysql", connString)
+func NewSqlStore(db *sql.DB, driver string) *SqlStore {
+	return &SqlStore{DB: db, Driver: driver, dialect: dialects[driver]}
+}
+
+// parseDatabaseUrl returns the driver and data source name of a DATABASE_URL.
+// URLs without a scheme are MySQL DSNs such as user:password@/storms.
+func parseDatabaseUrl(databaseUrl string) (string, string, error) {
+	scheme, rest, found := strings.Cut(databaseUrl, "://")
+	if !found {
+		return DriverMysql, databaseUrl, nil
+	}
+	switch scheme {
+	case "mysql":
+		return DriverMysql, rest, nil
+	case "postgres", "postgresql":
+		return DriverPostgres, databaseUrl, nil
+	case "sqlite":
+		return DriverSqlite, rest, nil
+	}
+	return "", "", errors.New("DATABASE_URL scheme must be mysql, postgres or sqlite.")
+}
+
+// OpenStore connects to the backend selected by the DATABASE_URL scheme:
+// mysql://, postgres:// or sqlite://path, with no scheme meaning MySQL.
+func OpenStore(databaseUrl string) (*SqlStore, error) {
+	driver, dsn, err := parseDatabaseUrl(databaseUrl)
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
-	db.SetConnMaxLifetime(time.Minute * 3)
-	return &MysqlRepository{DB: db}, nil
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == DriverSqlite {
+		// SQLite allows one writer at a time and every connection to
+		// :memory: would see its own database, so one connection is kept
+		// open for good.
+		db.SetMaxOpenConns(1)
+	} else {
+		db.SetMaxOpenConns(10)
+		db.SetMaxIdleConns(10)
+		db.SetConnMaxLifetime(time.Minute * 3)
+	}
+	return NewSqlStore(db, driver), nil
+}
+
+// Ping checks that the database can still be reached.
+func (s *SqlStore) Ping(ctx context.Context) error {
+	return s.DB.PingContext(ctx)
+}
+
+// Close closes the connection pool, waiting up to timeout for in-use
+// connections to be returned.
+func (s *SqlStore) Close(timeout time.Duration) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- s.DB.Close()
+	}()
+	select {
+	case err := <-closed:
+		return err
+	case <-time.After(timeout):
+		return errors.New("timed out closing database connections")
+	}
 }
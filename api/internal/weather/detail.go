@@ -0,0 +1,137 @@
+package weather
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// nearbyLinkRadiusMi is the radius of the nearby links of an event.
+const nearbyLinkRadiusMi = 10
+
+var ErrStormNotFound = errors.New("Storm event not found.")
+
+// Ingestion records how an event reached the database. Rows saved before
+// it was tracked have empty values.
+type Ingestion struct {
+	// Source is the report-day convention of the raw report, spc or calendar.
+	Source string `json:"source"`
+	// EmittedAt is when the collector published the raw report.
+	EmittedAt      *time.Time `json:"emitted_at"`
+	KafkaTopic     string     `json:"kafka_topic"`
+	KafkaPartition *int32     `json:"kafka_partition"`
+	KafkaOffset    *int64     `json:"kafka_offset"`
+	IngestedAt     *time.Time `json:"ingested_at"`
+}
+
+var ingestionColumns = []string{"source", "emitted_at", "kafka_topic", "kafka_partition", "kafka_offset", "ingested_at"}
+
+// newIngestion records where an event was consumed from. emittedAt is zero
+// when the collector didn't say.
+func newIngestion(source string, emittedAt time.Time, partition kafka.TopicPartition, ingestedAt time.Time) *Ingestion {
+	ingestion := &Ingestion{
+		Source:         source,
+		KafkaPartition: &partition.Partition,
+		IngestedAt:     &ingestedAt,
+	}
+	if partition.Topic != nil {
+		ingestion.KafkaTopic = *partition.Topic
+	}
+	offset := int64(partition.Offset)
+	ingestion.KafkaOffset = &offset
+	if !emittedAt.IsZero() {
+		ingestion.EmittedAt = &emittedAt
+	}
+	return ingestion
+}
+
+// values are the insert values of ingestionColumns, NULL when i is nil.
+func (i *Ingestion) values() []interface{} {
+	if i == nil {
+		return []interface{}{"", nil, "", nil, nil, nil}
+	}
+	return []interface{}{i.Source, i.EmittedAt, i.KafkaTopic, i.KafkaPartition, i.KafkaOffset, i.IngestedAt}
+}
+
+// eventPath is the path of the event at GET /storm/{type}/{id}.
+func eventPath(stormType string, eventId string) string {
+	return "/storm/" + stormType + "/" + url.PathEscape(eventId)
+}
+
+// StormLinks point from an event to itself and to the events around it.
+type StormLinks struct {
+	Self string `json:"self"`
+	// Nearby lists events within nearbyLinkRadiusMi on the same convective
+	// day, NearbyAllTime at any time.
+	Nearby        string `json:"nearby"`
+	NearbyAllTime string `json:"nearby_all_time"`
+}
+
+func newStormLinks(stormType string, eventId string, lat float64, lon float64, convectiveDay string) StormLinks {
+	values := url.Values{}
+	values.Set("lat", strconv.FormatFloat(lat, 'f', -1, 64))
+	values.Set("lon", strconv.FormatFloat(lon, 'f', -1, 64))
+	values.Set("radius_mi", strconv.Itoa(nearbyLinkRadiusMi))
+	allTime := "/storm/nearby?" + values.Encode()
+	values.Set("start", convectiveDay)
+	values.Set("end", convectiveDay)
+	values.Set("date_type", DateTypeConvective)
+	return StormLinks{
+		Self:          eventPath(stormType, eventId),
+		Nearby:        "/storm/nearby?" + values.Encode(),
+		NearbyAllTime: allTime,
+	}
+}
+
+// StormDetail is a single event with everything stored about it.
+type StormDetail struct {
+	StormType string `json:"storm_type"`
+	// Event is a HailEvent, WindEvent or TornadoEvent.
+	Event     interface{} `json:"event"`
+	Ingestion Ingestion   `json:"ingestion"`
+	Links     StormLinks  `json:"links"`
+}
+
+// GetStorm returns the event of stormType with eventId, or ErrStormNotFound.
+func (x *ModelsRepo) GetStorm(stormType string, eventId string) (StormDetail, error) {
+	detail := StormDetail{StormType: stormType}
+	var lat, lon float64
+	var convectiveDay string
+	filter := StormFilter{EventId: eventId}
+	var err error
+	switch stormType {
+	case Hail:
+		err = x.Store.EachHail(filter, nil, func(e HailEvent) error {
+			detail.Event, lat, lon, convectiveDay = e, e.Lat, e.Lon, e.ConvectiveDay
+			return nil
+		})
+	case Wind:
+		err = x.Store.EachWind(filter, nil, func(e WindEvent) error {
+			detail.Event, lat, lon, convectiveDay = e, e.Lat, e.Lon, e.ConvectiveDay
+			return nil
+		})
+	case Tornado:
+		err = x.Store.EachTornado(filter, nil, func(e TornadoEvent) error {
+			detail.Event, lat, lon, convectiveDay = e, e.Lat, e.Lon, e.ConvectiveDay
+			return nil
+		})
+	default:
+		return StormDetail{}, errors.New("Invalid type")
+	}
+	if err != nil {
+		return StormDetail{}, err
+	}
+	if detail.Event == nil {
+		return StormDetail{}, ErrStormNotFound
+	}
+
+	detail.Ingestion, err = x.Store.Ingestion(stormType, eventId)
+	if err != nil {
+		return StormDetail{}, err
+	}
+	detail.Links = newStormLinks(stormType, eventId, lat, lon, convectiveDay)
+	return detail, nil
+}
@@ -0,0 +1,121 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestNewIngestion(t *testing.T) {
+	topic := "transformed-weather-data"
+	ingestedAt := time.Date(2024, 5, 7, 1, 0, 0, 0, time.UTC)
+	ingestion := newIngestion("spc", time.UnixMilli(1715040000123).UTC(),
+		kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 41}, ingestedAt)
+
+	assert.Equal(t, "spc", ingestion.Source)
+	assert.Equal(t, time.Date(2024, 5, 7, 0, 0, 0, 123000000, time.UTC), *ingestion.EmittedAt)
+	assert.Equal(t, topic, ingestion.KafkaTopic)
+	assert.Equal(t, int32(2), *ingestion.KafkaPartition)
+	assert.Equal(t, int64(41), *ingestion.KafkaOffset)
+
+	event := HailEvent{EventId: "4f1c", Size: "175", Ingestion: ingestion}
+	stm, args, err := event.insert(mysqlDialect{}).ToSql()
+	assert.Nil(t, err)
+	assert.Contains(t, stm, "comments,source,emitted_at,kafka_topic,kafka_partition,kafka_offset,ingested_at)")
+	assert.Contains(t, stm, "kafka_offset = VALUES(kafka_offset)")
+	assert.Equal(t, ingestion.KafkaOffset, args[len(args)-2])
+}
+
+type detailCase struct {
+	path           string
+	expectedStatus int
+}
+
+func TestGetStorm(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+	router := gin.New()
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+
+	mock.ExpectQuery("FROM hail_events WHERE event_id = \\?").
+		WithArgs("0000000000000000000000000000000a").
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("0000000000000000000000000000000a", "2024-05-06 20:10:00", "2024-05-06", "175", 1.75, 44.5, "NORMAN", "CLEVELAND", "OK", 35.22, -97.44, ""))
+	mock.ExpectQuery("SELECT source, emitted_at, kafka_topic, kafka_partition, kafka_offset, ingested_at FROM hail_events WHERE event_id = \\?").
+		WillReturnRows(sqlmock.NewRows(ingestionColumns).
+			AddRow("spc", "2024-05-07 00:00:00.123", "transformed-weather-data", 2, 41, "2024-05-07 00:00:01"))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm/hail/0000000000000000000000000000000a", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	var detail struct {
+		StormType string     `json:"storm_type"`
+		Event     HailEvent  `json:"event"`
+		Ingestion Ingestion  `json:"ingestion"`
+		Links     StormLinks `json:"links"`
+	}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &detail))
+	assert.Equal(t, Hail, detail.StormType)
+	assert.Equal(t, "0000000000000000000000000000000a", detail.Event.EventId)
+	assert.Equal(t, 1.75, *detail.Event.SizeIn)
+	assert.Equal(t, "spc", detail.Ingestion.Source)
+	assert.Equal(t, int64(41), *detail.Ingestion.KafkaOffset)
+	assert.Equal(t, time.Date(2024, 5, 7, 0, 0, 0, 123000000, time.UTC), *detail.Ingestion.EmittedAt)
+	assert.Equal(t, StormLinks{
+		Self:          "/storm/hail/0000000000000000000000000000000a",
+		Nearby:        "/storm/nearby?date_type=convective&end=2024-05-06&lat=35.22&lon=-97.44&radius_mi=10&start=2024-05-06",
+		NearbyAllTime: "/storm/nearby?lat=35.22&lon=-97.44&radius_mi=10",
+	}, detail.Links)
+
+	mock.ExpectQuery("FROM wind_events WHERE event_id = \\?").WillReturnRows(sqlmock.NewRows(windColumns))
+	testCases := []detailCase{
+		{path: "/storm/wind/0000000000000000000000000000000b", expectedStatus: http.StatusNotFound},
+		{path: "/storm/hurricane/0000000000000000000000000000000b", expectedStatus: http.StatusBadRequest},
+		// The static routes still take precedence over the event route.
+		{path: "/storm/nearby", expectedStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		assert.Equal(t, tc.expectedStatus, recorder.Code, tc.path)
+	}
+	assert.Nil(t, mock.ExpectationsWereMet())
+}
+
+func TestListIncludesEventLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+	mock.ExpectQuery("FROM wind_events").
+		WillReturnRows(sqlmock.NewRows(windColumns).
+			AddRow("0000000000000000000000000000000c", "2024-05-06 20:10:00", "2024-05-06", "60", 60.0, 52.1, false, false, "NORMAN", "CLEVELAND", "OK", 35.22, -97.44, ""))
+
+	router := gin.New()
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm?date=2024-05-06&type=wind", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	var response struct {
+		WEvents []map[string]interface{} `json:"wind_events"`
+	}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, "0000000000000000000000000000000c", response.WEvents[0]["id"])
+	assert.Equal(t, "/storm/wind/0000000000000000000000000000000c", response.WEvents[0]["self"])
+	assert.NotContains(t, response.WEvents[0], "ingestion")
+}
@@ -0,0 +1,143 @@
+package weather
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Database drivers a SqlStore can run on.
+const (
+	DriverMysql    string = "mysql"
+	DriverPostgres string = "postgres"
+	DriverSqlite   string = "sqlite"
+)
+
+// metersPerMile converts radii for PostGIS, which measures in meters.
+const metersPerMile = 1609.344
+
+// dialect holds the SQL that differs between databases. Everything else is
+// written in the subset MySQL, PostgreSQL and SQLite share.
+type dialect interface {
+	placeholder() sq.PlaceholderFormat
+	// upsert is the insert suffix that overwrites columns of an existing row
+	// with the same event_id.
+	upsert(columns ...string) string
+	// value converts an argument to the form stored by the database.
+	value(arg interface{}) interface{}
+	// near prefilters the events within a circle and inside those in a
+	// polygon. Both may match more than the exact test, never less.
+	near(circle Circle) sq.Sqlizer
+	inside(polygon MultiPolygon) sq.Sqlizer
+}
+
+var dialects = map[string]dialect{
+	DriverMysql:    mysqlDialect{},
+	DriverPostgres: postgresDialect{},
+	DriverSqlite:   sqliteDialect{},
+}
+
+// boundingBoxes prefilters spatial queries on the (lat, lon) index of
+// databases without spatial types.
+type boundingBoxes struct{}
+
+func (boundingBoxes) near(circle Circle) sq.Sqlizer {
+	return radiusBoundingBox(circle.Lat, circle.Lon, circle.RadiusMi).condition()
+}
+
+func (boundingBoxes) inside(polygon MultiPolygon) sq.Sqlizer {
+	return polygon.Bounds().condition()
+}
+
+type mysqlDialect struct {
+	boundingBoxes
+}
+
+func (mysqlDialect) placeholder() sq.PlaceholderFormat {
+	return sq.Question
+}
+
+func (mysqlDialect) upsert(columns ...string) string {
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = column + " = VALUES(" + column + ")"
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
+func (mysqlDialect) value(arg interface{}) interface{} {
+	return arg
+}
+
+// onConflict is the upsert of PostgreSQL and SQLite.
+func onConflict(columns ...string) string {
+	assignments := make([]string, len(columns))
+	for i, column := range columns {
+		assignments[i] = column + " = EXCLUDED." + column
+	}
+	return "ON CONFLICT (event_id) DO UPDATE SET " + strings.Join(assignments, ", ")
+}
+
+// postgresDialect uses the PostGIS geography column geog, kept in sync with
+// lat and lon by the schema.
+type postgresDialect struct{}
+
+func (postgresDialect) placeholder() sq.PlaceholderFormat {
+	return sq.Dollar
+}
+
+func (postgresDialect) upsert(columns ...string) string {
+	return onConflict(columns...)
+}
+
+func (postgresDialect) value(arg interface{}) interface{} {
+	return arg
+}
+
+// near measures on a sphere, which is slightly smaller than the one of
+// haversineMi, so it never drops an event the exact test keeps.
+func (postgresDialect) near(circle Circle) sq.Sqlizer {
+	return sq.Expr("ST_DWithin(geog, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?, false)",
+		circle.Lon, circle.Lat, circle.RadiusMi*metersPerMile)
+}
+
+// inside compares as geometry, since GeoJSON polygon edges are straight
+// lines in lon/lat rather than great circles.
+func (postgresDialect) inside(polygon MultiPolygon) sq.Sqlizer {
+	geoJson, _ := json.Marshal(map[string]interface{}{
+		"type":        "MultiPolygon",
+		"coordinates": polygon,
+	})
+	return sq.Expr("ST_Intersects(geog::geometry, ST_SetSRID(ST_GeomFromGeoJSON(?::text), 4326))", string(geoJson))
+}
+
+// sqliteDialect stores times as text, which compares in time order as long
+// as every value has the same format.
+type sqliteDialect struct {
+	boundingBoxes
+}
+
+const sqliteTimeFormat = "2006-01-02 15:04:05.999"
+
+func (sqliteDialect) placeholder() sq.PlaceholderFormat {
+	return sq.Question
+}
+
+func (sqliteDialect) upsert(columns ...string) string {
+	return onConflict(columns...)
+}
+
+func (sqliteDialect) value(arg interface{}) interface{} {
+	switch v := arg.(type) {
+	case time.Time:
+		return v.UTC().Format(sqliteTimeFormat)
+	case *time.Time:
+		if v == nil {
+			return nil
+		}
+		return v.UTC().Format(sqliteTimeFormat)
+	}
+	return arg
+}
@@ -3,13 +3,26 @@ package weather
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"time"
 
+	"weather-contract/event"
+	"weather-contract/registry"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
 
-func determineStormData(sd MsgData) (WeatherDbEvent, error) {
+// convectiveDay returns the report day sent by the ETL, falling back to the
+// SPC 1200 UTC to 1159 UTC convention for messages that predate it.
+func convectiveDay(day string, eventTime time.Time) string {
+	if day != "" {
+		return day
+	}
+	return eventTime.Add(-12 * time.Hour).Format("2006-01-02")
+}
+
+// determineStormData builds the event to save from a message, recording how
+// it was ingested.
+func determineStormData(sd MsgData, ingestion *Ingestion) (WeatherDbEvent, error) {
 	switch sd.Type {
 	case "wind":
 		windEvent := WindEvent{
@@ -20,9 +33,17 @@ func determineStormData(sd MsgData) (WeatherDbEvent, error) {
 			Lat:      sd.Lat,
 			Lon:      sd.Lon,
 			Speed:    *sd.Speed,
+
+			SpeedMph:       sd.SpeedMph,
+			SpeedKts:       sd.SpeedKts,
+			SpeedEstimated: sd.SpeedEstimated,
+			SpeedUnknown:   sd.SpeedUnknown,
 		}
 		eventTime := time.Unix(sd.EventTs, 0).UTC()
 		windEvent.EventTime = eventTime
+		windEvent.EventId = sd.EventId
+		windEvent.ConvectiveDay = convectiveDay(sd.ConvectiveDay, eventTime)
+		windEvent.Ingestion = ingestion
 		return windEvent, nil
 	case "tornado":
 		tornadoEvent := TornadoEvent{
@@ -33,9 +54,15 @@ func determineStormData(sd MsgData) (WeatherDbEvent, error) {
 			Lat:      sd.Lat,
 			Lon:      sd.Lon,
 			FScale:   *sd.FScale,
+
+			Rating:      sd.Rating,
+			RatingScale: sd.RatingScale,
 		}
 		eventTime := time.Unix(sd.EventTs, 0).UTC()
 		tornadoEvent.EventTime = eventTime
+		tornadoEvent.EventId = sd.EventId
+		tornadoEvent.ConvectiveDay = convectiveDay(sd.ConvectiveDay, eventTime)
+		tornadoEvent.Ingestion = ingestion
 		return tornadoEvent, nil
 	case "hail":
 		hailEvent := HailEvent{
@@ -47,9 +74,15 @@ func determineStormData(sd MsgData) (WeatherDbEvent, error) {
 			Lat:    sd.Lat,
 			Lon:    sd.Lon,
 			Size:   *sd.Size,
+
+			SizeIn: sd.SizeIn,
+			SizeMm: sd.SizeMm,
 		}
 		eventTime := time.Unix(sd.EventTs, 0).UTC()
 		hailEvent.EventTime = eventTime
+		hailEvent.EventId = sd.EventId
+		hailEvent.ConvectiveDay = convectiveDay(sd.ConvectiveDay, eventTime)
+		hailEvent.Ingestion = ingestion
 		return hailEvent, nil
 
 	default:
@@ -57,8 +90,11 @@ func determineStormData(sd MsgData) (WeatherDbEvent, error) {
 	}
 }
 
+// MsgData is the message format of the ETL before the envelope.
 type MsgData struct {
+	// EmitTs is when the collector published the report, in milliseconds.
 	EmitTs   int64   `json:"EmitTs"`
+	Source   string  `json:"Source"`
 	FScale   *string `json:"FScale,omitempty"`
 	Size     *string `json:"Size,omitempty"`
 	Type     string  `json:"StormType"`
@@ -70,23 +106,128 @@ type MsgData struct {
 	Comments string  `json:"Comments"`
 	Speed    *string `json:"Speed,omitempty"`
 	EventTs  int64   `json:"Time"`
+	EventId  string  `json:"EventId"`
+	// ConvectiveDay is the 12Z-12Z report day the event was listed under.
+	ConvectiveDay string `json:"ConvectiveDay"`
+	// Numeric magnitudes parsed by the ETL, nil when unknown.
+	SizeIn         *float64 `json:"SizeIn"`
+	SizeMm         *float64 `json:"SizeMm"`
+	SpeedMph       *float64 `json:"SpeedMph"`
+	SpeedKts       *float64 `json:"SpeedKts"`
+	SpeedEstimated bool     `json:"SpeedEstimated"`
+	SpeedUnknown   bool     `json:"SpeedUnknown"`
+	Rating         *int     `json:"Rating"`
+	RatingScale    string   `json:"RatingScale"`
+}
+
+// decodeMessage reads the event to save from a message of the ETL, in JSON or,
+// given a decoder, Avro.
+func decodeMessage(msg *kafka.Message, decoder *event.AvroDecoder) (WeatherDbEvent, error) {
+	var envelope event.Envelope
+	var err error
+	if registry.IsFramed(msg.Value) {
+		if decoder == nil {
+			return nil, errors.New("Message is Avro encoded but MESSAGE_ENCODING is json")
+		}
+		envelope, err = decoder.Decode(msg.Value)
+	} else {
+		envelope, err = event.Decode(msg.Value)
+		if errors.Is(err, event.ErrUnversioned) {
+			return decodeLegacyMessage(msg)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	ingestion := newIngestion(envelope.Source, envelope.EmittedAt, msg.TopicPartition, time.Now().UTC())
+	return envelopeEvent(envelope, ingestion)
+}
+
+// envelopeEvent builds the event to save from a validated envelope.
+func envelopeEvent(e event.Envelope, ingestion *Ingestion) (WeatherDbEvent, error) {
+	eventTime := e.EventTime.UTC()
+	day := convectiveDay(e.ConvectiveDay, eventTime)
+	switch e.Type {
+	case event.TypeWind:
+		return WindEvent{
+			EventId:       e.EventId,
+			EventTime:     eventTime,
+			ConvectiveDay: day,
+			Comments:      e.Wind.Comments,
+			Location:      e.Wind.Location,
+			State:         e.Wind.State,
+			County:        e.Wind.County,
+			Lat:           e.Wind.Lat,
+			Lon:           e.Wind.Lon,
+			Speed:         e.Wind.Speed,
+
+			SpeedMph:       e.Wind.SpeedMph,
+			SpeedKts:       e.Wind.SpeedKts,
+			SpeedEstimated: e.Wind.SpeedEstimated,
+			SpeedUnknown:   e.Wind.SpeedUnknown,
+			Ingestion:      ingestion,
+		}, nil
+	case event.TypeTornado:
+		return TornadoEvent{
+			EventId:       e.EventId,
+			EventTime:     eventTime,
+			ConvectiveDay: day,
+			Comments:      e.Tornado.Comments,
+			Location:      e.Tornado.Location,
+			State:         e.Tornado.State,
+			County:        e.Tornado.County,
+			Lat:           e.Tornado.Lat,
+			Lon:           e.Tornado.Lon,
+			FScale:        e.Tornado.FScale,
+
+			Rating:      e.Tornado.Rating,
+			RatingScale: e.Tornado.RatingScale,
+			Ingestion:   ingestion,
+		}, nil
+	case event.TypeHail:
+		return HailEvent{
+			EventId:       e.EventId,
+			EventTime:     eventTime,
+			ConvectiveDay: day,
+			Comments:      e.Hail.Comments,
+			Location:      e.Hail.Location,
+			State:         e.Hail.State,
+			County:        e.Hail.County,
+			Lat:           e.Hail.Lat,
+			Lon:           e.Hail.Lon,
+			Size:          e.Hail.Size,
+
+			SizeIn:    e.Hail.SizeIn,
+			SizeMm:    e.Hail.SizeMm,
+			Ingestion: ingestion,
+		}, nil
+	default:
+		return nil, errors.New("Invalid type")
+	}
 }
 
-func (p Process) HandleMessage(msg *kafka.Message) error {
+// decodeLegacyMessage reads a message the ETL published before the
+// envelope, which may still be waiting in the topic after an upgrade.
+func decodeLegacyMessage(msg *kafka.Message) (WeatherDbEvent, error) {
 	var stormData MsgData
-	// Print the Kafka message metadata and value for debugging
-	fmt.Printf("Received message: Topic: %s, Partition: %d, Offset: %d, Key: %s, Value: %s\n",
-		*msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, string(msg.Key), string(msg.Value))
 	if err := json.Unmarshal(msg.Value, &stormData); err != nil {
-		return errors.New("Unable to parse message: " + err.Error())
+		return nil, errors.New("Unable to parse message: " + err.Error())
 	}
-	sd, err := determineStormData(stormData)
-	if err != nil {
-		return errors.New("Unable to determine storm data due to " + err.Error())
+	// The ETL keys every message by its event ID
+	if stormData.EventId == "" {
+		stormData.EventId = string(msg.Key)
+	}
+	if stormData.EventId == "" {
+		return nil, errors.New("Message has no event ID")
+	}
+	var emittedAt time.Time
+	if stormData.EmitTs > 0 {
+		emittedAt = time.UnixMilli(stormData.EmitTs).UTC()
 	}
-	err = sd.Save(p.MRepo.DbRepo)
+	ingestion := newIngestion(stormData.Source, emittedAt, msg.TopicPartition, time.Now().UTC())
+	sd, err := determineStormData(stormData, ingestion)
 	if err != nil {
-		return err
+		return nil, errors.New("Unable to determine storm data due to " + err.Error())
 	}
-	return nil
+	return sd, nil
 }
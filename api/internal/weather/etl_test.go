@@ -1,9 +1,18 @@
 package weather
 
 import (
+	"context"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"weather-contract/event"
+	"weather-contract/event/eventtest"
+	"weather-contract/registry"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,8 +53,126 @@ func TestDetermineStorm(t *testing.T) {
 		},
 	}
 	for _, tc := range testCases {
-		event, err := determineStormData(tc.msg)
+		event, err := determineStormData(tc.msg, nil)
 		assert.Equal(t, err, tc.err)
 		assert.Equal(t, reflect.TypeOf(event), reflect.TypeOf(tc.expectedResult))
 	}
 }
+
+// TestDecodeMessageContract checks that the envelope of every storm type is
+// saved with all of its fields.
+func TestDecodeMessageContract(t *testing.T) {
+	sizeIn, sizeMm, speedMph, speedKts, rating := 1.75, 44.5, 60.0, 52.1, 2
+	expected := map[string]WeatherDbEvent{
+		event.TypeHail: HailEvent{EventId: "4f1c2b0e9d8a7c6b5a4f3e2d1c0b9a88", EventTime: time.Date(2024, 5, 6, 20, 10, 0, 0, time.UTC), ConvectiveDay: "2024-05-06",
+			Location: "2 N NORMAN", County: "CLEVELAND", State: "OK", Lat: 35.22, Lon: -97.44, Comments: "Golf ball hail. (OUN)",
+			Size: "175", SizeIn: &sizeIn, SizeMm: &sizeMm},
+		event.TypeWind: WindEvent{EventId: "9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c44", EventTime: time.Date(2024, 5, 7, 1, 30, 0, 0, time.UTC), ConvectiveDay: "2024-05-07",
+			Location: "MOORE", County: "CLEVELAND", State: "OK", Lat: 35.34, Lon: -97.49, Comments: "Large tree limbs down. (OUN)",
+			Speed: "E60", SpeedMph: &speedMph, SpeedKts: &speedKts, SpeedEstimated: true},
+		event.TypeTornado: TornadoEvent{EventId: "c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8", EventTime: time.Date(2024, 5, 6, 22, 5, 0, 0, time.UTC), ConvectiveDay: "2024-05-06",
+			Location: "4 SW BARNSDALL", County: "OSAGE", State: "OK", Lat: 36.53, Lon: -96.19, Comments: "EF2 damage to homes. (TSA)",
+			FScale: "EF2", Rating: &rating, RatingScale: "EF"},
+	}
+	topic := "transformed-weather-data"
+	for _, envelope := range eventtest.Envelopes() {
+		value, err := event.Encode(envelope)
+		assert.Nil(t, err)
+		decoded, err := decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Offset: 7}, Value: value}, nil)
+		assert.Nil(t, err)
+
+		var ingestion *Ingestion
+		switch e := decoded.(type) {
+		case HailEvent:
+			ingestion, e.Ingestion = e.Ingestion, nil
+			decoded = e
+		case WindEvent:
+			ingestion, e.Ingestion = e.Ingestion, nil
+			decoded = e
+		case TornadoEvent:
+			ingestion, e.Ingestion = e.Ingestion, nil
+			decoded = e
+		}
+		assert.Equal(t, expected[envelope.Type], decoded)
+		assert.Equal(t, envelope.Source, ingestion.Source)
+		assert.Equal(t, envelope.EmittedAt, *ingestion.EmittedAt)
+		assert.Equal(t, int64(7), *ingestion.KafkaOffset)
+	}
+
+	// Messages from before the envelope are still read.
+	decoded, err := decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Key: []byte("h1"),
+		Value: []byte(`{"StormType": "hail", "Time": 1715026200, "Size": "175", "Lat": 35.22, "Lon": -97.44}`)}, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "h1", decoded.(HailEvent).EventId)
+
+	_, err = decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic},
+		Value: []byte(`{"schema_version": 2, "event_id": "h1", "type": "hail"}`)}, nil)
+	assert.EqualError(t, err, "Unsupported schema version 2, expected 1 to 1")
+}
+
+// TestDecodeMessageAvro checks that Avro messages are saved like the JSON
+// ones, and that the api refuses a subject whose schema it can't read.
+func TestDecodeMessageAvro(t *testing.T) {
+	server := httptest.NewServer(registry.NewMock())
+	defer server.Close()
+	config := Kakfa{Encoding: EncodingAvro, SchemaRegistryUrl: server.URL, SchemaSubject: "transformed-weather-data-value"}
+	encoder, err := event.NewAvroEncoder(context.Background(), registry.NewClient(server.URL), config.SchemaSubject)
+	assert.Nil(t, err)
+	decoder, err := newDecoder(config)
+	assert.Nil(t, err)
+
+	topic := "transformed-weather-data"
+	for _, envelope := range eventtest.Envelopes() {
+		value, err := encoder.Encode(envelope)
+		assert.Nil(t, err)
+		fromAvro, err := decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: value}, decoder)
+		assert.Nil(t, err)
+		value, err = event.Encode(envelope)
+		assert.Nil(t, err)
+		fromJson, err := decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: value}, decoder)
+		assert.Nil(t, err)
+		assert.Equal(t, fromJson.key(), fromAvro.key())
+		assert.Equal(t, reflect.TypeOf(fromJson), reflect.TypeOf(fromAvro))
+	}
+
+	value, err := encoder.Encode(eventtest.Envelopes()[0])
+	assert.Nil(t, err)
+	_, err = decodeMessage(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Value: value}, nil)
+	assert.EqualError(t, err, "Message is Avro encoded but MESSAGE_ENCODING is json")
+
+	_, err = registry.NewClient(server.URL).Register(context.Background(), "incompatible-value",
+		strings.Replace(event.AvroSchema(), `{"name": "source", "type": "string"},`, "", 1))
+	assert.Nil(t, err)
+	config.SchemaSubject = "incompatible-value"
+	_, err = newDecoder(config)
+	assert.ErrorContains(t, err, "Unable to check the Avro schema: Schema is incompatible with incompatible-value version 1: ")
+}
+
+func TestSaveUpsertsOnEventId(t *testing.T) {
+	event := HailEvent{EventId: "4f1c", Size: "175"}
+	stm, args, err := event.insert(mysqlDialect{}).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "4f1c", args[0])
+	assert.Contains(t, stm, "INSERT INTO hail_events (event_id,")
+	assert.Contains(t, stm, "ON DUPLICATE KEY UPDATE event_time = VALUES(event_time),")
+	assert.Contains(t, stm, "size = VALUES(size)")
+}
+
+func TestConvectiveDay(t *testing.T) {
+	early := time.Date(2024, 9, 15, 2, 45, 0, 0, time.UTC)
+	late := time.Date(2024, 9, 14, 17, 13, 0, 0, time.UTC)
+	assert.Equal(t, "2024-09-14", convectiveDay("", early))
+	assert.Equal(t, "2024-09-14", convectiveDay("", late))
+	assert.Equal(t, "2024-09-13", convectiveDay("2024-09-13", late))
+}
+
+func TestDateCondition(t *testing.T) {
+	stm, args, err := dateCondition("2024-09-14", DateTypeConvective).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "convective_day = ?", stm)
+	assert.Equal(t, []interface{}{"2024-09-14"}, args)
+
+	stm, _, err = dateCondition("2024-09-14", DateTypeUtc).ToSql()
+	assert.Nil(t, err)
+	assert.Equal(t, "DATE(event_time) = ?", stm)
+}
@@ -3,27 +3,66 @@ package weather
 import (
 	"context"
 	"errors"
-	"log"
 	"time"
 
+	"weather-contract/event"
+	"weather-contract/registry"
+	"weather-contract/telemetry"
+
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
+// Consumer reads transformed reports. *kafka.Consumer implements it, as
+// does MemoryConsumer for tests.
+type Consumer interface {
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	// CommitOffsets commits the offsets of the next messages to read.
+	CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	// Pause and Resume stop and restart fetching from the partitions of the
+	// Assignment while the consumer keeps polling to stay in its group.
+	Assignment() ([]kafka.TopicPartition, error)
+	Pause(partitions []kafka.TopicPartition) error
+	Resume(partitions []kafka.TopicPartition) error
+	Close() error
+}
+
 type Process struct {
-	Consumer *kafka.Consumer
+	Consumer Consumer
 	MRepo    ModelsRepo
+	// BatchSize and FlushInterval bound how many events are buffered and for
+	// how long before they are written.
+	BatchSize     int
+	FlushInterval time.Duration
+	// RetryBackoff and MaxRetryBackoff space the retries of a batch that
+	// failed on a transient database error.
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+	Stats           *BatchStats
+	Health          *telemetry.ConsumerHealth
+	Logger          *zap.Logger
+	Tracer          trace.Tracer
+	// Decoder reads Avro messages, which are rejected when it is nil.
+	Decoder  *event.AvroDecoder
+	payloads *telemetry.PayloadSampler
 }
 
-func InitProcess(mRepo ModelsRepo) (Process, error) {
+func InitProcess(mRepo ModelsRepo, logger *zap.Logger) (Process, error) {
 	config, err := ParseEnv()
 	if err != nil {
 		return Process{}, err
 	}
-	// Initialize Kafka consumer
+	// Initialize Kafka consumer. Offsets are committed once the batch
+	// holding a message has been written.
 	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": config.Broker,
-		"group.id":          config.GroupId,
-		"auto.offset.reset": "smallest"})
+		"bootstrap.servers":  config.Broker,
+		"group.id":           config.GroupId,
+		"auto.offset.reset":  "smallest",
+		"enable.auto.commit": false})
 	if err != nil {
 		return Process{}, errors.New("Unable to create kakfa consumer")
 	}
@@ -33,38 +72,289 @@ func InitProcess(mRepo ModelsRepo) (Process, error) {
 		return Process{}, errors.New("Unable to subscribed to " + config.ConsumerTopic + " topic")
 	}
 
+	process := NewProcess(consumer, mRepo, config, logger)
+	if config.Encoding == EncodingAvro {
+		process.Decoder, err = newDecoder(config)
+		if err != nil {
+			consumer.Close()
+			return Process{}, err
+		}
+	}
+	return process, nil
+}
+
+// newDecoder checks that the envelope schema of the api reads the latest one
+// registered by the ETL, so that the api refuses to start on a change it
+// couldn't read.
+func newDecoder(config Kakfa) (*event.AvroDecoder, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	decoder, err := event.NewAvroDecoder(ctx, registry.NewClient(config.SchemaRegistryUrl), config.SchemaSubject)
+	if err != nil {
+		return nil, errors.New("Unable to check the Avro schema: " + err.Error())
+	}
+	return decoder, nil
+}
+
+func NewProcess(consumer Consumer, mRepo ModelsRepo, config Kakfa, logger *zap.Logger) Process {
 	return Process{
-		Consumer: consumer,
-		MRepo:    mRepo,
-	}, nil
+		Consumer:        consumer,
+		MRepo:           mRepo,
+		BatchSize:       config.BatchSize,
+		FlushInterval:   config.FlushInterval,
+		RetryBackoff:    config.RetryBackoff,
+		MaxRetryBackoff: config.MaxRetryBackoff,
+		Stats:           &BatchStats{},
+		Health:          telemetry.NewConsumerHealth(),
+		Logger:          logger,
+		Tracer:          otel.Tracer(tracerName),
+		payloads:        telemetry.NewPayloadSampler(config.PayloadSampling),
+	}
+}
+
+// partition identifies a partition of a topic.
+type partition struct {
+	topic     string
+	partition int32
+}
+
+// pendingBatch is the batch being buffered along with the offsets to commit
+// once it has been written.
+type pendingBatch struct {
+	Batch
+	messages int
+	// next is the offset after the last message read from each partition.
+	next map[partition]kafka.Offset
+	// firstRead is when the first message of the batch was read.
+	firstRead time.Time
+	// spans of the decoded messages, ended once their events are written.
+	spans []messageSpan
+}
+
+// messageSpan is the span of a message whose event is waiting to be written.
+type messageSpan struct {
+	span    trace.Span
+	eventId string
+}
+
+func (b *pendingBatch) add(msg *kafka.Message) {
+	if b.messages == 0 {
+		b.firstRead = time.Now()
+		b.next = make(map[partition]kafka.Offset)
+	}
+	b.messages++
+	tp := partition{topic: *msg.TopicPartition.Topic, partition: msg.TopicPartition.Partition}
+	if next := msg.TopicPartition.Offset + 1; next > b.next[tp] {
+		b.next[tp] = next
+	}
+}
+
+func (b *pendingBatch) offsets() []kafka.TopicPartition {
+	offsets := make([]kafka.TopicPartition, 0, len(b.next))
+	for tp, next := range b.next {
+		topic := tp.topic
+		offsets = append(offsets, kafka.TopicPartition{Topic: &topic, Partition: tp.partition, Offset: next})
+	}
+	return offsets
+}
+
+// outage counts the consecutive writes that failed on a transient error.
+// While there are any the partitions are paused and the batch is retried at
+// retryAt.
+type outage struct {
+	failures int
+	retryAt  time.Time
 }
 
 func (p Process) Start(ctx context.Context) error {
 	defer p.Consumer.Close()
 
-	log.Println("Service is running... Listening for messages...")
-	// Continuously consume and process messages until context is canceled
+	p.Logger.Info("Service is running... Listening for messages...")
+	var batch pendingBatch
+	var down outage
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Received shutdown signal. Stopping service.")
+			p.Logger.Info("Received shutdown signal. Stopping service.")
+			if err := p.flush(&batch); err != nil {
+				p.Logger.Error("Stopping with messages unsaved, they will be read again on restart.",
+					zap.Int("messages", batch.messages), zap.Error(err))
+				for _, s := range batch.spans {
+					telemetry.EndSpan(s.span, err)
+				}
+			}
 			return nil
 		default:
-			// Read a message from Kafka
-			msg, err := p.Consumer.ReadMessage(100 * time.Millisecond)
-			if err != nil {
-				// Ignore timeout errors or handle specific error types, log others
-				if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrTimedOut {
-					continue
+		}
+
+		// Wait no longer than the batch or its retry may, and briefly enough
+		// to notice a shutdown.
+		timeout := 100 * time.Millisecond
+		var due time.Time
+		if down.failures > 0 {
+			due = down.retryAt
+		} else if batch.messages > 0 {
+			due = batch.firstRead.Add(p.FlushInterval)
+		}
+		if !due.IsZero() && time.Until(due) < timeout {
+			timeout = time.Until(due)
+		}
+		// Reading goes on while paused so the consumer stays in its group.
+		p.Health.Polled()
+		if timeout > 0 {
+			msg, err := p.Consumer.ReadMessage(timeout)
+			if err == nil {
+				p.Health.Read(msg, consumerMetrics.Record(p.Consumer, msg))
+				telemetry.LogReceived(p.Logger, p.payloads, msg)
+				batch.add(msg)
+				// Continue the trace the ETL passed on in the headers.
+				_, span := p.Tracer.Start(telemetry.Propagator.Extract(context.Background(), telemetry.HeaderCarrier{Headers: &msg.Headers}),
+					"process "+telemetry.MessageTopic(msg), trace.WithSpanKind(trace.SpanKindConsumer),
+					trace.WithAttributes(telemetry.MessageAttributes(msg)...))
+				// A message that can't be saved is skipped but its offset is
+				// still committed with the batch.
+				if event, err := decodeMessage(msg, p.Decoder); err != nil {
+					consumeFailures.WithLabelValues(ReasonDecode).Inc()
+					p.Logger.Warn("Error processing message.", append(telemetry.MessageFields(msg), zap.Error(err))...)
+					telemetry.EndSpan(span, err)
+				} else {
+					key := event.key()
+					span.SetAttributes(key.attributes()...)
+					p.Logger.Debug("Decoded message.", append(append(telemetry.MessageFields(msg), key.logFields()...),
+						zap.String("trace_id", span.SpanContext().TraceID().String()))...)
+					event.addTo(&batch.Batch)
+					batch.spans = append(batch.spans, messageSpan{span: span, eventId: key.eventId})
 				}
-				log.Printf("Error consuming message: %v\n", err)
-				continue
+			} else if kafkaErr, ok := err.(kafka.Error); !ok || kafkaErr.Code() != kafka.ErrTimedOut {
+				p.Logger.Error("Error consuming message.", zap.Error(err))
+			}
+		}
+		if down.failures > 0 {
+			if !time.Now().Before(down.retryAt) {
+				p.write(&batch, &down)
 			}
+		} else if batch.Len() >= p.BatchSize || (batch.messages > 0 && time.Since(batch.firstRead) >= p.FlushInterval) {
+			p.write(&batch, &down)
+		}
+	}
+}
 
-			// Process the message
-			if err := p.HandleMessage(msg); err != nil {
-				log.Printf("Error processing message: %v\n", err)
+// write flushes the batch. On a transient error it pauses the partitions, so
+// that Kafka keeps the reports until the database is back, and schedules the
+// batch to be retried. The first write to succeed resumes them.
+func (p Process) write(batch *pendingBatch, down *outage) {
+	err := p.flush(batch)
+	if err == nil {
+		if down.failures > 0 {
+			p.Logger.Info("Database writes succeeded, resuming consumption.", zap.Int("failed_attempts", down.failures))
+			p.setPaused(false)
+			*down = outage{}
+		}
+		return
+	}
+	down.failures++
+	backoff := retryBackoff(p.RetryBackoff, p.MaxRetryBackoff, down.failures)
+	down.retryAt = time.Now().Add(backoff)
+	p.Stats.Retries.Add(1)
+	consumeFailures.WithLabelValues(ReasonTransient).Inc()
+	p.Logger.Error("Error saving batch, pausing consumption.",
+		zap.Int("events", batch.Len()), zap.Duration("retry_in", backoff), zap.Error(err))
+	// Pausing every time also covers partitions assigned since the last try.
+	p.setPaused(true)
+}
+
+// setPaused pauses or resumes the assigned partitions.
+func (p Process) setPaused(paused bool) {
+	partitions, err := p.Consumer.Assignment()
+	if err != nil {
+		p.Logger.Error("Error reading partition assignment.", zap.Error(err))
+		return
+	}
+	if paused {
+		err = p.Consumer.Pause(partitions)
+	} else {
+		err = p.Consumer.Resume(partitions)
+	}
+	if err != nil {
+		p.Logger.Error("Error pausing or resuming partitions.", zap.Bool("paused", paused), zap.Error(err))
+		return
+	}
+	p.Stats.Paused.Store(paused)
+	if paused {
+		consumerPaused.Set(1)
+	} else {
+		consumerPaused.Set(0)
+	}
+}
+
+// flush writes the batch in one transaction and then commits its offsets.
+// When the transaction fails the events are saved one at a time, skipping
+// those that can't be, as a single bad event would otherwise hold back the
+// rest of the batch. A transient error is returned instead, keeping the batch
+// and leaving its offsets uncommitted to be retried.
+func (p Process) flush(batch *pendingBatch) error {
+	if batch.messages == 0 {
+		return nil
+	}
+	wait := time.Since(batch.firstRead)
+	size := batch.Len()
+	// failed holds the error of each event that could not be saved.
+	failed := make(map[string]error)
+	if size > 0 {
+		// Every attempt at writing the batch is linked from the spans of the
+		// messages it holds.
+		ctx, span := p.Tracer.Start(context.Background(), "insert batch", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBOperationName("upsert"), attribute.Int("weather.batch_size", size)))
+		for _, s := range batch.spans {
+			s.span.AddLink(trace.Link{SpanContext: span.SpanContext()})
+		}
+		start := time.Now()
+		err := p.MRepo.Store.SaveBatch(batch.Batch)
+		if err != nil && isTransient(err) {
+			telemetry.EndSpan(span, err)
+			return err
+		}
+		insert := time.Since(start)
+		saved := batch.Batch
+		if err != nil {
+			p.Logger.Warn("Error saving batch, saving its events one at a time.", zap.Int("events", size), zap.Error(err))
+			span.RecordError(err)
+			p.Stats.Fallbacks.Add(1)
+			saved = Batch{}
+			for _, event := range batch.events() {
+				key := event.key()
+				_, eventSpan := p.Tracer.Start(ctx, "insert event", trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(append(key.attributes(), semconv.DBOperationName("upsert"))...))
+				err := event.Save(p.MRepo.Store)
+				telemetry.EndSpan(eventSpan, err)
+				if err != nil {
+					if isTransient(err) {
+						telemetry.EndSpan(span, err)
+						return err
+					}
+					consumeFailures.WithLabelValues(ReasonSave).Inc()
+					p.Logger.Warn("Error saving event.", append(key.logFields(), zap.Error(err))...)
+					failed[key.eventId] = err
+					continue
+				}
+				event.addTo(&saved)
 			}
+			insert = time.Since(start)
 		}
+		span.End()
+		p.Stats.record(size, wait, insert)
+		recordSaved(saved, time.Now())
+		batchSize.Observe(float64(size))
+		batchInsert.Observe(insert.Seconds())
+		p.Logger.Info("Saved batch.", zap.Int("events", size), zap.Duration("insert", insert), zap.Duration("wait", wait))
+	}
+	if _, err := p.Consumer.CommitOffsets(batch.offsets()); err != nil {
+		p.Logger.Error("Error committing offsets.", zap.Error(err))
+	}
+	p.Health.Processed()
+	for _, s := range batch.spans {
+		telemetry.EndSpan(s.span, failed[s.eventId])
 	}
+	*batch = pendingBatch{}
+	return nil
 }
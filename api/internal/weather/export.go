@@ -0,0 +1,143 @@
+package weather
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	CsvContentType    = "text/csv; charset=utf-8"
+	NdjsonContentType = "application/x-ndjson"
+	// ExportErrorTrailer carries the error that cut an export short, since the
+	// status code has been sent by then.
+	ExportErrorTrailer = "X-Export-Error"
+	// flushEvery is how many rows are written between flushes to the client.
+	flushEvery = 100
+)
+
+// exportColumns are the columns a CSV or NDJSON export can select.
+var exportColumns = map[string]func(Feature) interface{}{
+	"id":             func(f Feature) interface{} { return f.Id },
+	"type":           func(f Feature) interface{} { return f.Properties.StormType },
+	"event_time":     func(f Feature) interface{} { return f.Properties.EventTime },
+	"convective_day": func(f Feature) interface{} { return f.Properties.ConvectiveDay },
+	"magnitude":      func(f Feature) interface{} { return f.Properties.Magnitude },
+	"magnitude_unit": func(f Feature) interface{} { return f.Properties.MagnitudeUnit },
+	"location":       func(f Feature) interface{} { return f.Properties.Location },
+	"county":         func(f Feature) interface{} { return f.Properties.County },
+	"state":          func(f Feature) interface{} { return f.Properties.State },
+	"lat":            func(f Feature) interface{} { return f.Geometry.Coordinates[1] },
+	"lon":            func(f Feature) interface{} { return f.Geometry.Coordinates[0] },
+	"comments":       func(f Feature) interface{} { return f.Properties.Comments },
+	"distance_mi":    func(f Feature) interface{} { return f.Properties.DistanceMi },
+}
+
+var defaultExportColumns = []string{"id", "type", "event_time", "convective_day", "magnitude", "magnitude_unit",
+	"location", "county", "state", "lat", "lon", "comments"}
+
+var nearbyExportColumns = []string{"id", "type", "event_time", "convective_day", "magnitude", "magnitude_unit",
+	"location", "county", "state", "lat", "lon", "comments", "distance_mi"}
+
+// featureWriter encodes events one at a time.
+type featureWriter interface {
+	Write(feature Feature) error
+	// Flush sends everything written so far to the underlying writer.
+	Flush() error
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	return ""
+}
+
+type csvFeatureWriter struct {
+	writer      *csv.Writer
+	columns     []string
+	header      bool
+	wroteHeader bool
+}
+
+func newCsvFeatureWriter(w io.Writer, columns []string, header bool) *csvFeatureWriter {
+	return &csvFeatureWriter{writer: csv.NewWriter(w), columns: columns, header: header}
+}
+
+func (w *csvFeatureWriter) writeHeader() error {
+	if !w.header || w.wroteHeader {
+		return nil
+	}
+	w.wroteHeader = true
+	return w.writer.Write(w.columns)
+}
+
+func (w *csvFeatureWriter) Write(feature Feature) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	record := make([]string, len(w.columns))
+	for i, column := range w.columns {
+		record[i] = csvValue(exportColumns[column](feature))
+	}
+	return w.writer.Write(record)
+}
+
+// Flush also writes the header of an empty export.
+func (w *csvFeatureWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// ndjsonFeatureWriter writes one JSON object per line, with keys in column
+// order.
+type ndjsonFeatureWriter struct {
+	writer  io.Writer
+	columns []string
+	line    bytes.Buffer
+}
+
+func newNdjsonFeatureWriter(w io.Writer, columns []string) *ndjsonFeatureWriter {
+	return &ndjsonFeatureWriter{writer: w, columns: columns}
+}
+
+func (w *ndjsonFeatureWriter) Write(feature Feature) error {
+	w.line.Reset()
+	w.line.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.line.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, err := json.Marshal(exportColumns[column](feature))
+		if err != nil {
+			return err
+		}
+		w.line.Write(key)
+		w.line.WriteByte(':')
+		w.line.Write(value)
+	}
+	w.line.WriteString("}\n")
+	_, err := w.writer.Write(w.line.Bytes())
+	return err
+}
+
+func (w *ndjsonFeatureWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,149 @@
+package weather
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type exportCase struct {
+	query               string
+	expectedContentType string
+	expectedBody        string
+}
+
+func TestStreamExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []exportCase{
+		{
+			query:               "date=2024-05-06&type=wind&format=csv",
+			expectedContentType: CsvContentType,
+			expectedBody: "id,type,event_time,convective_day,magnitude,magnitude_unit,location,county,state,lat,lon,comments\n" +
+				"00000000000000000000000000000001,wind,2024-05-06T20:10:00Z,2024-05-06,60,mph,NORMAN,CLEVELAND,OK,35.22,-97.44,\"trees down, power out\"\n" +
+				"00000000000000000000000000000002,wind,2024-05-06T21:00:00Z,2024-05-06,,mph,MOORE,CLEVELAND,OK,35.34,-97.49,\n",
+		},
+		{
+			query:               "date=2024-05-06&type=wind&format=csv&header=false&columns=location,magnitude",
+			expectedContentType: CsvContentType,
+			expectedBody:        "NORMAN,60\nMOORE,\n",
+		},
+		{
+			query:               "date=2024-05-06&type=wind&format=ndjson&columns=type,location,magnitude",
+			expectedContentType: NdjsonContentType,
+			expectedBody: `{"type":"wind","location":"NORMAN","magnitude":60}` + "\n" +
+				`{"type":"wind","location":"MOORE","magnitude":null}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+		mock.ExpectQuery("FROM wind_events").
+			WillReturnRows(sqlmock.NewRows(windColumns).
+				AddRow("00000000000000000000000000000001", "2024-05-06 20:10:00", "2024-05-06", "E60", 60.0, 52.1, true, false, "NORMAN", "CLEVELAND", "OK", 35.22, -97.44, "trees down, power out").
+				AddRow("00000000000000000000000000000002", "2024-05-06 21:00:00", "2024-05-06", "UNK", nil, nil, false, true, "MOORE", "CLEVELAND", "OK", 35.34, -97.49, ""))
+
+		router := gin.New()
+		NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm?"+tc.query, nil))
+
+		assert.Equal(t, http.StatusOK, recorder.Code, tc.query)
+		assert.Equal(t, tc.expectedContentType, recorder.Header().Get("Content-Type"), tc.query)
+		assert.Equal(t, tc.expectedBody, recorder.Body.String(), tc.query)
+		assert.Empty(t, recorder.Result().Trailer.Get(ExportErrorTrailer), tc.query)
+		db.Close()
+	}
+}
+
+func TestStreamExportError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+	mock.ExpectQuery("FROM wind_events").
+		WillReturnRows(sqlmock.NewRows(windColumns).
+			AddRow("00000000000000000000000000000003", "2024-05-06 20:10:00", "2024-05-06", "60", 60.0, 52.1, false, false, "NORMAN", "CLEVELAND", "OK", 35.22, -97.44, "").
+			AddRow("00000000000000000000000000000004", "2024-05-06 21:00:00", "2024-05-06", "60", 60.0, 52.1, false, false, "MOORE", "CLEVELAND", "OK", 35.34, -97.49, "").
+			RowError(1, errors.New("connection lost")))
+
+	router := gin.New()
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm?date=2024-05-06&type=wind&format=ndjson", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, 1, strings.Count(recorder.Body.String(), "\n"))
+	assert.Equal(t, "connection lost", recorder.Result().Trailer.Get(ExportErrorTrailer))
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm?date=2024-05-06&format=csv&columns=size", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), "columns must be from")
+}
+
+func TestStreamExportNearby(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+	mock.ExpectQuery("FROM hail_events").
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("00000000000000000000000000000005", "2024-05-06 20:10:00", "2024-05-06", "175", 1.75, 44.5, "NORMAN", "CLEVELAND", "OK", 35.2226, -97.4395, "").
+			AddRow("00000000000000000000000000000006", "2024-05-06 21:00:00", "2024-05-06", "100", 1.0, 25.4, "EDMOND", "OKLAHOMA", "OK", 35.6528, -97.4781, ""))
+	mock.ExpectQuery("FROM wind_events").WillReturnRows(sqlmock.NewRows(windColumns))
+	mock.ExpectQuery("FROM tornado_events").
+		WillReturnRows(sqlmock.NewRows(tornadoColumns).
+			AddRow("00000000000000000000000000000008", "2024-05-06 23:00:00", "2024-05-06", "EF1", 1, "EF", "MOORE", "CLEVELAND", "OK", 35.3395, -97.4867, ""))
+
+	router := gin.New()
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/storm/nearby?lat=35.4676&lon=-97.5164&radius_mi=20&format=csv&header=false&columns=type,location", nil))
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	// Rows are written nearest first across every type, as in the JSON response.
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "tornado,MOORE\nhail,EDMOND\nhail,NORMAN\n", recorder.Body.String())
+}
+
+type columnsCase struct {
+	path          string
+	expectedError string
+}
+
+func TestExportColumns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewModelsRepo(NewMemoryStore())
+	router := gin.New()
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+	testCases := []columnsCase{
+		{path: "/storm?date=2024-05-06&format=csv&columns=distance_mi",
+			expectedError: "columns must be from " + strings.Join(defaultExportColumns, ", ") + "."},
+		{path: "/storm/bbox?bbox=-97.8,35.2,-97.1,35.8&date=2024-05-06&format=csv&columns=distance_mi",
+			expectedError: "columns must be from " + strings.Join(defaultExportColumns, ", ") + "."},
+		{path: "/storm/nearby?lat=35.22&lon=-97.44&radius_mi=10&format=csv&columns=size",
+			expectedError: "columns must be from " + strings.Join(nearbyExportColumns, ", ") + "."},
+		{path: "/storm/nearby?lat=35.22&lon=-97.44&radius_mi=10&format=csv&columns=distance_mi"},
+	}
+	for _, tc := range testCases {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if tc.expectedError == "" {
+			assert.Equal(t, http.StatusOK, recorder.Code, tc.path)
+			continue
+		}
+		assert.Equal(t, http.StatusBadRequest, recorder.Code, tc.path)
+		assert.JSONEq(t, `{"errors": ["`+tc.expectedError+`"]}`, recorder.Body.String(), tc.path)
+	}
+}
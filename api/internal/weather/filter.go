@@ -0,0 +1,358 @@
+package weather
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Storm types stored by the API, one table each.
+const (
+	Hail    string = "hail"
+	Wind    string = "wind"
+	Tornado string = "tornado"
+)
+
+var stormTypes = []string{Hail, Wind, Tornado}
+
+var stateCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+const dateFormat = "2006-01-02"
+
+// Values of the /storm date_type parameter.
+const (
+	DateTypeUtc        string = "utc"
+	DateTypeConvective string = "convective"
+)
+
+// StormFilter narrows a storm query. Zero values leave a field unfiltered.
+type StormFilter struct {
+	Location  string
+	Date      string
+	DateType  string
+	StartDate string
+	EndDate   string
+	States    []string
+	County    string
+	Types     []string
+	// MinSize and MaxSize are hail diameters in inches.
+	MinSize *float64
+	MaxSize *float64
+	// MinSpeed is a wind speed in mph.
+	MinSpeed *float64
+	// MinRating is an F or EF tornado rating.
+	MinRating *int
+	// Bounds limits events to a lat/lon box.
+	Bounds *BoundingBox
+	// Near and Inside prefilter events to a circle or polygon. They may let
+	// through events outside of it, the exact test runs once they are read.
+	Near   *Circle
+	Inside MultiPolygon
+	// EventId selects a single event.
+	EventId string
+}
+
+// multiValue returns every value of key, splitting comma separated lists.
+func multiValue(values url.Values, key string) []string {
+	var result []string
+	for _, value := range values[key] {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+func parseFloatParam(values url.Values, key string, errs *[]string) *float64 {
+	value := values.Get(key)
+	if value == "" {
+		return nil
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		*errs = append(*errs, key+" must be a non-negative number.")
+		return nil
+	}
+	return &number
+}
+
+func parseDateParam(values url.Values, key string, errs *[]string) string {
+	value := values.Get(key)
+	if value == "" {
+		return ""
+	}
+	if _, err := time.Parse(dateFormat, value); err != nil {
+		*errs = append(*errs, key+" format must be YYYY-MM-DD.")
+		return ""
+	}
+	return value
+}
+
+// ParseStormFilter reads a StormFilter from /storm query parameters. It
+// returns every validation error found, in the order of the parameters.
+func ParseStormFilter(values url.Values) (StormFilter, []string) {
+	return parseFilterParams(values, "start_date", "end_date", true)
+}
+
+// parseFilterParams reads the parameters shared by the storm endpoints. The
+// date range is read from startKey and endKey, and is only mandatory when
+// requireDate is set.
+func parseFilterParams(values url.Values, startKey string, endKey string, requireDate bool) (StormFilter, []string) {
+	var errs []string
+	filter := StormFilter{
+		Location: values.Get("location"),
+		County:   values.Get("county"),
+		DateType: values.Get("date_type"),
+	}
+
+	filter.Date = parseDateParam(values, "date", &errs)
+	filter.StartDate = parseDateParam(values, startKey, &errs)
+	filter.EndDate = parseDateParam(values, endKey, &errs)
+	if len(errs) == 0 {
+		switch {
+		case filter.Date != "" && (filter.StartDate != "" || filter.EndDate != ""):
+			errs = append(errs, "date can't be combined with "+startKey+" or "+endKey+".")
+		case requireDate && filter.Date == "" && filter.StartDate == "" && filter.EndDate == "":
+			errs = append(errs, "date or a "+startKey+"/"+endKey+" range must be specified in the format YYYY-MM-DD.")
+		case filter.StartDate != "" && filter.EndDate != "" && filter.EndDate < filter.StartDate:
+			errs = append(errs, endKey+" must not be before "+startKey+".")
+		}
+	}
+	if filter.DateType == "" {
+		filter.DateType = DateTypeUtc
+	} else if filter.DateType != DateTypeUtc && filter.DateType != DateTypeConvective {
+		errs = append(errs, "date_type must be utc or convective.")
+	}
+
+	for _, state := range multiValue(values, "state") {
+		state = strings.ToUpper(state)
+		if !stateCode.MatchString(state) {
+			errs = append(errs, "state must be a two letter state code.")
+			break
+		}
+		filter.States = append(filter.States, state)
+	}
+
+	for _, stormType := range multiValue(values, "type") {
+		stormType = strings.ToLower(stormType)
+		if stormType != Hail && stormType != Wind && stormType != Tornado {
+			errs = append(errs, "type must be hail, wind or tornado.")
+			break
+		}
+		filter.Types = append(filter.Types, stormType)
+	}
+
+	filter.MinSize = parseFloatParam(values, "min_size", &errs)
+	filter.MaxSize = parseFloatParam(values, "max_size", &errs)
+	if filter.MinSize != nil && filter.MaxSize != nil && *filter.MaxSize < *filter.MinSize {
+		errs = append(errs, "max_size must not be less than min_size.")
+	}
+	filter.MinSpeed = parseFloatParam(values, "min_speed", &errs)
+	if value := values.Get("min_rating"); value != "" {
+		// Accept "2", "EF2" and "F2" alike.
+		digit := strings.ToUpper(value)
+		if strings.HasPrefix(digit, "EF") {
+			digit = strings.TrimPrefix(digit, "EF")
+		} else {
+			digit = strings.TrimPrefix(digit, "F")
+		}
+		rating, err := strconv.Atoi(digit)
+		if err != nil || len(digit) != 1 || rating < 0 || rating > 5 {
+			errs = append(errs, "min_rating must be a rating from 0 to 5.")
+		} else {
+			filter.MinRating = &rating
+		}
+	}
+
+	// Magnitude filters only make sense for the type they measure.
+	magnitudeTypes := map[string]bool{}
+	if filter.MinSize != nil || filter.MaxSize != nil {
+		magnitudeTypes[Hail] = true
+	}
+	if filter.MinSpeed != nil {
+		magnitudeTypes[Wind] = true
+	}
+	if filter.MinRating != nil {
+		magnitudeTypes[Tornado] = true
+	}
+	if len(filter.Types) > 0 {
+		for _, stormType := range stormTypes {
+			if magnitudeTypes[stormType] && !filter.IncludesType(stormType) {
+				errs = append(errs, magnitudeParams[stormType]+" can't be used without type "+stormType+".")
+			}
+		}
+	} else {
+		for _, stormType := range stormTypes {
+			if magnitudeTypes[stormType] {
+				filter.Types = append(filter.Types, stormType)
+			}
+		}
+	}
+	return filter, errs
+}
+
+var magnitudeParams = map[string]string{
+	Hail:    "min_size and max_size",
+	Wind:    "min_speed",
+	Tornado: "min_rating",
+}
+
+// IncludesType reports whether events of stormType match the filter.
+func (f StormFilter) IncludesType(stormType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == stormType {
+			return true
+		}
+	}
+	return false
+}
+
+// apply adds the conditions shared by every storm table to sql.
+func (f StormFilter) apply(sql sq.SelectBuilder, d dialect) sq.SelectBuilder {
+	if f.Date != "" {
+		sql = sql.Where(dateCondition(f.Date, f.DateType))
+	}
+	if f.StartDate != "" || f.EndDate != "" {
+		sql = sql.Where(dateRangeCondition(f.StartDate, f.EndDate, f.DateType))
+	}
+	if f.Location != "" {
+		sql = sql.Where(sq.Eq{"location": f.Location})
+	}
+	if len(f.States) > 0 {
+		sql = sql.Where(sq.Eq{"state": f.States})
+	}
+	if f.County != "" {
+		sql = sql.Where(sq.Eq{"county": f.County})
+	}
+	if f.Bounds != nil {
+		sql = sql.Where(f.Bounds.condition())
+	}
+	if f.Near != nil {
+		sql = sql.Where(d.near(*f.Near))
+	}
+	if f.Inside != nil {
+		sql = sql.Where(d.inside(f.Inside))
+	}
+	if f.EventId != "" {
+		sql = sql.Where(sq.Eq{"event_id": f.EventId})
+	}
+	return sql
+}
+
+// dateCondition matches date against the UTC calendar date of the event or,
+// for DateTypeConvective, against its convective day.
+func dateCondition(date string, dateType string) sq.Sqlizer {
+	if dateType == DateTypeConvective {
+		return sq.Eq{"convective_day": date}
+	}
+	return sq.Expr("DATE(event_time) = ?", date)
+}
+
+// dateRangeCondition matches events from start through end inclusive, either
+// bound may be empty.
+func dateRangeCondition(start string, end string, dateType string) sq.Sqlizer {
+	conditions := sq.And{}
+	if dateType == DateTypeConvective {
+		if start != "" {
+			conditions = append(conditions, sq.GtOrEq{"convective_day": start})
+		}
+		if end != "" {
+			conditions = append(conditions, sq.LtOrEq{"convective_day": end})
+		}
+		return conditions
+	}
+	if start != "" {
+		conditions = append(conditions, sq.GtOrEq{"event_time": start + " 00:00:00"})
+	}
+	if end != "" {
+		endDate, _ := time.Parse(dateFormat, end)
+		conditions = append(conditions, sq.Lt{"event_time": endDate.AddDate(0, 0, 1).Format(dateFormat) + " 00:00:00"})
+	}
+	return conditions
+}
+
+func parseCoordinate(values url.Values, key string, limit float64, errs *[]string) float64 {
+	value := values.Get(key)
+	if value == "" {
+		*errs = append(*errs, key+" must be specified.")
+		return 0
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < -limit || number > limit {
+		*errs = append(*errs, key+" must be a number from "+strconv.FormatFloat(-limit, 'f', -1, 64)+" to "+strconv.FormatFloat(limit, 'f', -1, 64)+".")
+		return 0
+	}
+	return number
+}
+
+// ParseNearbyQuery reads a NearbyQuery from /storm/nearby query parameters.
+// The other /storm filters apply as well, but no date is required.
+func ParseNearbyQuery(values url.Values) (NearbyQuery, []string) {
+	var errs []string
+	query := NearbyQuery{
+		Lat: parseCoordinate(values, "lat", 90, &errs),
+		Lon: parseCoordinate(values, "lon", 180, &errs),
+	}
+	radius := parseFloatParam(values, "radius_mi", &errs)
+	switch {
+	case radius == nil && values.Get("radius_mi") == "":
+		errs = append(errs, "radius_mi must be specified.")
+	case radius != nil && (*radius == 0 || *radius > maxRadiusMi):
+		errs = append(errs, "radius_mi must be greater than 0 and at most "+strconv.FormatFloat(maxRadiusMi, 'f', -1, 64)+".")
+	case radius != nil:
+		query.RadiusMi = *radius
+	}
+
+	filter, filterErrs := ParseSpatialFilter(values)
+	query.Filter = filter
+	return query, append(errs, filterErrs...)
+}
+
+// ParseSpatialFilter reads the /storm filters accepted by the spatial
+// endpoints, where the date range is optional and named start and end.
+func ParseSpatialFilter(values url.Values) (StormFilter, []string) {
+	return parseFilterParams(values, "start", "end", false)
+}
+
+// ParseBoxFilter reads a bbox=minLon,minLat,maxLon,maxLat query along with
+// the spatial filters.
+func ParseBoxFilter(values url.Values) (StormFilter, []string) {
+	var errs []string
+	var box *BoundingBox
+	parts := multiValue(values, "bbox")
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			parts = nil
+			break
+		}
+		numbers[i] = number
+	}
+	switch {
+	case values.Get("bbox") == "":
+		errs = append(errs, "bbox must be specified.")
+	case len(parts) != 4:
+		errs = append(errs, "bbox must be minLon,minLat,maxLon,maxLat.")
+	default:
+		box = &BoundingBox{MinLon: numbers[0], MinLat: numbers[1], MaxLon: numbers[2], MaxLat: numbers[3]}
+		if box.MinLon < -180 || box.MaxLon > 180 || box.MinLat < -90 || box.MaxLat > 90 ||
+			box.MinLon > box.MaxLon || box.MinLat > box.MaxLat {
+			errs = append(errs, "bbox must be minLon,minLat,maxLon,maxLat within -180,-90,180,90.")
+			box = nil
+		}
+	}
+
+	filter, filterErrs := ParseSpatialFilter(values)
+	filter.Bounds = box
+	return filter, append(errs, filterErrs...)
+}
@@ -0,0 +1,106 @@
+package weather
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type filterCase struct {
+	query          string
+	expectedErrors []string
+	expectedTypes  []string
+}
+
+func TestParseStormFilter(t *testing.T) {
+	testCases := []filterCase{
+		{
+			query: "date=2024-09-14",
+		},
+		{
+			query:         "start_date=2024-09-01&end_date=2024-09-07&state=TX&state=ok&min_size=1.75",
+			expectedTypes: []string{Hail},
+		},
+		{
+			query:         "start_date=2024-09-01&min_rating=EF2",
+			expectedTypes: []string{Tornado},
+		},
+		{
+			query:          "",
+			expectedErrors: []string{"date or a start_date/end_date range must be specified in the format YYYY-MM-DD."},
+		},
+		{
+			query:          "date=09-14-2024",
+			expectedErrors: []string{"date format must be YYYY-MM-DD."},
+		},
+		{
+			query:          "date=2024-09-14&start_date=2024-09-01",
+			expectedErrors: []string{"date can't be combined with start_date or end_date."},
+		},
+		{
+			query:          "start_date=2024-09-07&end_date=2024-09-01",
+			expectedErrors: []string{"end_date must not be before start_date."},
+		},
+		{
+			query:          "date=2024-09-14&state=Texas&type=snow",
+			expectedErrors: []string{"state must be a two letter state code.", "type must be hail, wind or tornado."},
+		},
+		{
+			query:          "date=2024-09-14&min_size=2&max_size=1&min_rating=7",
+			expectedErrors: []string{"max_size must not be less than min_size.", "min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:         "date=2024-09-14&min_rating=f3",
+			expectedTypes: []string{Tornado},
+		},
+		{
+			query:         "date=2024-09-14&min_rating=0",
+			expectedTypes: []string{Tornado},
+		},
+		{
+			query:          "date=2024-09-14&min_rating=FE2",
+			expectedErrors: []string{"min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:          "date=2024-09-14&min_rating=EEF2",
+			expectedErrors: []string{"min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:          "date=2024-09-14&min_rating=E2",
+			expectedErrors: []string{"min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:          "date=2024-09-14&min_rating=FFF3",
+			expectedErrors: []string{"min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:          "date=2024-09-14&min_rating=EF%2B2",
+			expectedErrors: []string{"min_rating must be a rating from 0 to 5."},
+		},
+		{
+			query:          "date=2024-09-14&type=wind&min_size=1",
+			expectedErrors: []string{"min_size and max_size can't be used without type hail."},
+		},
+	}
+	for _, tc := range testCases {
+		values, err := url.ParseQuery(tc.query)
+		assert.Nil(t, err)
+		filter, errs := ParseStormFilter(values)
+		assert.Equal(t, tc.expectedErrors, errs, tc.query)
+		if tc.expectedErrors == nil {
+			assert.Equal(t, tc.expectedTypes, filter.Types, tc.query)
+		}
+	}
+}
+
+func TestHailQuery(t *testing.T) {
+	values, _ := url.ParseQuery("start_date=2024-09-01&end_date=2024-09-07&state=TX,OK&min_size=1.75")
+	filter, errs := ParseStormFilter(values)
+	assert.Nil(t, errs)
+
+	stm, args, err := hailQuery(filter, mysqlDialect{}).ToSql()
+	assert.Nil(t, err)
+	assert.Contains(t, stm, "FROM hail_events WHERE (event_time >= ? AND event_time < ?) AND state IN (?,?) AND size_in >= ?")
+	assert.Equal(t, []interface{}{"2024-09-01 00:00:00", "2024-09-08 00:00:00", "TX", "OK", 1.75}, args)
+}
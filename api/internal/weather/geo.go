@@ -0,0 +1,191 @@
+package weather
+
+import (
+	"math"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	earthRadiusMi = 3958.8
+	// milesPerDegreeLat is the length of one degree of latitude.
+	milesPerDegreeLat = 69.0
+	maxRadiusMi       = 250.0
+)
+
+// BoundingBox is a lat/lon rectangle used to prefilter spatial queries in SQL.
+type BoundingBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+func (b BoundingBox) condition() sq.Sqlizer {
+	return sq.And{
+		sq.Expr("lat BETWEEN ? AND ?", b.MinLat, b.MaxLat),
+		sq.Expr("lon BETWEEN ? AND ?", b.MinLon, b.MaxLon),
+	}
+}
+
+// Contains reports whether the point lies inside the box, edges included.
+func (b BoundingBox) Contains(lat float64, lon float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lon >= b.MinLon && lon <= b.MaxLon
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// haversineMi is the great-circle distance in miles between two points.
+func haversineMi(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Pow(math.Sin(dLon/2), 2)
+	return 2 * earthRadiusMi * math.Asin(math.Sqrt(a))
+}
+
+// radiusBoundingBox returns a box that encloses every point within radiusMi
+// of lat/lon. Near the poles the box widens to every longitude.
+func radiusBoundingBox(lat float64, lon float64, radiusMi float64) BoundingBox {
+	dLat := radiusMi / milesPerDegreeLat
+	box := BoundingBox{
+		MinLat: math.Max(lat-dLat, -90),
+		MaxLat: math.Min(lat+dLat, 90),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+	cosLat := math.Cos(toRadians(math.Max(math.Abs(box.MinLat), math.Abs(box.MaxLat))))
+	if cosLat > 0.01 {
+		dLon := radiusMi / (milesPerDegreeLat * cosLat)
+		if lon-dLon >= -180 && lon+dLon <= 180 {
+			box.MinLon = lon - dLon
+			box.MaxLon = lon + dLon
+		}
+	}
+	return box
+}
+
+// Circle is the area within RadiusMi of a point.
+type Circle struct {
+	Lat      float64
+	Lon      float64
+	RadiusMi float64
+}
+
+// NearbyQuery selects events within RadiusMi of a point.
+type NearbyQuery struct {
+	Lat      float64
+	Lon      float64
+	RadiusMi float64
+	Filter   StormFilter
+}
+
+// withinRadius keeps the events within radiusMi of lat/lon and sets their
+// distance.
+func withinRadius[E any](events []E, query NearbyQuery, position func(*E) (float64, float64, **float64)) []E {
+	var result []E
+	for i := range events {
+		lat, lon, distance := position(&events[i])
+		miles := haversineMi(query.Lat, query.Lon, lat, lon)
+		if miles > query.RadiusMi {
+			continue
+		}
+		*distance = &miles
+		result = append(result, events[i])
+	}
+	return result
+}
+
+// GetStormsNearby returns one page of the events within the radius. As the
+// distance is only known once the events are read, the page is cut in memory
+// from every event in the bounding box.
+func (x *ModelsRepo) GetStormsNearby(query NearbyQuery, page Page) (ApiResponse, error) {
+	filter := query.Filter
+	filter.Near = &Circle{Lat: query.Lat, Lon: query.Lon, RadiusMi: query.RadiusMi}
+
+	response, err := x.fetchStorms(filter)
+	if err != nil {
+		return ApiResponse{}, err
+	}
+	response.HEvents = withinRadius(response.HEvents, query, func(e *HailEvent) (float64, float64, **float64) {
+		return e.Lat, e.Lon, &e.DistanceMi
+	})
+	response.WEvents = withinRadius(response.WEvents, query, func(e *WindEvent) (float64, float64, **float64) {
+		return e.Lat, e.Lon, &e.DistanceMi
+	})
+	response.TEvents = withinRadius(response.TEvents, query, func(e *TornadoEvent) (float64, float64, **float64) {
+		return e.Lat, e.Lon, &e.DistanceMi
+	})
+	return paginateAll(response, page), nil
+}
+
+// paginateAll cuts a page from a response holding every matching event.
+func paginateAll(response ApiResponse, page Page) ApiResponse {
+	items := responseItems(response, page.Sort)
+	result := paginate(items, page)
+	if page.IncludeTotal {
+		total := len(items)
+		result.TotalElements = &total
+	}
+	return result
+}
+
+// insidePolygon keeps the events whose position is inside polygon.
+func insidePolygon[E any](events []E, polygon MultiPolygon, position func(*E) (float64, float64)) []E {
+	var result []E
+	for i := range events {
+		if polygon.Contains(position(&events[i])) {
+			result = append(result, events[i])
+		}
+	}
+	return result
+}
+
+func (x *ModelsRepo) GetStormsInPolygon(polygon MultiPolygon, filter StormFilter, page Page) (ApiResponse, error) {
+	filter.Inside = polygon
+
+	response, err := x.fetchStorms(filter)
+	if err != nil {
+		return ApiResponse{}, err
+	}
+	response.HEvents = insidePolygon(response.HEvents, polygon, func(e *HailEvent) (float64, float64) {
+		return e.Lat, e.Lon
+	})
+	response.WEvents = insidePolygon(response.WEvents, polygon, func(e *WindEvent) (float64, float64) {
+		return e.Lat, e.Lon
+	})
+	response.TEvents = insidePolygon(response.TEvents, polygon, func(e *TornadoEvent) (float64, float64) {
+		return e.Lat, e.Lon
+	})
+	return paginateAll(response, page), nil
+}
+
+// EachStormNearby writes the events within the radius in the order of
+// sortBy, with their distance set. As with GetStormsNearby, every event in
+// the bounding box is read before the first one is written, since the order
+// is only known once their distances are.
+func (x *ModelsRepo) EachStormNearby(query NearbyQuery, sortBy string, fn func(Feature) error) error {
+	response, err := x.GetStormsNearby(query, Page{Sort: sortBy, Limit: math.MaxInt})
+	if err != nil {
+		return err
+	}
+	for _, feature := range response.features {
+		if err := fn(feature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *ModelsRepo) EachStormInPolygon(polygon MultiPolygon, filter StormFilter, fn func(Feature) error) error {
+	filter.Inside = polygon
+
+	return x.EachStorm(filter, func(feature Feature) error {
+		if !polygon.Contains(feature.Geometry.Coordinates[1], feature.Geometry.Coordinates[0]) {
+			return nil
+		}
+		return fn(feature)
+	})
+}
@@ -0,0 +1,74 @@
+package weather
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHaversineMi(t *testing.T) {
+	// Oklahoma City to Tulsa
+	assert.InDelta(t, 97.7, haversineMi(35.4676, -97.5164, 36.1540, -95.9928), 0.5)
+	assert.Equal(t, 0.0, haversineMi(35.4676, -97.5164, 35.4676, -97.5164))
+}
+
+func TestRadiusBoundingBox(t *testing.T) {
+	box := radiusBoundingBox(35.4676, -97.5164, 20)
+	assert.True(t, box.Contains(35.6528, -97.4781))
+	assert.False(t, box.Contains(36.1540, -95.9928))
+
+	// Boxes crossing the antimeridian or a pole cover every longitude.
+	assert.Equal(t, -180.0, radiusBoundingBox(51.9, 179.9, 50).MinLon)
+	assert.Equal(t, 180.0, radiusBoundingBox(89.9, 10, 50).MaxLon)
+}
+
+func TestParseNearbyQuery(t *testing.T) {
+	values, _ := url.ParseQuery("lat=35.4676&lon=-97.5164&radius_mi=20&start=2024-05-01&type=hail")
+	query, errs := ParseNearbyQuery(values)
+	assert.Nil(t, errs)
+	assert.Equal(t, 20.0, query.RadiusMi)
+	assert.Equal(t, "2024-05-01", query.Filter.StartDate)
+	assert.Equal(t, []string{Hail}, query.Filter.Types)
+
+	values, _ = url.ParseQuery("lat=95&radius_mi=500")
+	_, errs = ParseNearbyQuery(values)
+	assert.Equal(t, []string{
+		"lat must be a number from -90 to 90.",
+		"lon must be specified.",
+		"radius_mi must be greater than 0 and at most 250.",
+	}, errs)
+}
+
+func TestGetStormsNearby(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+
+	mock.ExpectQuery("FROM hail_events WHERE \\(lat BETWEEN \\? AND \\? AND lon BETWEEN \\? AND \\?\\)").
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("00000000000000000000000000000005", "2024-05-06 20:10:00", "2024-05-06", "175", 1.75, 44.5, "NORMAN", "CLEVELAND", "OK", 35.2226, -97.4395, "").
+			AddRow("00000000000000000000000000000006", "2024-05-06 21:00:00", "2024-05-06", "100", 1.0, 25.4, "EDMOND", "OKLAHOMA", "OK", 35.6528, -97.4781, "").
+			// Inside the bounding box but outside the radius.
+			AddRow("00000000000000000000000000000007", "2024-05-06 22:00:00", "2024-05-06", "125", 1.25, 31.8, "CHOCTAW", "OKLAHOMA", "OK", 35.7300, -97.2000, ""))
+	mock.ExpectQuery("FROM wind_events").WillReturnRows(sqlmock.NewRows(windColumns))
+	mock.ExpectQuery("FROM tornado_events").
+		WillReturnRows(sqlmock.NewRows(tornadoColumns).
+			AddRow("00000000000000000000000000000008", "2024-05-06 23:00:00", "2024-05-06", "EF1", 1, "EF", "MOORE", "CLEVELAND", "OK", 35.3395, -97.4867, ""))
+
+	response, err := repo.GetStormsNearby(NearbyQuery{Lat: 35.4676, Lon: -97.5164, RadiusMi: 20}, Page{Sort: SortDistance, Limit: 10, IncludeTotal: true})
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, 3, *response.TotalElements)
+	assert.Nil(t, response.NextCursor)
+	assert.Len(t, response.HEvents, 2)
+	assert.Equal(t, "EDMOND", response.HEvents[0].Location)
+	assert.Equal(t, "NORMAN", response.HEvents[1].Location)
+	assert.InDelta(t, 13.1, *response.HEvents[0].DistanceMi, 0.5)
+	assert.Empty(t, response.WEvents)
+	assert.Len(t, response.TEvents, 1)
+	assert.NotNil(t, response.TEvents[0].DistanceMi)
+}
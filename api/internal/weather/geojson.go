@@ -0,0 +1,150 @@
+package weather
+
+import (
+	"math"
+	"time"
+)
+
+const GeoJsonContentType = "application/geo+json"
+
+// featureStyle is a simplestyle-spec marker hint, the same for every
+// feature of a storm type so maps render them consistently.
+type featureStyle struct {
+	color  string
+	symbol string
+}
+
+var featureStyles = map[string]featureStyle{
+	Hail:    {color: "#1f78b4", symbol: "circle"},
+	Wind:    {color: "#33a02c", symbol: "wind"},
+	Tornado: {color: "#e31a1c", symbol: "danger"},
+}
+
+type PointGeometry struct {
+	Type string `json:"type"`
+	// Coordinates are lon, lat.
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FeatureProperties is the normalized view of an event of any type.
+// Magnitude is hail size in inches, wind speed in mph or tornado rating.
+type FeatureProperties struct {
+	StormType     string    `json:"storm_type"`
+	Self          string    `json:"self"`
+	Magnitude     *float64  `json:"magnitude"`
+	MagnitudeUnit string    `json:"magnitude_unit"`
+	EventTime     time.Time `json:"event_time"`
+	ConvectiveDay string    `json:"convective_day"`
+	Location      string    `json:"location"`
+	County        string    `json:"county"`
+	State         string    `json:"state"`
+	Comments      string    `json:"comments"`
+	DistanceMi    *float64  `json:"distance_mi,omitempty"`
+	MarkerColor   string    `json:"marker-color"`
+	MarkerSymbol  string    `json:"marker-symbol"`
+}
+
+type Feature struct {
+	Type       string            `json:"type"`
+	Id         string            `json:"id"`
+	Geometry   PointGeometry     `json:"geometry"`
+	Properties FeatureProperties `json:"properties"`
+}
+
+type FeatureCollection struct {
+	Type string `json:"type"`
+	// Bbox is minLon, minLat, maxLon, maxLat and is left out when there are
+	// no features.
+	Bbox     []float64 `json:"bbox,omitempty"`
+	Features []Feature `json:"features"`
+	// Foreign members carrying the pagination of ApiResponse.
+	TotalElements *int    `json:"total_elements,omitempty"`
+	NextCursor    *string `json:"next_cursor"`
+}
+
+func newFeature(stormType string, eventId string, lat float64, lon float64, properties FeatureProperties) Feature {
+	style := featureStyles[stormType]
+	properties.StormType = stormType
+	properties.Self = eventPath(stormType, eventId)
+	properties.MarkerColor = style.color
+	properties.MarkerSymbol = style.symbol
+	return Feature{
+		Type:       "Feature",
+		Id:         eventId,
+		Geometry:   PointGeometry{Type: "Point", Coordinates: [2]float64{lon, lat}},
+		Properties: properties,
+	}
+}
+
+func (e HailEvent) feature() Feature {
+	return newFeature(Hail, e.EventId, e.Lat, e.Lon, FeatureProperties{
+		Magnitude:     e.SizeIn,
+		MagnitudeUnit: "in",
+		EventTime:     e.EventTime,
+		ConvectiveDay: e.ConvectiveDay,
+		Location:      e.Location,
+		County:        e.County,
+		State:         e.State,
+		Comments:      e.Comments,
+		DistanceMi:    e.DistanceMi,
+	})
+}
+
+func (e WindEvent) feature() Feature {
+	return newFeature(Wind, e.EventId, e.Lat, e.Lon, FeatureProperties{
+		Magnitude:     e.SpeedMph,
+		MagnitudeUnit: "mph",
+		EventTime:     e.EventTime,
+		ConvectiveDay: e.ConvectiveDay,
+		Location:      e.Location,
+		County:        e.County,
+		State:         e.State,
+		Comments:      e.Comments,
+		DistanceMi:    e.DistanceMi,
+	})
+}
+
+func (e TornadoEvent) feature() Feature {
+	var magnitude *float64
+	if e.Rating != nil {
+		rating := float64(*e.Rating)
+		magnitude = &rating
+	}
+	return newFeature(Tornado, e.EventId, e.Lat, e.Lon, FeatureProperties{
+		Magnitude:     magnitude,
+		MagnitudeUnit: e.RatingScale,
+		EventTime:     e.EventTime,
+		ConvectiveDay: e.ConvectiveDay,
+		Location:      e.Location,
+		County:        e.County,
+		State:         e.State,
+		Comments:      e.Comments,
+		DistanceMi:    e.DistanceMi,
+	})
+}
+
+// FeatureCollection converts the response to GeoJSON, keeping the page order
+// of the events.
+func (r ApiResponse) FeatureCollection() FeatureCollection {
+	features := r.features
+	if features == nil {
+		features = []Feature{}
+	}
+
+	collection := FeatureCollection{
+		Type:          "FeatureCollection",
+		Features:      features,
+		TotalElements: r.TotalElements,
+		NextCursor:    r.NextCursor,
+	}
+	if len(features) > 0 {
+		bbox := []float64{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+		for _, feature := range features {
+			lon, lat := feature.Geometry.Coordinates[0], feature.Geometry.Coordinates[1]
+			bbox[0], bbox[1] = math.Min(bbox[0], lon), math.Min(bbox[1], lat)
+			bbox[2], bbox[3] = math.Max(bbox[2], lon), math.Max(bbox[3], lat)
+		}
+		collection.Bbox = bbox
+	}
+	return collection
+}
@@ -0,0 +1,94 @@
+package weather
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestFeatureCollection(t *testing.T) {
+	size := 1.75
+	rating := 2
+	near, far := 1.5, 4.0
+	events := ApiResponse{
+		HEvents: []HailEvent{
+			{EventId: "a", EventTime: time.Date(2024, 5, 6, 20, 10, 0, 0, time.UTC), SizeIn: &size, Location: "NORMAN", Lat: 35.22, Lon: -97.44, DistanceMi: &far},
+		},
+		TEvents: []TornadoEvent{
+			{EventId: "b", Rating: &rating, RatingScale: "EF", Location: "MOORE", Lat: 35.34, Lon: -97.49, DistanceMi: &near},
+		},
+	}
+
+	collection := paginateAll(events, Page{Sort: SortDistance, Limit: 10, IncludeTotal: true}).FeatureCollection()
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Equal(t, []float64{-97.49, 35.22, -97.44, 35.34}, collection.Bbox)
+	assert.Equal(t, 2, *collection.TotalElements)
+	assert.Len(t, collection.Features, 2)
+
+	tornado := collection.Features[0]
+	assert.Equal(t, [2]float64{-97.49, 35.34}, tornado.Geometry.Coordinates)
+	assert.Equal(t, Tornado, tornado.Properties.StormType)
+	assert.Equal(t, 2.0, *tornado.Properties.Magnitude)
+	assert.Equal(t, "EF", tornado.Properties.MagnitudeUnit)
+	assert.Equal(t, featureStyles[Tornado].color, tornado.Properties.MarkerColor)
+
+	hail := collection.Features[1]
+	assert.Equal(t, Hail, hail.Properties.StormType)
+	assert.Equal(t, 1.75, *hail.Properties.Magnitude)
+	assert.Equal(t, "in", hail.Properties.MagnitudeUnit)
+
+	empty := ApiResponse{}.FeatureCollection()
+	assert.Nil(t, empty.Bbox)
+	assert.NotNil(t, empty.Features)
+}
+
+type formatCase struct {
+	query               string
+	accept              string
+	expectedStatus      int
+	expectedContentType string
+}
+
+func TestResponseFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []formatCase{
+		{query: "date=2024-05-06&type=wind", expectedStatus: http.StatusOK, expectedContentType: "application/json; charset=utf-8"},
+		{query: "date=2024-05-06&type=wind&format=geojson", expectedStatus: http.StatusOK, expectedContentType: GeoJsonContentType},
+		{query: "date=2024-05-06&type=wind", accept: "application/geo+json", expectedStatus: http.StatusOK, expectedContentType: GeoJsonContentType},
+		{query: "date=2024-05-06&type=wind&format=kml", expectedStatus: http.StatusBadRequest, expectedContentType: "application/json; charset=utf-8"},
+	}
+	for _, tc := range testCases {
+		db, mock, err := sqlmock.New()
+		assert.Nil(t, err)
+		repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+		mock.ExpectQuery("FROM wind_events").
+			WillReturnRows(sqlmock.NewRows(windColumns).
+				AddRow("0000000000000000000000000000000b", "2024-05-06 20:10:00", "2024-05-06", "E60", 60.0, 52.1, true, false, "NORMAN", "CLEVELAND", "OK", 35.22, -97.44, ""))
+
+		router := gin.New()
+		NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+		request := httptest.NewRequest(http.MethodGet, "/storm?"+tc.query, nil)
+		if tc.accept != "" {
+			request.Header.Set("Accept", tc.accept)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+
+		assert.Equal(t, tc.expectedStatus, recorder.Code, tc.query)
+		assert.Equal(t, tc.expectedContentType, recorder.Header().Get("Content-Type"), tc.query)
+		if tc.expectedContentType == GeoJsonContentType {
+			var collection FeatureCollection
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &collection))
+			assert.Equal(t, Wind, collection.Features[0].Properties.StormType)
+			assert.Equal(t, 60.0, *collection.Features[0].Properties.Magnitude)
+		}
+		db.Close()
+	}
+}
@@ -0,0 +1,295 @@
+package weather
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+	"go.uber.org/zap"
+)
+
+// Response formats of the storm endpoints.
+const (
+	FormatJson    string = "json"
+	FormatGeoJson string = "geojson"
+	FormatCsv     string = "csv"
+	FormatNdjson  string = "ndjson"
+)
+
+// acceptFormats maps Accept header media types to formats.
+var acceptFormats = map[string]string{
+	"application/json": FormatJson,
+	GeoJsonContentType: FormatGeoJson,
+	"text/csv":         FormatCsv,
+	NdjsonContentType:  FormatNdjson,
+}
+
+// Handler serves the storm query endpoints.
+type Handler struct {
+	Repo   *ModelsRepo
+	Logger *zap.Logger
+}
+
+func NewHandler(repo *ModelsRepo, logger *zap.Logger) Handler {
+	return Handler{
+		Repo:   repo,
+		Logger: logger,
+	}
+}
+
+// RegisterRoutes adds the storm endpoints to router.
+func (h Handler) RegisterRoutes(router gin.IRouter) {
+	router.GET("/storm", h.GetStorms)
+	router.GET("/storm/nearby", h.GetStormsNearby)
+	router.GET("/storm/bbox", h.GetStormsInBox)
+	router.POST("/storm/polygon", h.GetStormsInPolygon)
+	router.GET("/storm/:type/:id", h.GetStorm)
+}
+
+// maxPolygonBytes bounds the size of a POST /storm/polygon body.
+const maxPolygonBytes = 1 << 20
+
+// badRequest responds with the documented {"errors": [...]} format.
+func badRequest(c *gin.Context, errs []string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"errors": errs,
+	})
+}
+
+// output is how a storm query is written back. Columns and Header only
+// apply to the streamed formats.
+type output struct {
+	Format  string
+	Columns []string
+	Header  bool
+}
+
+// parseOutput reads the format parameter, falling back to the Accept header,
+// along with the export columns and header. columns are the ones the
+// endpoint can export, all of them by default.
+func parseOutput(c *gin.Context, columns []string) (output, []string) {
+	var errs []string
+	out := output{Format: c.Query("format"), Columns: columns, Header: true}
+	switch out.Format {
+	case FormatJson, FormatGeoJson, FormatCsv, FormatNdjson:
+	case "":
+		out.Format = FormatJson
+		for _, mediaType := range strings.Split(c.GetHeader("Accept"), ",") {
+			mediaType, _, _ = strings.Cut(mediaType, ";")
+			if format, ok := acceptFormats[strings.TrimSpace(mediaType)]; ok {
+				out.Format = format
+				break
+			}
+		}
+	default:
+		errs = append(errs, "format must be json, geojson, csv or ndjson.")
+	}
+
+	if selected := multiValue(c.Request.URL.Query(), "columns"); len(selected) > 0 {
+		out.Columns = selected
+		for _, column := range selected {
+			if !slices.Contains(columns, column) {
+				errs = append(errs, "columns must be from "+strings.Join(columns, ", ")+".")
+				break
+			}
+		}
+	}
+	switch c.Query("header") {
+	case "", "true":
+	case "false":
+		out.Header = false
+	default:
+		errs = append(errs, "header must be true or false.")
+	}
+	return out, errs
+}
+
+// serve writes the storm query in the requested format. fetch loads a page of
+// the response for JSON and GeoJSON, each streams every event one at a time
+// for CSV and NDJSON.
+func (h Handler) serve(c *gin.Context, out output, fetch func() (ApiResponse, error), each func(func(Feature) error) error) {
+	if out.Format == FormatCsv || out.Format == FormatNdjson {
+		h.stream(c, out, each)
+		return
+	}
+
+	response, err := fetch()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Failure": err,
+		})
+		return
+	}
+	if out.Format == FormatGeoJson {
+		c.Header("Content-Type", GeoJsonContentType)
+		c.Render(http.StatusOK, render.JSON{Data: response.FeatureCollection()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// stream writes rows to the client as they are read from the database,
+// flushing every flushEvery rows. The status is sent with the first row, so
+// an error after that can only be reported in the ExportErrorTrailer.
+func (h Handler) stream(c *gin.Context, out output, each func(func(Feature) error) error) {
+	var writer featureWriter
+	start := func() {
+		c.Header("Trailer", ExportErrorTrailer)
+		if out.Format == FormatCsv {
+			c.Header("Content-Type", CsvContentType)
+			c.Header("Content-Disposition", `attachment; filename="storms.csv"`)
+			writer = newCsvFeatureWriter(c.Writer, out.Columns, out.Header)
+		} else {
+			c.Header("Content-Type", NdjsonContentType)
+			writer = newNdjsonFeatureWriter(c.Writer, out.Columns)
+		}
+		c.Status(http.StatusOK)
+	}
+
+	rows := 0
+	err := each(func(feature Feature) error {
+		if writer == nil {
+			start()
+		}
+		if err := writer.Write(feature); err != nil {
+			return err
+		}
+		if rows++; rows%flushEvery == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil && writer == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Failure": err,
+		})
+		return
+	}
+	if writer == nil {
+		start()
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		h.Logger.Warn("Export stopped.", zap.Int("rows", rows), zap.Error(err))
+		c.Writer.Header().Set(ExportErrorTrailer, err.Error())
+	}
+	c.Writer.Flush()
+}
+
+func (h Handler) GetStorms(c *gin.Context) {
+	filter, errs := ParseStormFilter(c.Request.URL.Query())
+	page, pageErrs := ParsePage(c.Request.URL.Query(), filter.Types, false)
+	errs = append(errs, pageErrs...)
+	out, outputErrs := parseOutput(c, defaultExportColumns)
+	errs = append(errs, outputErrs...)
+	if len(errs) > 0 {
+		badRequest(c, errs)
+		return
+	}
+
+	h.serve(c, out, func() (ApiResponse, error) {
+		return h.Repo.GetStorms(filter, page)
+	}, func(fn func(Feature) error) error {
+		return h.Repo.EachStorm(filter, fn)
+	})
+}
+
+func (h Handler) GetStormsNearby(c *gin.Context) {
+	query, errs := ParseNearbyQuery(c.Request.URL.Query())
+	page, pageErrs := ParsePage(c.Request.URL.Query(), query.Filter.Types, true)
+	errs = append(errs, pageErrs...)
+	out, outputErrs := parseOutput(c, nearbyExportColumns)
+	errs = append(errs, outputErrs...)
+	if len(errs) > 0 {
+		badRequest(c, errs)
+		return
+	}
+
+	h.serve(c, out, func() (ApiResponse, error) {
+		return h.Repo.GetStormsNearby(query, page)
+	}, func(fn func(Feature) error) error {
+		return h.Repo.EachStormNearby(query, page.Sort, fn)
+	})
+}
+
+func (h Handler) GetStormsInBox(c *gin.Context) {
+	filter, errs := ParseBoxFilter(c.Request.URL.Query())
+	page, pageErrs := ParsePage(c.Request.URL.Query(), filter.Types, false)
+	errs = append(errs, pageErrs...)
+	out, outputErrs := parseOutput(c, defaultExportColumns)
+	errs = append(errs, outputErrs...)
+	if len(errs) > 0 {
+		badRequest(c, errs)
+		return
+	}
+
+	h.serve(c, out, func() (ApiResponse, error) {
+		return h.Repo.GetStorms(filter, page)
+	}, func(fn func(Feature) error) error {
+		return h.Repo.EachStorm(filter, fn)
+	})
+}
+
+// GetStormsInPolygon reads a GeoJSON or WKT polygon from the request body and
+// the other filters from the query string.
+func (h Handler) GetStormsInPolygon(c *gin.Context) {
+	filter, errs := ParseSpatialFilter(c.Request.URL.Query())
+	page, pageErrs := ParsePage(c.Request.URL.Query(), filter.Types, false)
+	errs = append(errs, pageErrs...)
+	out, outputErrs := parseOutput(c, defaultExportColumns)
+	errs = append(errs, outputErrs...)
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPolygonBytes))
+	if err != nil {
+		errs = append(errs, "polygon body must be at most 1 MiB.")
+	}
+	var polygon MultiPolygon
+	if err == nil {
+		if polygon, err = ParsePolygon(body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		badRequest(c, errs)
+		return
+	}
+
+	h.serve(c, out, func() (ApiResponse, error) {
+		return h.Repo.GetStormsInPolygon(polygon, filter, page)
+	}, func(fn func(Feature) error) error {
+		return h.Repo.EachStormInPolygon(polygon, filter, fn)
+	})
+}
+
+// GetStorm responds with a single event, its ingestion metadata and links to
+// the events around it.
+func (h Handler) GetStorm(c *gin.Context) {
+	stormType := c.Param("type")
+	if stormType != Hail && stormType != Wind && stormType != Tornado {
+		badRequest(c, []string{"type must be hail, wind or tornado."})
+		return
+	}
+
+	detail, err := h.Repo.GetStorm(stormType, c.Param("id"))
+	if errors.Is(err, ErrStormNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"errors": []string{err.Error()},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"Failure": err,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
@@ -0,0 +1,73 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+
+	"weather-contract/telemetry"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthChecker serves the liveness and readiness of the process.
+type HealthChecker struct {
+	Consumer Consumer
+	Health   *telemetry.ConsumerHealth
+	Store    Store
+	Config   telemetry.HealthChecks
+}
+
+func NewHealthChecker(process Process, store Store, config telemetry.HealthChecks) HealthChecker {
+	return HealthChecker{
+		Consumer: process.Consumer,
+		Health:   process.Health,
+		Store:    store,
+		Config:   config,
+	}
+}
+
+// RegisterRoutes adds /healthz and /readyz to router.
+func (c HealthChecker) RegisterRoutes(router gin.IRouter) {
+	router.GET("/healthz", func(ctx *gin.Context) {
+		respondHealth(ctx, c.Live())
+	})
+	router.GET("/readyz", func(ctx *gin.Context) {
+		respondHealth(ctx, c.Ready(ctx.Request.Context()))
+	})
+}
+
+func respondHealth(c *gin.Context, report telemetry.HealthReport) {
+	status := http.StatusOK
+	if report.Status != telemetry.StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Live fails once the consumer loop has stopped polling, as when it is stuck
+// on a write that never returns.
+func (c HealthChecker) Live() telemetry.HealthReport {
+	return telemetry.NewHealthReport(map[string]telemetry.Check{"consumer": c.Health.CheckPoll(c.Config.MaxPollInterval)})
+}
+
+// Ready checks the brokers, the partition assignment, the database and how
+// long messages have been waiting to be processed.
+func (c HealthChecker) Ready(ctx context.Context) telemetry.HealthReport {
+	checks := map[string]telemetry.Check{
+		"assignment":   telemetry.CheckAssignment(c.Consumer, c.Config.RequireAssignment),
+		"last_message": c.Health.CheckLastMessage(c.Config.MaxMessageAge),
+	}
+	if metadata, ok := c.Consumer.(telemetry.MetadataReader); ok {
+		checks["kafka"] = telemetry.CheckBrokers(metadata, c.Config.Timeout)
+	}
+	if c.Store != nil {
+		ctx, cancel := context.WithTimeout(ctx, c.Config.Timeout)
+		defer cancel()
+		if err := c.Store.Ping(ctx); err != nil {
+			checks["database"] = telemetry.Failed("", err)
+		} else {
+			checks["database"] = telemetry.Passed("")
+		}
+	}
+	return telemetry.NewHealthReport(checks)
+}
@@ -0,0 +1,84 @@
+package weather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"weather-contract/telemetry"
+	"weather-contract/telemetry/telemetrytest"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// brokenConsumer reaches no broker and has no partitions.
+type brokenConsumer struct {
+	*MemoryConsumer
+}
+
+func (brokenConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return nil, kafka.NewError(kafka.ErrTransport, "Broker transport failure", false)
+}
+
+func (brokenConsumer) Assignment() ([]kafka.TopicPartition, error) {
+	return nil, nil
+}
+
+// unreachableStore fails to ping its database.
+type unreachableStore struct {
+	*MemoryStore
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("dial tcp 127.0.0.1:3306: connect: connection refused")
+}
+
+type healthCase struct {
+	consumer       Consumer
+	store          Store
+	expectedStatus int
+	expectedFailed []string
+}
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	testCases := []healthCase{
+		{consumer: NewMemoryConsumer("transformed-weather-data"), store: NewMemoryStore(), expectedStatus: http.StatusOK},
+		{consumer: brokenConsumer{NewMemoryConsumer("transformed-weather-data")}, store: unreachableStore{NewMemoryStore()},
+			expectedStatus: http.StatusServiceUnavailable, expectedFailed: []string{"assignment", "database", "kafka"}},
+	}
+	for _, tc := range testCases {
+		process := NewProcess(tc.consumer, NewModelsRepo(tc.store), Kakfa{}, zap.NewNop())
+		router := gin.New()
+		NewHealthChecker(process, tc.store, telemetrytest.HealthChecks()).RegisterRoutes(router)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, tc.expectedStatus, recorder.Code)
+
+		var report telemetry.HealthReport
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		assert.Len(t, report.Checks, 4)
+		var failedChecks []string
+		for _, name := range []string{"assignment", "database", "kafka", "last_message"} {
+			if report.Checks[name].Status == telemetry.StatusFail {
+				failedChecks = append(failedChecks, name)
+				assert.NotEmpty(t, report.Checks[name].Error)
+			}
+		}
+		assert.Equal(t, tc.expectedFailed, failedChecks)
+	}
+}
+
+func TestLive(t *testing.T) {
+	process := NewProcess(NewMemoryConsumer("transformed-weather-data"), NewModelsRepo(NewMemoryStore()), Kakfa{}, zap.NewNop())
+	checker := NewHealthChecker(process, process.MRepo.Store, telemetrytest.HealthChecks())
+	report := checker.Live()
+	assert.Equal(t, telemetry.StatusOk, report.Status)
+	assert.Equal(t, telemetry.StatusOk, report.Checks["consumer"].Status)
+}
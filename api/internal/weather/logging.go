@@ -0,0 +1,7 @@
+package weather
+
+import "go.uber.org/zap"
+
+func (k eventKey) logFields() []zap.Field {
+	return []zap.Field{zap.String("storm_type", k.stormType), zap.String("event_id", k.eventId)}
+}
@@ -0,0 +1,383 @@
+package weather
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// MemoryConsumer is a Consumer of a single partition held in memory, so the
+// process can run in tests without a broker.
+type MemoryConsumer struct {
+	topic    string
+	mu       sync.Mutex
+	messages []*kafka.Message
+	next     int
+	// committed is the offset after the last committed message.
+	committed kafka.Offset
+	added     chan struct{}
+	closed    bool
+	paused    bool
+}
+
+func NewMemoryConsumer(topic string) *MemoryConsumer {
+	return &MemoryConsumer{topic: topic, committed: kafka.OffsetInvalid, added: make(chan struct{}, 1)}
+}
+
+// Add appends a message to the partition.
+func (c *MemoryConsumer) Add(key []byte, value []byte, headers ...kafka.Header) {
+	c.mu.Lock()
+	c.messages = append(c.messages, &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &c.topic,
+			Partition: 0,
+			Offset:    kafka.Offset(len(c.messages)),
+		},
+		Key:       key,
+		Value:     value,
+		Headers:   headers,
+		Timestamp: time.Now(),
+	})
+	c.mu.Unlock()
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+}
+
+// ReadMessage returns the next message, waiting up to timeout for one to be
+// added like a broker would. A paused partition returns none.
+func (c *MemoryConsumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, kafka.NewError(kafka.ErrState, "Consumer is closed", true)
+		}
+		if !c.paused && c.next < len(c.messages) {
+			msg := c.messages[c.next]
+			c.next++
+			c.mu.Unlock()
+			return msg, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.added:
+		case <-deadline:
+			return nil, kafka.NewError(kafka.ErrTimedOut, "Timed out", false)
+		}
+	}
+}
+
+// GetWatermarkOffsets returns the bounds of the partition, the high one
+// being the offset the next added message will get.
+func (c *MemoryConsumer) GetWatermarkOffsets(topic string, partition int32) (int64, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic != c.topic || partition != 0 {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownPartition, "Unknown partition", false)
+	}
+	return 0, int64(len(c.messages)), nil
+}
+
+// GetMetadata describes a single broker holding the topic.
+func (c *MemoryConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return &kafka.Metadata{
+		Brokers: []kafka.BrokerMetadata{{ID: 0, Host: "memory"}},
+		Topics: map[string]kafka.TopicMetadata{
+			c.topic: {Topic: c.topic, Partitions: []kafka.PartitionMetadata{{ID: 0}}},
+		},
+	}, nil
+}
+
+// Read is how many messages have been read.
+func (c *MemoryConsumer) Read() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.next
+}
+
+func (c *MemoryConsumer) CommitOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tp := range offsets {
+		if *tp.Topic == c.topic && tp.Partition == 0 {
+			c.committed = tp.Offset
+		}
+	}
+	return offsets, nil
+}
+
+// Assignment is the single partition of the topic.
+func (c *MemoryConsumer) Assignment() ([]kafka.TopicPartition, error) {
+	return []kafka.TopicPartition{{Topic: &c.topic, Partition: 0}}, nil
+}
+
+func (c *MemoryConsumer) Pause(partitions []kafka.TopicPartition) error {
+	c.setPaused(partitions, true)
+	return nil
+}
+
+func (c *MemoryConsumer) Resume(partitions []kafka.TopicPartition) error {
+	c.setPaused(partitions, false)
+	return nil
+}
+
+func (c *MemoryConsumer) setPaused(partitions []kafka.TopicPartition, paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, tp := range partitions {
+		if *tp.Topic == c.topic && tp.Partition == 0 {
+			c.paused = paused
+		}
+	}
+}
+
+// Paused reports whether the partition is paused.
+func (c *MemoryConsumer) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// CommittedOffset is the offset a restarted consumer would resume from,
+// kafka.OffsetInvalid before the first commit.
+func (c *MemoryConsumer) CommittedOffset() kafka.Offset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committed
+}
+
+func (c *MemoryConsumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// MemoryStore is a Store that keeps events in maps keyed by event ID. It
+// filters, orders and pages them in Go the way the SQL backends do.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	hail    map[string]HailEvent
+	wind    map[string]WindEvent
+	tornado map[string]TornadoEvent
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		hail:    make(map[string]HailEvent),
+		wind:    make(map[string]WindEvent),
+		tornado: make(map[string]TornadoEvent),
+	}
+}
+
+func (s *MemoryStore) SaveHail(event HailEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.DistanceMi = nil
+	event.EventTime = event.EventTime.UTC()
+	s.hail[event.EventId] = event
+	return nil
+}
+
+func (s *MemoryStore) SaveWind(event WindEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.DistanceMi = nil
+	event.EventTime = event.EventTime.UTC()
+	s.wind[event.EventId] = event
+	return nil
+}
+
+func (s *MemoryStore) SaveTornado(event TornadoEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	event.DistanceMi = nil
+	event.EventTime = event.EventTime.UTC()
+	s.tornado[event.EventId] = event
+	return nil
+}
+
+// matches applies filter to the feature of an event like StormFilter.apply
+// and the per table magnitude conditions do in SQL.
+func (f StormFilter) matches(feature Feature) bool {
+	p := feature.Properties
+	lon, lat := feature.Geometry.Coordinates[0], feature.Geometry.Coordinates[1]
+	day := p.EventTime.UTC().Format(dateFormat)
+	if f.DateType == DateTypeConvective {
+		day = p.ConvectiveDay
+	}
+	if f.Date != "" && day != f.Date {
+		return false
+	}
+	if (f.StartDate != "" && day < f.StartDate) || (f.EndDate != "" && day > f.EndDate) {
+		return false
+	}
+	if (f.Location != "" && p.Location != f.Location) || (f.County != "" && p.County != f.County) {
+		return false
+	}
+	if len(f.States) > 0 && !containsString(f.States, p.State) {
+		return false
+	}
+	if f.Bounds != nil && !f.Bounds.Contains(lat, lon) {
+		return false
+	}
+	if f.Near != nil && haversineMi(f.Near.Lat, f.Near.Lon, lat, lon) > f.Near.RadiusMi {
+		return false
+	}
+	if f.Inside != nil && !f.Inside.Contains(lat, lon) {
+		return false
+	}
+	if f.EventId != "" && feature.Id != f.EventId {
+		return false
+	}
+
+	// Like NULL in SQL, an unknown magnitude never passes a bound.
+	var min, max *float64
+	switch p.StormType {
+	case Hail:
+		min, max = f.MinSize, f.MaxSize
+	case Wind:
+		min = f.MinSpeed
+	case Tornado:
+		if f.MinRating != nil {
+			rating := float64(*f.MinRating)
+			min = &rating
+		}
+	}
+	if min != nil && (p.Magnitude == nil || *p.Magnitude < *min) {
+		return false
+	}
+	if max != nil && (p.Magnitude == nil || *p.Magnitude > *max) {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// eachMemory calls fn with the events of stormType matching filter. A page
+// is cut after its cursor in the order Page.apply gives the SQL query.
+func eachMemory[E any](s *MemoryStore, events map[string]E, stormType string, filter StormFilter, page *Page, feature func(E) Feature, fn func(E) error) error {
+	type keyed struct {
+		key   Cursor
+		event E
+	}
+	sortBy := SortTime
+	if page != nil && page.Sort == SortMagnitude {
+		sortBy = SortMagnitude
+	}
+	s.mu.RLock()
+	var matched []keyed
+	for id, event := range events {
+		f := feature(event)
+		if !filter.matches(f) {
+			continue
+		}
+		key := newCursor(sortBy, stormType, f, id)
+		if page != nil && page.Cursor != nil && !page.Cursor.less(key) {
+			continue
+		}
+		matched = append(matched, keyed{key: key, event: event})
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		return matched[i].key.less(matched[j].key)
+	})
+	if page != nil && len(matched) > page.Limit+1 {
+		matched = matched[:page.Limit+1]
+	}
+	for _, m := range matched {
+		if err := fn(m.event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) EachHail(filter StormFilter, page *Page, fn func(HailEvent) error) error {
+	return eachMemory(s, s.hail, Hail, filter, page, HailEvent.feature, func(e HailEvent) error {
+		e.Self = eventPath(Hail, e.EventId)
+		e.Ingestion = nil
+		return fn(e)
+	})
+}
+
+func (s *MemoryStore) EachWind(filter StormFilter, page *Page, fn func(WindEvent) error) error {
+	return eachMemory(s, s.wind, Wind, filter, page, WindEvent.feature, func(e WindEvent) error {
+		e.Self = eventPath(Wind, e.EventId)
+		e.Ingestion = nil
+		return fn(e)
+	})
+}
+
+func (s *MemoryStore) EachTornado(filter StormFilter, page *Page, fn func(TornadoEvent) error) error {
+	return eachMemory(s, s.tornado, Tornado, filter, page, TornadoEvent.feature, func(e TornadoEvent) error {
+		e.Self = eventPath(Tornado, e.EventId)
+		e.Ingestion = nil
+		return fn(e)
+	})
+}
+
+func (s *MemoryStore) Count(stormType string, filter StormFilter) (int, error) {
+	count := 0
+	switch stormType {
+	case Hail:
+		eachMemory(s, s.hail, Hail, filter, nil, HailEvent.feature, func(HailEvent) error { count++; return nil })
+	case Wind:
+		eachMemory(s, s.wind, Wind, filter, nil, WindEvent.feature, func(WindEvent) error { count++; return nil })
+	case Tornado:
+		eachMemory(s, s.tornado, Tornado, filter, nil, TornadoEvent.feature, func(TornadoEvent) error { count++; return nil })
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) Ingestion(stormType string, eventId string) (Ingestion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var ingestion *Ingestion
+	var ok bool
+	switch stormType {
+	case Hail:
+		var e HailEvent
+		e, ok = s.hail[eventId]
+		ingestion = e.Ingestion
+	case Wind:
+		var e WindEvent
+		e, ok = s.wind[eventId]
+		ingestion = e.Ingestion
+	case Tornado:
+		var e TornadoEvent
+		e, ok = s.tornado[eventId]
+		ingestion = e.Ingestion
+	}
+	if !ok {
+		return Ingestion{}, sql.ErrNoRows
+	}
+	if ingestion == nil {
+		return Ingestion{}, nil
+	}
+	return *ingestion, nil
+}
+
+func (s *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *MemoryStore) Close(timeout time.Duration) error {
+	return nil
+}
@@ -0,0 +1,101 @@
+package weather
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProcessMemory(t *testing.T) {
+	consumer := NewMemoryConsumer("transformed-weather-data")
+	repo := NewModelsRepo(NewMemoryStore())
+	process := NewProcess(consumer, repo, Kakfa{BatchSize: 10, FlushInterval: 20 * time.Millisecond}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+
+	consumer.Add([]byte("bad"), []byte(`not json`))
+	consumer.Add([]byte("h1"), []byte(`{"schema_version": 1, "event_id": "h1", "type": "hail", "source": "spc", "emitted_at": "2024-05-07T00:00:00Z", "event_time": "2024-05-06T20:10:00Z",
+		"convective_day": "2024-05-06", "payload": {"size": "175", "size_in": 1.75, "location": "NORMAN", "state": "OK", "lat": 35.22, "lon": -97.44}}`))
+	// The wind report predates the envelope.
+	consumer.Add([]byte("w1"), []byte(`{"StormType": "wind", "Source": "spc", "Time": 1715047800, "ConvectiveDay": "2024-05-06", "Speed": "E60", "SpeedMph": 60, "SpeedEstimated": true, "Location": "MOORE", "State": "OK", "Lat": 35.34, "Lon": -97.49}`))
+	assert.Eventually(t, func() bool {
+		count, _ := repo.countStorms(StormFilter{})
+		return count == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.Nil(t, <-done)
+
+	response, err := repo.GetStorms(StormFilter{Date: "2024-05-06", DateType: DateTypeConvective}, Page{Sort: SortTime, Limit: 10})
+	assert.Nil(t, err)
+	assert.Equal(t, "/storm/hail/h1", response.HEvents[0].Self)
+	assert.Equal(t, time.Date(2024, 5, 7, 2, 10, 0, 0, time.UTC), response.WEvents[0].EventTime)
+
+	detail, err := repo.GetStorm(Hail, "h1")
+	assert.Nil(t, err)
+	assert.Equal(t, "transformed-weather-data", detail.Ingestion.KafkaTopic)
+	assert.Equal(t, int64(1), *detail.Ingestion.KafkaOffset)
+	assert.Equal(t, time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC), *detail.Ingestion.EmittedAt)
+}
+
+// TestMemoryStoreMatchesSqlite runs the same listings against the memory
+// store and a SQLite database holding the same events.
+func TestMemoryStoreMatchesSqlite(t *testing.T) {
+	memory := NewModelsRepo(NewMemoryStore())
+	sqlite := sqliteRepo(t)
+	start := time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 12; i++ {
+		eventTime := start.Add(time.Duration(i%5) * time.Hour)
+		var size *float64
+		if i%4 != 0 {
+			inches := float64(i%3) + 0.75
+			size = &inches
+		}
+		events := []WeatherDbEvent{
+			HailEvent{EventId: fmt.Sprintf("h%02d", i), EventTime: eventTime, ConvectiveDay: convectiveDay("", eventTime),
+				SizeIn: size, State: []string{"OK", "KS"}[i%2], Lat: 35 + float64(i)/10, Lon: -97},
+			WindEvent{EventId: fmt.Sprintf("w%02d", i), EventTime: eventTime, ConvectiveDay: convectiveDay("", eventTime),
+				SpeedMph: size, State: "TX", Lat: 33, Lon: -97 + float64(i)/10},
+		}
+		for _, event := range events {
+			assert.Nil(t, event.Save(memory.Store))
+			assert.Nil(t, event.Save(sqlite.Store))
+		}
+	}
+
+	minSize := 1.0
+	filters := []StormFilter{
+		{},
+		{Date: "2024-05-06", States: []string{"OK"}},
+		{StartDate: "2024-05-05", EndDate: "2024-05-06", DateType: DateTypeConvective, Types: []string{Hail}, MinSize: &minSize},
+		{Bounds: &BoundingBox{MinLat: 32, MinLon: -97, MaxLat: 36, MaxLon: -96.5}},
+	}
+	for _, filter := range filters {
+		for _, sortBy := range []string{SortTime, SortMagnitude} {
+			if sortBy == SortMagnitude {
+				filter.Types = []string{Hail}
+			}
+			page := Page{Sort: sortBy, Limit: 5, IncludeTotal: true}
+			for {
+				expected, err := sqlite.GetStorms(filter, page)
+				assert.Nil(t, err)
+				actual, err := memory.GetStorms(filter, page)
+				assert.Nil(t, err)
+				assert.Equal(t, expected.HEvents, actual.HEvents, "%+v %s", filter, sortBy)
+				assert.Equal(t, expected.WEvents, actual.WEvents, "%+v %s", filter, sortBy)
+				assert.Equal(t, *expected.TotalElements, *actual.TotalElements)
+				assert.Equal(t, expected.NextCursor, actual.NextCursor)
+				if expected.NextCursor == nil {
+					break
+				}
+				page.Cursor, _ = decodeCursor(*expected.NextCursor)
+			}
+		}
+	}
+}
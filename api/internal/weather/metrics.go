@@ -0,0 +1,100 @@
+package weather
+
+import (
+	"strconv"
+	"time"
+
+	"weather-contract/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Reasons a consumed message or event is not saved.
+const (
+	ReasonDecode    string = "decode"
+	ReasonSave      string = "save"
+	ReasonTransient string = "transient"
+)
+
+var (
+	consumerMetrics = telemetry.NewConsumerMetrics("weather_api", "Transformed reports read from the consumer topic.")
+	eventsSaved     = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_api_events_saved_total",
+		Help: "Events written to the database, by storm type.",
+	}, []string{"storm_type"})
+	consumeFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_api_consume_failures_total",
+		Help: "Messages skipped and writes retried, by reason.",
+	}, []string{"reason"})
+	consumerPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "weather_api_consumer_paused",
+		Help: "1 while consumption is paused on a database outage.",
+	})
+	persistLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "weather_api_emit_to_persisted_seconds",
+		Help:    "Time from the collector emitting a report to its event being saved.",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300, 900},
+	}, []string{"storm_type"})
+	batchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "weather_api_batch_size",
+		Help:    "Events per batch written.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 11),
+	})
+	batchInsert = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "weather_api_batch_insert_seconds",
+		Help:    "Time taken to write a batch.",
+		Buckets: prometheus.DefBuckets,
+	})
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_api_http_requests_total",
+		Help: "HTTP requests served, by route and status.",
+	}, []string{"method", "route", "status"})
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "weather_api_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// recordSaved counts the events of a written batch and how long after being
+// emitted each was saved.
+func recordSaved(batch Batch, savedAt time.Time) {
+	observe := func(stormType string, ingestion *Ingestion) {
+		eventsSaved.WithLabelValues(stormType).Inc()
+		if ingestion != nil && ingestion.EmittedAt != nil {
+			persistLatency.WithLabelValues(stormType).Observe(savedAt.Sub(*ingestion.EmittedAt).Seconds())
+		}
+	}
+	for _, e := range batch.Hail {
+		observe(Hail, e.Ingestion)
+	}
+	for _, e := range batch.Wind {
+		observe(Wind, e.Ingestion)
+	}
+	for _, e := range batch.Tornado {
+		observe(Tornado, e.Ingestion)
+	}
+}
+
+// HttpMetrics times every request by its route pattern, so that the IDs in
+// paths don't each get a series.
+func HttpMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RegisterMetrics serves the metrics of the process on /metrics.
+func RegisterMetrics(router gin.IRouter) {
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
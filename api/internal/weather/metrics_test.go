@@ -0,0 +1,67 @@
+package weather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"weather-contract/telemetry/telemetrytest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestConsumerMetrics(t *testing.T) {
+	// The metrics are shared by every test, so only their increase is checked.
+	consumed := testutil.ToFloat64(consumerMetrics.Consumed)
+	saved := testutil.ToFloat64(eventsSaved.WithLabelValues(Hail))
+	decodeFailures := testutil.ToFloat64(consumeFailures.WithLabelValues(ReasonDecode))
+	timed := telemetrytest.SampleCount(t, persistLatency.WithLabelValues(Hail))
+
+	consumer := NewMemoryConsumer("transformed-weather-data")
+	process := NewProcess(consumer, NewModelsRepo(NewMemoryStore()), Kakfa{BatchSize: 10, FlushInterval: time.Millisecond}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+	consumer.Add([]byte("bad"), []byte(`not json`))
+	consumer.Add([]byte("h1"), []byte(`{"StormType": "hail", "EmitTs": 1715040000000, "Time": 1715026200, "Size": "175", "Lat": 35.22, "Lon": -97.44}`))
+	assert.Eventually(t, func() bool { return consumer.CommittedOffset() == 2 }, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.Nil(t, <-done)
+
+	assert.Equal(t, consumed+2, testutil.ToFloat64(consumerMetrics.Consumed))
+	assert.Equal(t, saved+1, testutil.ToFloat64(eventsSaved.WithLabelValues(Hail)))
+	assert.Equal(t, decodeFailures+1, testutil.ToFloat64(consumeFailures.WithLabelValues(ReasonDecode)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(consumerMetrics.Lag.WithLabelValues("transformed-weather-data", "0")))
+	assert.Equal(t, timed+1, telemetrytest.SampleCount(t, persistLatency.WithLabelValues(Hail)))
+}
+
+func TestHttpMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := NewModelsRepo(NewMemoryStore())
+	router := gin.New()
+	router.Use(HttpMetrics())
+	RegisterMetrics(router)
+	NewHandler(&repo, zap.NewNop()).RegisterRoutes(router)
+	notFound := httpRequests.WithLabelValues(http.MethodGet, "/storm/:type/:id", "404")
+	before := testutil.ToFloat64(notFound)
+
+	for _, id := range []string{"h1", "h2"} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/storm/hail/"+id, nil))
+		assert.Equal(t, http.StatusNotFound, recorder.Code)
+	}
+	// Both paths are counted under their route.
+	assert.Equal(t, before+2, testutil.ToFloat64(notFound))
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `weather_api_http_requests_total{method="GET",route="/storm/:type/:id",status="404"}`)
+}
@@ -7,254 +7,294 @@ import (
 )
 
 type WeatherDbEvent interface {
-	Save(dbRepo *MysqlRepository) error
+	Save(store Store) error
+	// addTo queues the event in a batch.
+	addTo(batch *Batch)
+	// key identifies the event in logs and traces.
+	key() eventKey
+}
+
+type eventKey struct {
+	stormType string
+	eventId   string
+}
+
+// upsertRows inserts rows of the event columns and ingestionColumns into
+// table. It upserts on event_id so a re-sent report never creates a second
+// row.
+func upsertRows(d dialect, table string, columns []string, rows ...[]interface{}) sq.InsertBuilder {
+	columns = append(append([]string{}, columns...), ingestionColumns...)
+	insert := sq.Insert(table).Columns(columns...).Suffix(d.upsert(columns[1:]...))
+	for _, row := range rows {
+		insert = insert.Values(row...)
+	}
+	return insert
 }
 
 type WindEvent struct {
 	EventTime time.Time `json:"event_time"`
 	Speed     string    `json:"speed"`
-	Location  string    `json:"location"`
-	County    string    `json:"county"`
-	State     string    `json:"state"`
-	Lat       float64   `json:"lat"`
-	Lon       float64   `json:"lon"`
-	Comments  string    `json:"comments"`
+	// SpeedMph and SpeedKts are nil when SpeedUnknown is set.
+	SpeedMph       *float64 `json:"speed_mph"`
+	SpeedKts       *float64 `json:"speed_kts"`
+	SpeedEstimated bool     `json:"speed_estimated"`
+	SpeedUnknown   bool     `json:"speed_unknown"`
+	Location       string   `json:"location"`
+	County         string   `json:"county"`
+	State          string   `json:"state"`
+	Lat            float64  `json:"lat"`
+	Lon            float64  `json:"lon"`
+	Comments       string   `json:"comments"`
+	DistanceMi     *float64 `json:"distance_mi,omitempty"`
+	EventId        string   `json:"id"`
+	// Self is the path of the event at GET /storm/{type}/{id}.
+	Self string `json:"self"`
+	// ConvectiveDay is the 12Z-12Z SPC report day as YYYY-MM-DD.
+	ConvectiveDay string `json:"convective_day"`
+	// Ingestion is only read for a single event and set when saving.
+	Ingestion *Ingestion `json:"-"`
 }
 
-func (w WindEvent) Save(dbRepo *MysqlRepository) error {
-	sqlQuery := sq.Insert("wind_events").Columns("event_time", "speed", "location", "county", "state", "lat", "lon", "comments").
-		Values(w.EventTime, w.Speed, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments)
-	stm, args, err := sqlQuery.ToSql()
-	if err != nil {
-		return err
-	}
-	_, err = dbRepo.DB.Exec(stm, args...)
-	return err
+// windColumns, tornadoColumns and hailColumns are the columns of each table
+// read back for an event. Writes add ingestionColumns.
+var windColumns = []string{"event_id", "event_time", "convective_day", "speed", "speed_mph", "speed_kts", "speed_estimated", "speed_unknown", "location", "county", "state", "lat", "lon", "comments"}
+
+func (w WindEvent) values() []interface{} {
+	return append([]interface{}{w.EventId, w.EventTime, w.ConvectiveDay, w.Speed, w.SpeedMph, w.SpeedKts, w.SpeedEstimated, w.SpeedUnknown, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments}, w.Ingestion.values()...)
+}
+
+func (w WindEvent) insert(d dialect) sq.InsertBuilder {
+	return upsertRows(d, "wind_events", windColumns, w.values())
+}
+
+func (w WindEvent) Save(store Store) error {
+	return store.SaveWind(w)
+}
+
+func (w WindEvent) addTo(batch *Batch) {
+	batch.Wind = append(batch.Wind, w)
+}
+
+func (w WindEvent) key() eventKey {
+	return eventKey{stormType: "wind", eventId: w.EventId}
 }
 
 type TornadoEvent struct {
 	EventTime time.Time `json:"event_time"`
 	FScale    string    `json:"f_scale"`
-	Location  string    `json:"location"`
-	County    string    `json:"county"`
-	State     string    `json:"state"`
-	Lat       float64   `json:"lat"`
-	Lon       float64   `json:"lon"`
-	Comments  string    `json:"comments"`
+	// Rating is nil for unrated tornadoes, RatingScale is EF or F.
+	Rating        *int       `json:"rating"`
+	RatingScale   string     `json:"rating_scale"`
+	Location      string     `json:"location"`
+	County        string     `json:"county"`
+	State         string     `json:"state"`
+	Lat           float64    `json:"lat"`
+	Lon           float64    `json:"lon"`
+	Comments      string     `json:"comments"`
+	DistanceMi    *float64   `json:"distance_mi,omitempty"`
+	EventId       string     `json:"id"`
+	Self          string     `json:"self"`
+	ConvectiveDay string     `json:"convective_day"`
+	Ingestion     *Ingestion `json:"-"`
 }
 
-func (w TornadoEvent) Save(dbRepo *MysqlRepository) error {
+var tornadoColumns = []string{"event_id", "event_time", "convective_day", "f_scale", "rating", "rating_scale", "location", "county", "state", "lat", "lon", "comments"}
 
-	sqlQuery := sq.Insert("tornado_events").Columns("event_time", "f_scale", "location", "county", "state", "lat", "lon", "comments").
-		Values(w.EventTime, w.FScale, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments)
-	stm, args, err := sqlQuery.ToSql()
-	if err != nil {
-		return err
-	}
-	_, err = dbRepo.DB.Exec(stm, args...)
-	return err
+func (w TornadoEvent) values() []interface{} {
+	return append([]interface{}{w.EventId, w.EventTime, w.ConvectiveDay, w.FScale, w.Rating, w.RatingScale, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments}, w.Ingestion.values()...)
+}
+
+func (w TornadoEvent) insert(d dialect) sq.InsertBuilder {
+	return upsertRows(d, "tornado_events", tornadoColumns, w.values())
+}
+
+func (w TornadoEvent) Save(store Store) error {
+	return store.SaveTornado(w)
+}
+
+func (w TornadoEvent) addTo(batch *Batch) {
+	batch.Tornado = append(batch.Tornado, w)
+}
+
+func (w TornadoEvent) key() eventKey {
+	return eventKey{stormType: "tornado", eventId: w.EventId}
 }
 
 type HailEvent struct {
 	EventTime time.Time `json:"event_time"`
 	Size      string    `json:"size"`
-	Location  string    `json:"location"`
-	County    string    `json:"county"`
-	State     string    `json:"state"`
-	Lat       float64   `json:"lat"`
-	Lon       float64   `json:"lon"`
-	Comments  string    `json:"comments"`
+	// SizeIn and SizeMm are nil when the size is unknown.
+	SizeIn        *float64   `json:"size_in"`
+	SizeMm        *float64   `json:"size_mm"`
+	Location      string     `json:"location"`
+	County        string     `json:"county"`
+	State         string     `json:"state"`
+	Lat           float64    `json:"lat"`
+	Lon           float64    `json:"lon"`
+	Comments      string     `json:"comments"`
+	DistanceMi    *float64   `json:"distance_mi,omitempty"`
+	EventId       string     `json:"id"`
+	Self          string     `json:"self"`
+	ConvectiveDay string     `json:"convective_day"`
+	Ingestion     *Ingestion `json:"-"`
 }
 
-func (w HailEvent) Save(dbRepo *MysqlRepository) error {
-	sqlQuery := sq.Insert("hail_events").Columns("event_time", "size", "location", "county", "state", "lat", "lon", "comments").
-		Values(w.EventTime, w.Size, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments)
-	stm, args, err := sqlQuery.ToSql()
-	if err != nil {
-		return err
-	}
-	_, err = dbRepo.DB.Exec(stm, args...)
-	return err
+var hailColumns = []string{"event_id", "event_time", "convective_day", "size", "size_in", "size_mm", "location", "county", "state", "lat", "lon", "comments"}
+
+func (w HailEvent) values() []interface{} {
+	return append([]interface{}{w.EventId, w.EventTime, w.ConvectiveDay, w.Size, w.SizeIn, w.SizeMm, w.Location, w.County, w.State, w.Lat, w.Lon, w.Comments}, w.Ingestion.values()...)
+}
+
+func (w HailEvent) insert(d dialect) sq.InsertBuilder {
+	return upsertRows(d, "hail_events", hailColumns, w.values())
+}
+
+func (w HailEvent) Save(store Store) error {
+	return store.SaveHail(w)
+}
+
+func (w HailEvent) addTo(batch *Batch) {
+	batch.Hail = append(batch.Hail, w)
+}
+
+func (w HailEvent) key() eventKey {
+	return eventKey{stormType: "hail", eventId: w.EventId}
 }
 
 type ApiResponse struct {
-	TotalElements int            `json:"total_elements"`
+	// TotalElements counts every matching event, not just this page, and is
+	// only set when asked for.
+	TotalElements *int           `json:"total_elements,omitempty"`
 	HEvents       []HailEvent    `json:"hail_events"`
 	TEvents       []TornadoEvent `json:"tornado_events"`
 	WEvents       []WindEvent    `json:"wind_events"`
+	NextCursor    *string        `json:"next_cursor"`
+	// features holds the events of every type in page order.
+	features []Feature
 }
 
 type ModelsRepo struct {
-	DbRepo *MysqlRepository
+	Store Store
 }
 
-func NewModelsRepo(db *MysqlRepository) ModelsRepo {
+func NewModelsRepo(store Store) ModelsRepo {
 	return ModelsRepo{
-		DbRepo: db,
+		Store: store,
 	}
 }
 
-func (m ModelsRepo) fetchHailStorms(location string, date string) ([]HailEvent, error) {
-	sql := sq.Select("event_time", "size", "location", "county", "state", "lat", "lon", "comments").
-		From("hail_events")
-	if date != "" {
-		sql = sql.Where(sq.Expr("DATE(event_time) = ?", date))
-	}
-
-	// Add condition for location if provided
-	if location != "" {
-		sql = sql.Where(sq.Eq{"location": location})
-	}
-	sqlQuery, args, err := sql.ToSql()
-
-	if err != nil {
-		return []HailEvent{}, err
-	}
-	rows, err := m.DbRepo.DB.Query(sqlQuery, args...)
-	if err != nil {
-		return []HailEvent{}, err
+// fetchStorms loads every event matching filter.
+func (x *ModelsRepo) fetchStorms(filter StormFilter) (ApiResponse, error) {
+	var apiResponse ApiResponse
+	if filter.IncludesType(Hail) {
+		err := x.Store.EachHail(filter, nil, func(e HailEvent) error {
+			apiResponse.HEvents = append(apiResponse.HEvents, e)
+			return nil
+		})
+		if err != nil {
+			return ApiResponse{}, err
+		}
 	}
-	var events []HailEvent
-	defer rows.Close()
-	for rows.Next() {
-		var result HailEvent
-		var eventTimeStr string
-
-		err = rows.Scan(
-			&eventTimeStr,
-			&result.Size,
-			&result.Location,
-			&result.County,
-			&result.State,
-			&result.Lat,
-			&result.Lon,
-			&result.Comments,
-		)
-		eventTime, err := time.Parse("2006-01-02 15:04:05", eventTimeStr)
+	if filter.IncludesType(Wind) {
+		err := x.Store.EachWind(filter, nil, func(e WindEvent) error {
+			apiResponse.WEvents = append(apiResponse.WEvents, e)
+			return nil
+		})
 		if err != nil {
-			return []HailEvent{}, err
+			return ApiResponse{}, err
 		}
-		result.EventTime = eventTime
-		events = append(events, result)
 	}
-	if rows.Err() != nil {
-		return []HailEvent{}, err
+	if filter.IncludesType(Tornado) {
+		err := x.Store.EachTornado(filter, nil, func(e TornadoEvent) error {
+			apiResponse.TEvents = append(apiResponse.TEvents, e)
+			return nil
+		})
+		if err != nil {
+			return ApiResponse{}, err
+		}
 	}
-	return events, nil
+	return apiResponse, nil
 }
 
-func (m ModelsRepo) fetchWindStorms(location string, date string) ([]WindEvent, error) {
-	sql := sq.Select("event_time", "speed", "location", "county", "state", "lat", "lon", "comments").
-		From("wind_events")
-	if date != "" {
-		sql = sql.Where(sq.Expr("DATE(event_time) = ?", date))
-	}
-	if location != "" {
-		sql = sql.Where(sq.Eq{"location": location})
-	}
-	sqlQuery, args, err := sql.ToSql()
-
-	if err != nil {
-		return []WindEvent{}, err
-	}
-	rows, err := m.DbRepo.DB.Query(sqlQuery, args...)
-	if err != nil {
-		return []WindEvent{}, err
+// GetStorms returns one page of the events matching filter. Each table is
+// read up to the page limit after the cursor and the results are merged.
+func (x *ModelsRepo) GetStorms(filter StormFilter, page Page) (ApiResponse, error) {
+	var items []pageItem
+	if filter.IncludesType(Hail) {
+		err := x.Store.EachHail(filter, &page, func(e HailEvent) error {
+			items = append(items, hailItem(page.Sort, e))
+			return nil
+		})
+		if err != nil {
+			return ApiResponse{}, err
+		}
 	}
-	var events []WindEvent
-	defer rows.Close()
-	for rows.Next() {
-		var result WindEvent
-		var eventTimeStr string
-		err = rows.Scan(
-			&eventTimeStr,
-			&result.Speed,
-			&result.Location,
-			&result.County,
-			&result.State,
-			&result.Lat,
-			&result.Lon,
-			&result.Comments,
-		)
-		eventTime, err := time.Parse("2006-01-02 15:04:05", eventTimeStr)
+	if filter.IncludesType(Wind) {
+		err := x.Store.EachWind(filter, &page, func(e WindEvent) error {
+			items = append(items, windItem(page.Sort, e))
+			return nil
+		})
 		if err != nil {
-			return []WindEvent{}, err
+			return ApiResponse{}, err
 		}
-		result.EventTime = eventTime
-		events = append(events, result)
 	}
-	if rows.Err() != nil {
-		return []WindEvent{}, err
+	if filter.IncludesType(Tornado) {
+		err := x.Store.EachTornado(filter, &page, func(e TornadoEvent) error {
+			items = append(items, tornadoItem(page.Sort, e))
+			return nil
+		})
+		if err != nil {
+			return ApiResponse{}, err
+		}
 	}
-	return events, nil
-}
 
-func (m ModelsRepo) fetchTornadoStorms(location string, date string) ([]TornadoEvent, error) {
-	sql := sq.Select("event_time", "size", "location", "county", "state", "lat", "lon", "comments").
-		From("hail_events")
-	if date != "" {
-		sql = sql.Where(sq.Expr("DATE(event_time) = ?", date))
-	}
-	if location != "" {
-		sql = sql.Where(sq.Eq{"location": location})
+	apiResponse := paginate(items, page)
+	if page.IncludeTotal {
+		total, err := x.countStorms(filter)
+		if err != nil {
+			return ApiResponse{}, err
+		}
+		apiResponse.TotalElements = &total
 	}
-	sqlQuery, args, err := sql.ToSql()
+	return apiResponse, nil
+}
 
-	if err != nil {
-		return []TornadoEvent{}, err
-	}
-	rows, err := m.DbRepo.DB.Query(sqlQuery, args...)
-	if err != nil {
-		return []TornadoEvent{}, err
-	}
-	var events []TornadoEvent
-	defer rows.Close()
-	for rows.Next() {
-		var result TornadoEvent
-		var eventTimeStr string
-		err = rows.Scan(
-			&eventTimeStr,
-			&result.FScale,
-			&result.Location,
-			&result.County,
-			&result.State,
-			&result.Lat,
-			&result.Lon,
-			&result.Comments,
-		)
-		eventTime, err := time.Parse("2006-01-02 15:04:05", eventTimeStr)
+// countStorms counts the events matching filter across every table.
+func (x *ModelsRepo) countStorms(filter StormFilter) (int, error) {
+	total := 0
+	for _, stormType := range stormTypes {
+		if !filter.IncludesType(stormType) {
+			continue
+		}
+		count, err := x.Store.Count(stormType, filter)
 		if err != nil {
-			return []TornadoEvent{}, err
+			return 0, err
 		}
-		result.EventTime = eventTime
-		events = append(events, result)
+		total += count
 	}
-	if rows.Err() != nil {
-		return []TornadoEvent{}, err
-	}
-	return events, nil
+	return total, nil
 }
 
-func (x *ModelsRepo) GetStorms(location string, date string) (ApiResponse, error) {
-	hailStorms, err := x.fetchHailStorms(location, date)
-	if err != nil {
-		return ApiResponse{}, err
-	}
-	windStorms, err := x.fetchWindStorms(location, date)
-	if err != nil {
-		return ApiResponse{}, err
+// EachStorm calls fn with every event matching filter, one row at a time and
+// one table after the other, so callers can stream results of any size.
+func (x *ModelsRepo) EachStorm(filter StormFilter, fn func(Feature) error) error {
+	if filter.IncludesType(Hail) {
+		err := x.Store.EachHail(filter, nil, func(e HailEvent) error { return fn(e.feature()) })
+		if err != nil {
+			return err
+		}
 	}
-
-	tornadoStorms, err := x.fetchTornadoStorms(location, date)
-	if err != nil {
-		return ApiResponse{}, err
+	if filter.IncludesType(Wind) {
+		err := x.Store.EachWind(filter, nil, func(e WindEvent) error { return fn(e.feature()) })
+		if err != nil {
+			return err
+		}
 	}
-	totalElements := len(hailStorms) + len(windStorms) + len(tornadoStorms)
-	apiResponse := ApiResponse{
-		TotalElements: totalElements,
-		HEvents:       hailStorms,
-		WEvents:       windStorms,
-		TEvents:       tornadoStorms,
+	if filter.IncludesType(Tornado) {
+		err := x.Store.EachTornado(filter, nil, func(e TornadoEvent) error { return fn(e.feature()) })
+		if err != nil {
+			return err
+		}
 	}
-	return apiResponse, nil
+	return nil
 }
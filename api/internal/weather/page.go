@@ -0,0 +1,288 @@
+package weather
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// Values of the sort parameter. Time sorts oldest first, magnitude largest
+// first with unknown magnitudes last and distance nearest first.
+const (
+	SortTime      string = "time"
+	SortMagnitude string = "magnitude"
+	SortDistance  string = "distance"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+	eventTimeFormat  = "2006-01-02 15:04:05"
+)
+
+// magnitudeColumns are the columns sort=magnitude orders each table by.
+var magnitudeColumns = map[string]string{
+	Hail:    "size_in",
+	Wind:    "speed_mph",
+	Tornado: "rating",
+}
+
+// Page selects one page of a storm listing.
+type Page struct {
+	Sort  string
+	Limit int
+	// Cursor is the position of the last event of the previous page.
+	Cursor       *Cursor
+	IncludeTotal bool
+}
+
+// Cursor is the sort key of an event. Events are ordered by the sort value,
+// then type, then event ID, so the order is total and a cursor stays valid
+// while new events are inserted.
+type Cursor struct {
+	Sort string `json:"s"`
+	// Time is the event time for sort=time, Value the magnitude or distance.
+	Time  string   `json:"t,omitempty"`
+	Value *float64 `json:"v,omitempty"`
+	Type  string   `json:"y"`
+	Id    string   `json:"i"`
+}
+
+// Encode returns the cursor as an opaque token.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (*Cursor, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, false
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Id == "" {
+		return nil, false
+	}
+	switch cursor.Sort {
+	case SortTime:
+		if _, err := time.Parse(eventTimeFormat, cursor.Time); err != nil {
+			return nil, false
+		}
+	case SortDistance:
+		if cursor.Value == nil {
+			return nil, false
+		}
+	}
+	return &cursor, true
+}
+
+// less orders events for the cursor's sort.
+func (c Cursor) less(other Cursor) bool {
+	switch c.Sort {
+	case SortMagnitude:
+		if (c.Value == nil) != (other.Value == nil) {
+			return other.Value == nil
+		}
+		if c.Value != nil && *c.Value != *other.Value {
+			return *c.Value > *other.Value
+		}
+	case SortDistance:
+		if *c.Value != *other.Value {
+			return *c.Value < *other.Value
+		}
+	default:
+		if c.Time != other.Time {
+			return c.Time < other.Time
+		}
+	}
+	if c.Type != other.Type {
+		return c.Type < other.Type
+	}
+	return c.Id < other.Id
+}
+
+// after matches the rows of stormType's table that sort after the cursor.
+func (c Cursor) after(stormType string) sq.Sqlizer {
+	if c.Sort == SortMagnitude {
+		column := magnitudeColumns[stormType]
+		if c.Value == nil {
+			return sq.And{sq.Eq{column: nil}, sq.Gt{"event_id": c.Id}}
+		}
+		return sq.Or{
+			sq.Lt{column: *c.Value},
+			sq.And{sq.Eq{column: *c.Value}, sq.Gt{"event_id": c.Id}},
+			sq.Eq{column: nil},
+		}
+	}
+	switch {
+	case stormType > c.Type:
+		return sq.GtOrEq{"event_time": c.Time}
+	case stormType == c.Type:
+		return sq.Or{
+			sq.Gt{"event_time": c.Time},
+			sq.And{sq.Eq{"event_time": c.Time}, sq.Gt{"event_id": c.Id}},
+		}
+	}
+	return sq.Gt{"event_time": c.Time}
+}
+
+// apply adds the cursor, order and limit of the page to a query of
+// stormType's table. One row more than the limit is read to tell whether
+// another page follows.
+func (p Page) apply(sql sq.SelectBuilder, stormType string) sq.SelectBuilder {
+	if p.Cursor != nil {
+		sql = sql.Where(p.Cursor.after(stormType))
+	}
+	if p.Sort == SortMagnitude {
+		column := magnitudeColumns[stormType]
+		sql = sql.OrderBy(column+" IS NULL", column+" DESC", "event_id")
+	} else {
+		sql = sql.OrderBy("event_time", "event_id")
+	}
+	return sql.Limit(uint64(p.Limit + 1))
+}
+
+// ParsePage reads limit, sort, cursor and include_total. sort=distance is
+// only valid when allowDistance is set and sort=magnitude needs a single
+// type, as magnitudes of different types don't compare.
+func ParsePage(values url.Values, types []string, allowDistance bool) (Page, []string) {
+	var errs []string
+	page := Page{Sort: values.Get("sort"), Limit: defaultPageLimit}
+	switch page.Sort {
+	case "":
+		page.Sort = SortTime
+		if allowDistance {
+			page.Sort = SortDistance
+		}
+	case SortTime:
+	case SortMagnitude:
+		if len(types) != 1 {
+			errs = append(errs, "sort=magnitude requires exactly one type.")
+		}
+	case SortDistance:
+		if !allowDistance {
+			errs = append(errs, "sort=distance is only supported by /storm/nearby.")
+		}
+	default:
+		errs = append(errs, "sort must be time, magnitude or distance.")
+	}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			errs = append(errs, "limit must be a number from 1 to "+strconv.Itoa(maxPageLimit)+".")
+		} else {
+			page.Limit = limit
+		}
+	}
+
+	if token := values.Get("cursor"); token != "" {
+		cursor, ok := decodeCursor(token)
+		switch {
+		case !ok:
+			errs = append(errs, "cursor is invalid.")
+		case cursor.Sort != page.Sort:
+			errs = append(errs, "cursor doesn't match sort "+page.Sort+".")
+		default:
+			page.Cursor = cursor
+		}
+	}
+
+	switch values.Get("include_total") {
+	case "", "false":
+	case "true":
+		page.IncludeTotal = true
+	default:
+		errs = append(errs, "include_total must be true or false.")
+	}
+	return page, errs
+}
+
+// pageItem is an event of any type along with its sort key.
+type pageItem struct {
+	key     Cursor
+	add     func(response *ApiResponse)
+	feature func() Feature
+}
+
+func newCursor(sortBy string, stormType string, event Feature, eventId string) Cursor {
+	cursor := Cursor{Sort: sortBy, Type: stormType, Id: eventId}
+	switch sortBy {
+	case SortMagnitude:
+		cursor.Value = event.Properties.Magnitude
+	case SortDistance:
+		cursor.Value = event.Properties.DistanceMi
+	default:
+		cursor.Time = event.Properties.EventTime.UTC().Format(eventTimeFormat)
+	}
+	return cursor
+}
+
+func hailItem(sortBy string, e HailEvent) pageItem {
+	return pageItem{
+		key:     newCursor(sortBy, Hail, e.feature(), e.EventId),
+		add:     func(r *ApiResponse) { r.HEvents = append(r.HEvents, e) },
+		feature: e.feature,
+	}
+}
+
+func windItem(sortBy string, e WindEvent) pageItem {
+	return pageItem{
+		key:     newCursor(sortBy, Wind, e.feature(), e.EventId),
+		add:     func(r *ApiResponse) { r.WEvents = append(r.WEvents, e) },
+		feature: e.feature,
+	}
+}
+
+func tornadoItem(sortBy string, e TornadoEvent) pageItem {
+	return pageItem{
+		key:     newCursor(sortBy, Tornado, e.feature(), e.EventId),
+		add:     func(r *ApiResponse) { r.TEvents = append(r.TEvents, e) },
+		feature: e.feature,
+	}
+}
+
+// responseItems lists every event of response as page items.
+func responseItems(response ApiResponse, sortBy string) []pageItem {
+	var items []pageItem
+	for _, e := range response.HEvents {
+		items = append(items, hailItem(sortBy, e))
+	}
+	for _, e := range response.WEvents {
+		items = append(items, windItem(sortBy, e))
+	}
+	for _, e := range response.TEvents {
+		items = append(items, tornadoItem(sortBy, e))
+	}
+	return items
+}
+
+// paginate sorts items and returns the page of them after the cursor.
+func paginate(items []pageItem, page Page) ApiResponse {
+	var after []pageItem
+	for _, item := range items {
+		if page.Cursor == nil || page.Cursor.less(item.key) {
+			after = append(after, item)
+		}
+	}
+	sort.Slice(after, func(i, j int) bool {
+		return after[i].key.less(after[j].key)
+	})
+
+	var response ApiResponse
+	if len(after) > page.Limit {
+		after = after[:page.Limit]
+		next := after[len(after)-1].key.Encode()
+		response.NextCursor = &next
+	}
+	for _, item := range after {
+		item.add(&response)
+		response.features = append(response.features, item.feature())
+	}
+	return response
+}
@@ -0,0 +1,102 @@
+package weather
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type pageCase struct {
+	query          string
+	types          []string
+	allowDistance  bool
+	expectedSort   string
+	expectedErrors []string
+}
+
+func TestParsePage(t *testing.T) {
+	timeCursor := Cursor{Sort: SortTime, Time: "2024-05-06 20:10:00", Type: Hail, Id: "a"}.Encode()
+	testCases := []pageCase{
+		{query: "", expectedSort: SortTime},
+		{query: "", allowDistance: true, expectedSort: SortDistance},
+		{query: "sort=magnitude&limit=10", types: []string{Hail}, expectedSort: SortMagnitude},
+		{query: "cursor=" + timeCursor, expectedSort: SortTime},
+		{
+			query:          "sort=magnitude&limit=0",
+			expectedErrors: []string{"sort=magnitude requires exactly one type.", "limit must be a number from 1 to 1000."},
+		},
+		{query: "sort=distance", expectedErrors: []string{"sort=distance is only supported by /storm/nearby."}},
+		{query: "sort=size", expectedErrors: []string{"sort must be time, magnitude or distance."}},
+		{query: "cursor=abc", expectedErrors: []string{"cursor is invalid."}},
+		{query: "sort=magnitude&cursor=" + timeCursor, types: []string{Wind}, expectedErrors: []string{"cursor doesn't match sort magnitude."}},
+		{query: "include_total=yes", expectedErrors: []string{"include_total must be true or false."}},
+	}
+	for _, tc := range testCases {
+		values, err := url.ParseQuery(tc.query)
+		assert.Nil(t, err)
+		page, errs := ParsePage(values, tc.types, tc.allowDistance)
+		assert.Equal(t, tc.expectedErrors, errs, tc.query)
+		if tc.expectedErrors == nil {
+			assert.Equal(t, tc.expectedSort, page.Sort, tc.query)
+		}
+	}
+}
+
+func TestCursorOrder(t *testing.T) {
+	small, large := 1.0, 2.0
+	assert.True(t, Cursor{Sort: SortMagnitude, Value: &large, Id: "b"}.less(Cursor{Sort: SortMagnitude, Value: &small, Id: "a"}))
+	assert.True(t, Cursor{Sort: SortMagnitude, Value: &small, Id: "b"}.less(Cursor{Sort: SortMagnitude, Id: "a"}))
+	assert.True(t, Cursor{Sort: SortMagnitude, Id: "a"}.less(Cursor{Sort: SortMagnitude, Id: "b"}))
+	assert.True(t, Cursor{Sort: SortTime, Time: "2024-05-06 20:10:00", Type: Wind, Id: "a"}.
+		less(Cursor{Sort: SortTime, Time: "2024-05-06 20:10:01", Type: Hail, Id: "a"}))
+	assert.True(t, Cursor{Sort: SortTime, Time: "2024-05-06 20:10:00", Type: Hail, Id: "b"}.
+		less(Cursor{Sort: SortTime, Time: "2024-05-06 20:10:00", Type: Wind, Id: "a"}))
+}
+
+func TestGetStormsPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+	filter := StormFilter{Date: "2024-05-06", DateType: DateTypeUtc, Types: []string{Hail, Wind}}
+
+	mock.ExpectQuery("FROM hail_events WHERE DATE\\(event_time\\) = \\? ORDER BY event_time, event_id LIMIT 3").
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("h1", "2024-05-06 20:00:00", "2024-05-06", "100", 1.0, 25.4, "NORMAN", "", "OK", 35.2, -97.4, "").
+			AddRow("h2", "2024-05-06 22:00:00", "2024-05-06", "100", 1.0, 25.4, "NORMAN", "", "OK", 35.2, -97.4, ""))
+	mock.ExpectQuery("FROM wind_events WHERE DATE\\(event_time\\) = \\? ORDER BY event_time, event_id LIMIT 3").
+		WillReturnRows(sqlmock.NewRows(windColumns).
+			AddRow("w1", "2024-05-06 21:00:00", "2024-05-06", "60", 60.0, 52.1, false, false, "MOORE", "", "OK", 35.3, -97.5, ""))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM hail_events").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM wind_events").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	response, err := repo.GetStorms(filter, Page{Sort: SortTime, Limit: 2, IncludeTotal: true})
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 3, *response.TotalElements)
+	assert.Len(t, response.HEvents, 1)
+	assert.Len(t, response.WEvents, 1)
+	assert.NotNil(t, response.NextCursor)
+
+	// The next page starts after the wind event at 21:00.
+	cursor, ok := decodeCursor(*response.NextCursor)
+	assert.True(t, ok)
+	assert.Equal(t, Cursor{Sort: SortTime, Time: "2024-05-06 21:00:00", Type: Wind, Id: "w1"}, *cursor)
+
+	mock.ExpectQuery("FROM hail_events WHERE DATE\\(event_time\\) = \\? AND event_time > \\? ORDER BY").
+		WithArgs("2024-05-06", "2024-05-06 21:00:00").
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("h2", "2024-05-06 22:00:00", "2024-05-06", "100", 1.0, 25.4, "NORMAN", "", "OK", 35.2, -97.4, ""))
+	mock.ExpectQuery("FROM wind_events WHERE DATE\\(event_time\\) = \\? AND \\(event_time > \\? OR \\(event_time = \\? AND event_id > \\?\\)\\) ORDER BY").
+		WithArgs("2024-05-06", "2024-05-06 21:00:00", "2024-05-06 21:00:00", "w1").
+		WillReturnRows(sqlmock.NewRows(windColumns))
+
+	response, err = repo.GetStorms(filter, Page{Sort: SortTime, Limit: 2, Cursor: cursor})
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+	assert.Nil(t, response.TotalElements)
+	assert.Equal(t, "h2", response.HEvents[0].EventId)
+	assert.Nil(t, response.NextCursor)
+}
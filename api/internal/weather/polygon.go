@@ -0,0 +1,274 @@
+package weather
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Position is a lon/lat pair, in that order as in GeoJSON and WKT.
+type Position [2]float64
+
+// Ring is a closed line of positions, the first equal to the last.
+type Ring []Position
+
+// Polygon is an exterior ring followed by any holes cut out of it.
+type Polygon []Ring
+
+// MultiPolygon is a set of polygons. A point inside any of them is inside
+// the MultiPolygon.
+type MultiPolygon []Polygon
+
+// contains uses ray casting, so points exactly on an edge may fall either way.
+func (r Ring) contains(lat float64, lon float64) bool {
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		lonI, latI := r[i][0], r[i][1]
+		lonJ, latJ := r[j][0], r[j][1]
+		if (latI > lat) != (latJ > lat) && lon < (lonJ-lonI)*(lat-latI)/(latJ-latI)+lonI {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Contains reports whether the point is inside the exterior ring and outside
+// every hole.
+func (p Polygon) Contains(lat float64, lon float64) bool {
+	if len(p) == 0 || !p[0].contains(lat, lon) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(lat, lon) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m MultiPolygon) Contains(lat float64, lon float64) bool {
+	for _, polygon := range m {
+		if polygon.Contains(lat, lon) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bounds is the smallest box around every exterior ring.
+func (m MultiPolygon) Bounds() BoundingBox {
+	box := BoundingBox{MinLat: math.Inf(1), MinLon: math.Inf(1), MaxLat: math.Inf(-1), MaxLon: math.Inf(-1)}
+	for _, polygon := range m {
+		for _, position := range polygon[0] {
+			box.MinLon = math.Min(box.MinLon, position[0])
+			box.MaxLon = math.Max(box.MaxLon, position[0])
+			box.MinLat = math.Min(box.MinLat, position[1])
+			box.MaxLat = math.Max(box.MaxLat, position[1])
+		}
+	}
+	return box
+}
+
+func (m MultiPolygon) validate() error {
+	if len(m) == 0 {
+		return errors.New("Polygon has no rings.")
+	}
+	for _, polygon := range m {
+		if len(polygon) == 0 {
+			return errors.New("Polygon has no rings.")
+		}
+		for _, ring := range polygon {
+			if len(ring) < 4 || ring[0] != ring[len(ring)-1] {
+				return errors.New("Polygon rings must be closed and have at least 4 positions.")
+			}
+			for _, position := range ring {
+				if position[0] < -180 || position[0] > 180 || position[1] < -90 || position[1] > 90 {
+					return errors.New("Polygon positions must be longitude latitude pairs.")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ParsePolygon reads a GeoJSON or WKT polygon or multipolygon. GeoJSON may
+// also be a Feature or FeatureCollection, whose polygons are combined.
+func ParsePolygon(body []byte) (MultiPolygon, error) {
+	var polygon MultiPolygon
+	var err error
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+		polygon, err = parseGeoJson(trimmed)
+	} else {
+		polygon, err = parseWkt(string(trimmed))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return polygon, polygon.validate()
+}
+
+type geoJsonObject struct {
+	Type        string          `json:"type"`
+	Coordinates json.RawMessage `json:"coordinates"`
+	Geometry    *geoJsonObject  `json:"geometry"`
+	Features    []geoJsonObject `json:"features"`
+}
+
+func parseGeoJson(body []byte) (MultiPolygon, error) {
+	var object geoJsonObject
+	if err := json.Unmarshal(body, &object); err != nil {
+		return nil, errors.New("Invalid GeoJSON: " + err.Error())
+	}
+	return object.multiPolygon()
+}
+
+func (g geoJsonObject) multiPolygon() (MultiPolygon, error) {
+	switch g.Type {
+	case "Polygon":
+		var rings [][]Position
+		if err := json.Unmarshal(g.Coordinates, &rings); err != nil {
+			return nil, errors.New("Invalid GeoJSON Polygon coordinates.")
+		}
+		return MultiPolygon{toPolygon(rings)}, nil
+	case "MultiPolygon":
+		var polygons [][][]Position
+		if err := json.Unmarshal(g.Coordinates, &polygons); err != nil {
+			return nil, errors.New("Invalid GeoJSON MultiPolygon coordinates.")
+		}
+		var result MultiPolygon
+		for _, rings := range polygons {
+			result = append(result, toPolygon(rings))
+		}
+		return result, nil
+	case "Feature":
+		if g.Geometry == nil {
+			return nil, errors.New("GeoJSON Feature has no geometry.")
+		}
+		return g.Geometry.multiPolygon()
+	case "FeatureCollection":
+		var result MultiPolygon
+		for _, feature := range g.Features {
+			polygon, err := feature.multiPolygon()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, polygon...)
+		}
+		return result, nil
+	}
+	return nil, errors.New("GeoJSON type must be Polygon, MultiPolygon, Feature or FeatureCollection.")
+}
+
+func toPolygon(rings [][]Position) Polygon {
+	polygon := make(Polygon, len(rings))
+	for i, ring := range rings {
+		polygon[i] = ring
+	}
+	return polygon
+}
+
+// parseWkt reads a POLYGON or MULTIPOLYGON, optionally prefixed by an EWKT
+// SRID. Z and M values are ignored.
+func parseWkt(text string) (MultiPolygon, error) {
+	if strings.HasPrefix(strings.ToUpper(text), "SRID=") {
+		if i := strings.Index(text, ";"); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	open := strings.Index(text, "(")
+	if open < 0 {
+		return nil, errors.New("Polygon must be GeoJSON or a WKT POLYGON or MULTIPOLYGON.")
+	}
+	keyword := strings.Fields(strings.ToUpper(text[:open]))
+	if len(keyword) == 0 {
+		return nil, errors.New("Polygon must be GeoJSON or a WKT POLYGON or MULTIPOLYGON.")
+	}
+	body := text[open:]
+	switch keyword[0] {
+	case "POLYGON":
+		polygon, err := parseWktPolygon(body)
+		if err != nil {
+			return nil, err
+		}
+		return MultiPolygon{polygon}, nil
+	case "MULTIPOLYGON":
+		parts, err := wktParts(body)
+		if err != nil {
+			return nil, err
+		}
+		var result MultiPolygon
+		for _, part := range parts {
+			polygon, err := parseWktPolygon(part)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, polygon)
+		}
+		return result, nil
+	}
+	return nil, errors.New("Polygon must be GeoJSON or a WKT POLYGON or MULTIPOLYGON.")
+}
+
+func parseWktPolygon(text string) (Polygon, error) {
+	parts, err := wktParts(text)
+	if err != nil {
+		return nil, err
+	}
+	var polygon Polygon
+	for _, part := range parts {
+		positions, err := wktParts(part)
+		if err != nil {
+			return nil, err
+		}
+		var ring Ring
+		for _, position := range positions {
+			fields := strings.Fields(position)
+			if len(fields) < 2 {
+				return nil, errors.New("Invalid WKT position " + position)
+			}
+			lon, lonErr := strconv.ParseFloat(fields[0], 64)
+			lat, latErr := strconv.ParseFloat(fields[1], 64)
+			if lonErr != nil || latErr != nil {
+				return nil, errors.New("Invalid WKT position " + position)
+			}
+			ring = append(ring, Position{lon, lat})
+		}
+		polygon = append(polygon, ring)
+	}
+	return polygon, nil
+}
+
+// wktParts strips the parentheses around text and splits what they hold on
+// the commas that are not nested in further parentheses.
+func wktParts(text string) ([]string, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		return nil, errors.New("Invalid WKT, expected a parenthesized list.")
+	}
+	text = text[1 : len(text)-1]
+	var parts []string
+	depth, start := 0, 0
+	for i, char := range text {
+		switch char {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("Invalid WKT, unbalanced parentheses.")
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(text[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, errors.New("Invalid WKT, unbalanced parentheses.")
+	}
+	return append(parts, strings.TrimSpace(text[start:])), nil
+}
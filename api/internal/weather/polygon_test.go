@@ -0,0 +1,109 @@
+package weather
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// A 10x10 degree square with a 2x2 hole in the middle, and a second square
+// to the east.
+const (
+	squareWithHoleGeoJson = `{"type": "Polygon", "coordinates": [
+		[[-100, 30], [-90, 30], [-90, 40], [-100, 40], [-100, 30]],
+		[[-96, 34], [-94, 34], [-94, 36], [-96, 36], [-96, 34]]]}`
+	multiPolygonWkt = `MULTIPOLYGON (((-100 30, -90 30, -90 40, -100 40, -100 30), (-96 34, -94 34, -94 36, -96 36, -96 34)),
+		((-80 30, -75 30, -75 35, -80 35, -80 30)))`
+)
+
+type pointCase struct {
+	lat      float64
+	lon      float64
+	expected bool
+}
+
+func TestParsePolygon(t *testing.T) {
+	points := []pointCase{
+		{lat: 32, lon: -98, expected: true},
+		{lat: 35, lon: -95, expected: false},
+		{lat: 45, lon: -95, expected: false},
+		{lat: 32, lon: -77, expected: true},
+	}
+
+	bodies := map[string]string{
+		"geojson":    squareWithHoleGeoJson,
+		"feature":    `{"type": "Feature", "properties": {}, "geometry": ` + squareWithHoleGeoJson + `}`,
+		"wkt":        multiPolygonWkt,
+		"ewkt":       "SRID=4326;" + multiPolygonWkt,
+		"collection": `{"type": "FeatureCollection", "features": [{"type": "Feature", "geometry": ` + squareWithHoleGeoJson + `}]}`,
+	}
+	for name, body := range bodies {
+		polygon, err := ParsePolygon([]byte(body))
+		assert.Nil(t, err, name)
+		for _, tc := range points[:3] {
+			assert.Equal(t, tc.expected, polygon.Contains(tc.lat, tc.lon), name)
+		}
+	}
+
+	polygon, err := ParsePolygon([]byte(multiPolygonWkt))
+	assert.Nil(t, err)
+	assert.Equal(t, points[3].expected, polygon.Contains(points[3].lat, points[3].lon))
+	assert.Equal(t, BoundingBox{MinLat: 30, MinLon: -100, MaxLat: 40, MaxLon: -75}, polygon.Bounds())
+
+	invalid := map[string]string{
+		`{"type": "Point", "coordinates": [-95, 35]}`:           "GeoJSON type must be Polygon, MultiPolygon, Feature or FeatureCollection.",
+		`POLYGON ((-100 30, -90 30, -90 40))`:                   "Polygon rings must be closed and have at least 4 positions.",
+		`POLYGON ((30 -100, 30 -90, 40 -90, 40 -100, 30 -100))`: "Polygon positions must be longitude latitude pairs.",
+		`POLYGON ((-100 30, -90 30, -90 40, -100 30)`:           "Invalid WKT, unbalanced parentheses.",
+		`LINESTRING (-100 30, -90 30)`:                          "Polygon must be GeoJSON or a WKT POLYGON or MULTIPOLYGON.",
+	}
+	for body, expected := range invalid {
+		_, err := ParsePolygon([]byte(body))
+		if assert.NotNil(t, err, body) {
+			assert.Equal(t, expected, err.Error(), body)
+		}
+	}
+}
+
+func TestParseBoxFilter(t *testing.T) {
+	values, _ := url.ParseQuery("bbox=-100,30,-90,40&type=hail")
+	filter, errs := ParseBoxFilter(values)
+	assert.Nil(t, errs)
+	assert.Equal(t, &BoundingBox{MinLon: -100, MinLat: 30, MaxLon: -90, MaxLat: 40}, filter.Bounds)
+
+	stm, _, err := hailQuery(filter, mysqlDialect{}).ToSql()
+	assert.Nil(t, err)
+	assert.Contains(t, stm, "WHERE (lat BETWEEN ? AND ? AND lon BETWEEN ? AND ?)")
+
+	values, _ = url.ParseQuery("bbox=-90,30,-100,40")
+	_, errs = ParseBoxFilter(values)
+	assert.Equal(t, []string{"bbox must be minLon,minLat,maxLon,maxLat within -180,-90,180,90."}, errs)
+
+	values, _ = url.ParseQuery("bbox=-100,30,-90")
+	_, errs = ParseBoxFilter(values)
+	assert.Equal(t, []string{"bbox must be minLon,minLat,maxLon,maxLat."}, errs)
+}
+
+func TestGetStormsInPolygon(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.Nil(t, err)
+	defer db.Close()
+	repo := NewModelsRepo(NewSqlStore(db, DriverMysql))
+
+	mock.ExpectQuery("FROM hail_events WHERE \\(lat BETWEEN \\? AND \\? AND lon BETWEEN \\? AND \\?\\)").
+		WithArgs(30.0, 40.0, -100.0, -90.0).
+		WillReturnRows(sqlmock.NewRows(hailColumns).
+			AddRow("00000000000000000000000000000009", "2024-05-06 20:10:00", "2024-05-06", "175", 1.75, 44.5, "INSIDE", "", "OK", 32.0, -98.0, "").
+			AddRow("0000000000000000000000000000000a", "2024-05-06 21:00:00", "2024-05-06", "100", 1.0, 25.4, "HOLE", "", "OK", 35.0, -95.0, ""))
+
+	polygon, err := ParsePolygon([]byte(squareWithHoleGeoJson))
+	assert.Nil(t, err)
+	response, err := repo.GetStormsInPolygon(polygon, StormFilter{Types: []string{Hail}}, Page{Sort: SortTime, Limit: 10, IncludeTotal: true})
+	assert.Nil(t, err)
+	assert.Nil(t, mock.ExpectationsWereMet())
+
+	assert.Equal(t, 1, *response.TotalElements)
+	assert.Equal(t, "INSIDE", response.HEvents[0].Location)
+}
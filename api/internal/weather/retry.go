@@ -0,0 +1,79 @@
+package weather
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// MySQL errors worth retrying: too many connections, server shutdown, lock
+// wait timeout, deadlock, query interrupted, read only during a failover and
+// connection killed.
+var transientMysqlErrors = map[uint16]bool{
+	1040: true,
+	1053: true,
+	1205: true,
+	1213: true,
+	1290: true,
+	1317: true,
+	1836: true,
+	1927: true,
+}
+
+// PostgreSQL SQLSTATEs worth retrying besides the connection exception class.
+var transientPostgresErrors = map[pq.ErrorCode]bool{
+	"40001": true, // serialization_failure
+	"40P01": true, // deadlock_detected
+	"53300": true, // too_many_connections
+	"57P01": true, // admin_shutdown
+	"57P02": true, // crash_shutdown
+	"57P03": true, // cannot_connect_now
+}
+
+// isTransient reports whether a failed write may succeed once retried, as
+// when the database is unreachable, restarting or broke a deadlock.
+func isTransient(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return transientMysqlErrors[mysqlErr.Number]
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code.Class() == "08" || transientPostgresErrors[pqErr.Code]
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// The low byte is the primary code of an extended one.
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+
+// retryBackoff doubles base for every attempt after the first, up to max.
+func retryBackoff(base time.Duration, max time.Duration, attempt int) time.Duration {
+	backoff := base
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
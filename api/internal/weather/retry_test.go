@@ -0,0 +1,44 @@
+package weather
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+type transientCase struct {
+	err       error
+	transient bool
+}
+
+func TestIsTransient(t *testing.T) {
+	testCases := []transientCase{
+		{err: driver.ErrBadConn, transient: true},
+		{err: fmt.Errorf("Unable to save: %w", mysql.ErrInvalidConn), transient: true},
+		{err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, transient: true},
+		{err: &mysql.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}, transient: true},
+		{err: &mysql.MySQLError{Number: 1406, Message: "Data too long for column 'f_scale'"}, transient: false},
+		{err: &pq.Error{Code: "08006"}, transient: true},
+		{err: &pq.Error{Code: "40P01"}, transient: true},
+		{err: &pq.Error{Code: "23505"}, transient: false},
+		{err: errors.New("Unable to scan string as a time."), transient: false},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.transient, isTransient(tc.err), "%v", tc.err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base := 500 * time.Millisecond
+	assert.Equal(t, base, retryBackoff(base, 30*time.Second, 1))
+	assert.Equal(t, 4*time.Second, retryBackoff(base, 30*time.Second, 4))
+	assert.Equal(t, 30*time.Second, retryBackoff(base, 30*time.Second, 20))
+}
@@ -0,0 +1,326 @@
+package weather
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// dbTime scans a DATETIME or TIMESTAMP column, which MySQL returns as text
+// when parseTime is off, PostgreSQL as time.Time and SQLite as either.
+type dbTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+func (t *dbTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		t.Valid = false
+		return nil
+	case time.Time:
+		t.Time, t.Valid = v.UTC(), true
+		return nil
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	}
+	return fmt.Errorf("Unable to scan %T as a time.", src)
+}
+
+func (t *dbTime) parse(value string) error {
+	parsed, err := time.Parse("2006-01-02 15:04:05.999999999", value)
+	if err != nil {
+		return err
+	}
+	t.Time, t.Valid = parsed, true
+	return nil
+}
+
+// ptr returns the time, or nil for NULL.
+func (t dbTime) ptr() *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// dbDate scans a DATE column as YYYY-MM-DD.
+type dbDate string
+
+func (d *dbDate) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = dbDate(v.Format(dateFormat))
+		return nil
+	case []byte:
+		return d.parse(string(v))
+	case string:
+		return d.parse(v)
+	}
+	return fmt.Errorf("Unable to scan %T as a date.", src)
+}
+
+func (d *dbDate) parse(value string) error {
+	if len(value) < len(dateFormat) {
+		return fmt.Errorf("Unable to scan %q as a date.", value)
+	}
+	*d = dbDate(value[:len(dateFormat)])
+	return nil
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *SqlStore) exec(db execer, insert sq.InsertBuilder) error {
+	stm, args, err := insert.PlaceholderFormat(s.dialect.placeholder()).ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(stm, s.values(args)...)
+	return err
+}
+
+func (s *SqlStore) values(args []interface{}) []interface{} {
+	for i, arg := range args {
+		args[i] = s.dialect.value(arg)
+	}
+	return args
+}
+
+func (s *SqlStore) query(query sq.SelectBuilder) (*sql.Rows, error) {
+	sqlQuery, args, err := query.PlaceholderFormat(s.dialect.placeholder()).ToSql()
+	if err != nil {
+		return nil, err
+	}
+	return s.DB.Query(sqlQuery, s.values(args)...)
+}
+
+func (s *SqlStore) SaveHail(event HailEvent) error {
+	return s.exec(s.DB, event.insert(s.dialect))
+}
+
+func (s *SqlStore) SaveWind(event WindEvent) error {
+	return s.exec(s.DB, event.insert(s.dialect))
+}
+
+func (s *SqlStore) SaveTornado(event TornadoEvent) error {
+	return s.exec(s.DB, event.insert(s.dialect))
+}
+
+func hailQuery(filter StormFilter, d dialect) sq.SelectBuilder {
+	sql := sq.Select(hailColumns...).
+		From("hail_events")
+	sql = filter.apply(sql, d)
+	if filter.MinSize != nil {
+		sql = sql.Where(sq.GtOrEq{"size_in": *filter.MinSize})
+	}
+	if filter.MaxSize != nil {
+		sql = sql.Where(sq.LtOrEq{"size_in": *filter.MaxSize})
+	}
+	return sql
+}
+
+func (s *SqlStore) EachHail(filter StormFilter, page *Page, fn func(HailEvent) error) error {
+	query := hailQuery(filter, s.dialect)
+	if page != nil {
+		query = page.apply(query, Hail)
+	}
+	rows, err := s.query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result HailEvent
+		var eventTime dbTime
+		var day dbDate
+		err = rows.Scan(
+			&result.EventId,
+			&eventTime,
+			&day,
+			&result.Size,
+			&result.SizeIn,
+			&result.SizeMm,
+			&result.Location,
+			&result.County,
+			&result.State,
+			&result.Lat,
+			&result.Lon,
+			&result.Comments,
+		)
+		if err != nil {
+			return err
+		}
+		result.EventTime = eventTime.Time
+		result.ConvectiveDay = string(day)
+		result.Self = eventPath(Hail, result.EventId)
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func windQuery(filter StormFilter, d dialect) sq.SelectBuilder {
+	sql := sq.Select(windColumns...).
+		From("wind_events")
+	sql = filter.apply(sql, d)
+	if filter.MinSpeed != nil {
+		sql = sql.Where(sq.GtOrEq{"speed_mph": *filter.MinSpeed})
+	}
+	return sql
+}
+
+func (s *SqlStore) EachWind(filter StormFilter, page *Page, fn func(WindEvent) error) error {
+	query := windQuery(filter, s.dialect)
+	if page != nil {
+		query = page.apply(query, Wind)
+	}
+	rows, err := s.query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result WindEvent
+		var eventTime dbTime
+		var day dbDate
+		err = rows.Scan(
+			&result.EventId,
+			&eventTime,
+			&day,
+			&result.Speed,
+			&result.SpeedMph,
+			&result.SpeedKts,
+			&result.SpeedEstimated,
+			&result.SpeedUnknown,
+			&result.Location,
+			&result.County,
+			&result.State,
+			&result.Lat,
+			&result.Lon,
+			&result.Comments,
+		)
+		if err != nil {
+			return err
+		}
+		result.EventTime = eventTime.Time
+		result.ConvectiveDay = string(day)
+		result.Self = eventPath(Wind, result.EventId)
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func tornadoQuery(filter StormFilter, d dialect) sq.SelectBuilder {
+	sql := sq.Select(tornadoColumns...).
+		From("tornado_events")
+	sql = filter.apply(sql, d)
+	if filter.MinRating != nil {
+		sql = sql.Where(sq.GtOrEq{"rating": *filter.MinRating})
+	}
+	return sql
+}
+
+func (s *SqlStore) EachTornado(filter StormFilter, page *Page, fn func(TornadoEvent) error) error {
+	query := tornadoQuery(filter, s.dialect)
+	if page != nil {
+		query = page.apply(query, Tornado)
+	}
+	rows, err := s.query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var result TornadoEvent
+		var eventTime dbTime
+		var day dbDate
+		err = rows.Scan(
+			&result.EventId,
+			&eventTime,
+			&day,
+			&result.FScale,
+			&result.Rating,
+			&result.RatingScale,
+			&result.Location,
+			&result.County,
+			&result.State,
+			&result.Lat,
+			&result.Lon,
+			&result.Comments,
+		)
+		if err != nil {
+			return err
+		}
+		result.EventTime = eventTime.Time
+		result.ConvectiveDay = string(day)
+		result.Self = eventPath(Tornado, result.EventId)
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var stormQueries = map[string]func(StormFilter, dialect) sq.SelectBuilder{
+	Hail:    hailQuery,
+	Wind:    windQuery,
+	Tornado: tornadoQuery,
+}
+
+func (s *SqlStore) Count(stormType string, filter StormFilter) (int, error) {
+	rows, err := s.query(stormQueries[stormType](filter, s.dialect).RemoveColumns().Columns("COUNT(*)"))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var count int
+	if rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0, err
+		}
+	}
+	return count, rows.Err()
+}
+
+func (s *SqlStore) Ingestion(stormType string, eventId string) (Ingestion, error) {
+	rows, err := s.query(sq.Select(ingestionColumns...).From(stormType + "_events").Where(sq.Eq{"event_id": eventId}))
+	if err != nil {
+		return Ingestion{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Ingestion{}, err
+		}
+		return Ingestion{}, sql.ErrNoRows
+	}
+	var ingestion Ingestion
+	var source, topic sql.NullString
+	var emittedAt, ingestedAt dbTime
+	var partition sql.NullInt32
+	var offset sql.NullInt64
+	if err := rows.Scan(&source, &emittedAt, &topic, &partition, &offset, &ingestedAt); err != nil {
+		return Ingestion{}, err
+	}
+	ingestion.Source = source.String
+	ingestion.KafkaTopic = topic.String
+	if partition.Valid {
+		ingestion.KafkaPartition = &partition.Int32
+	}
+	if offset.Valid {
+		ingestion.KafkaOffset = &offset.Int64
+	}
+	ingestion.EmittedAt = emittedAt.ptr()
+	ingestion.IngestedAt = ingestedAt.ptr()
+	return ingestion, nil
+}
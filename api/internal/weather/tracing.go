@@ -0,0 +1,9 @@
+package weather
+
+import "go.opentelemetry.io/otel/attribute"
+
+const tracerName = "weather-api/internal/weather"
+
+func (k eventKey) attributes() []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("weather.storm_type", k.stormType), attribute.String("weather.event_id", k.eventId)}
+}
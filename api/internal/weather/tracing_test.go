@@ -0,0 +1,72 @@
+package weather
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+)
+
+// rejectingStore fails every batch and every tornado, so the consumer falls
+// back to saving one event at a time and skips the tornadoes.
+type rejectingStore struct {
+	failingBatchStore
+}
+
+func (rejectingStore) SaveTornado(TornadoEvent) error {
+	return errors.New("Data too long for column 'f_scale'")
+}
+
+func TestProcessTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	consumer := NewMemoryConsumer("transformed-weather-data")
+	store := rejectingStore{failingBatchStore{NewMemoryStore()}}
+	process := NewProcess(consumer, NewModelsRepo(store), Kakfa{BatchSize: 10, FlushInterval: 20 * time.Millisecond}, zap.NewNop())
+	process.Tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+	// Both reports are read into the same batch.
+	consumer.Add([]byte("h1"), []byte(`{"StormType": "hail", "Time": 1715026200, "Size": "175", "Location": "NORMAN", "State": "OK", "Lat": 35.22, "Lon": -97.44}`),
+		kafka.Header{Key: "traceparent", Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")})
+	consumer.Add([]byte("t1"), []byte(`{"StormType": "tornado", "Time": 1715026200, "FScale": "EF2", "Location": "MOORE", "State": "OK", "Lat": 35.34, "Lon": -97.49}`))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return len(recorder.Ended()) == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.Nil(t, <-done)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		for _, attr := range span.Attributes() {
+			if attr.Key == "weather.event_id" {
+				spans[span.Name()+" "+attr.Value.AsString()] = span
+			}
+		}
+		if span.Name() == "insert batch" {
+			spans[span.Name()] = span
+		}
+	}
+	hail, tornado, insert := spans["process transformed-weather-data h1"], spans["process transformed-weather-data t1"], spans["insert batch"]
+	assert.NotNil(t, insert)
+
+	// The hail report continues the trace of the ETL and is saved.
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hail.SpanContext().TraceID().String())
+	assert.True(t, hail.Parent().IsRemote())
+	assert.Equal(t, codes.Unset, hail.Status().Code)
+	assert.Equal(t, insert.SpanContext(), hail.Links()[0].SpanContext)
+	assert.Equal(t, insert.SpanContext().SpanID(), spans["insert event h1"].Parent().SpanID())
+
+	// The tornado can't be saved and its trace says so.
+	assert.Equal(t, codes.Error, tornado.Status().Code)
+	assert.Equal(t, codes.Error, spans["insert event t1"].Status().Code)
+}
@@ -0,0 +1,178 @@
+package event
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"weather-contract/registry"
+
+	"github.com/hamba/avro/v2"
+)
+
+//go:embed envelope.avsc
+var avroSchemaText string
+
+var avroSchema = avro.MustParse(avroSchemaText)
+
+// AvroSchema returns the Avro schema of the envelope at SchemaVersion.
+func AvroSchema() string {
+	return avroSchemaText
+}
+
+// envelopeAvro is the Avro form of an Envelope.
+type envelopeAvro struct {
+	SchemaVersion int        `avro:"schema_version"`
+	EventId       string     `avro:"event_id"`
+	Type          string     `avro:"type"`
+	Source        string     `avro:"source"`
+	EmittedAt     *time.Time `avro:"emitted_at"`
+	EventTime     time.Time  `avro:"event_time"`
+	ConvectiveDay string     `avro:"convective_day"`
+	Hail          *Hail      `avro:"hail"`
+	Wind          *Wind      `avro:"wind"`
+	Tornado       *Tornado   `avro:"tornado"`
+}
+
+// EncodeAvro validates e and returns its Avro form, without the wire format
+// header.
+func EncodeAvro(e Envelope) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	out := envelopeAvro{
+		SchemaVersion: e.SchemaVersion,
+		EventId:       e.EventId,
+		Type:          e.Type,
+		Source:        e.Source,
+		EventTime:     e.EventTime.UTC(),
+		ConvectiveDay: e.ConvectiveDay,
+		Hail:          e.Hail,
+		Wind:          e.Wind,
+		Tornado:       e.Tornado,
+	}
+	if !e.EmittedAt.IsZero() {
+		emittedAt := e.EmittedAt.UTC()
+		out.EmittedAt = &emittedAt
+	}
+	return avro.Marshal(avroSchema, out)
+}
+
+// decodeAvro reads and validates an envelope written with the writer schema
+// that schema was resolved from.
+func decodeAvro(schema avro.Schema, data []byte) (Envelope, error) {
+	var in envelopeAvro
+	if err := avro.Unmarshal(schema, data, &in); err != nil {
+		return Envelope{}, errors.New("Unable to parse message: " + err.Error())
+	}
+	e := Envelope{
+		SchemaVersion: in.SchemaVersion,
+		EventId:       in.EventId,
+		Type:          in.Type,
+		Source:        in.Source,
+		EventTime:     in.EventTime.UTC(),
+		ConvectiveDay: in.ConvectiveDay,
+		Hail:          in.Hail,
+		Wind:          in.Wind,
+		Tornado:       in.Tornado,
+	}
+	if in.EmittedAt != nil {
+		e.EmittedAt = in.EmittedAt.UTC()
+	}
+	return e, e.Validate()
+}
+
+// resolveAvro returns the schema reading messages written with writer into
+// AvroSchema, or an error when AvroSchema can't read them.
+func resolveAvro(writer string) (avro.Schema, error) {
+	// Versions of the schema share type names, so each is parsed on its own.
+	parsed, err := avro.ParseWithCache(writer, "", &avro.SchemaCache{})
+	if err != nil {
+		return nil, err
+	}
+	return avro.NewSchemaCompatibility().Resolve(avroSchema, parsed)
+}
+
+// AvroEncoder writes envelopes in Avro, in the wire format of the schema
+// registry.
+type AvroEncoder struct {
+	id int
+}
+
+// NewAvroEncoder registers AvroSchema under subject. It returns
+// registry.ErrIncompatible when the registry rules the schema out.
+func NewAvroEncoder(ctx context.Context, client *registry.Client, subject string) (*AvroEncoder, error) {
+	if err := client.CheckCompatibility(ctx, subject, AvroSchema()); err != nil {
+		return nil, err
+	}
+	id, err := client.Register(ctx, subject, AvroSchema())
+	if err != nil {
+		return nil, err
+	}
+	return &AvroEncoder{id: id}, nil
+}
+
+func (e *AvroEncoder) Encode(envelope Envelope) ([]byte, error) {
+	data, err := EncodeAvro(envelope)
+	if err != nil {
+		return nil, err
+	}
+	return registry.Frame(e.id, data), nil
+}
+
+// AvroDecoder reads envelopes written with any schema registered under a
+// subject that AvroSchema can read.
+type AvroDecoder struct {
+	client *registry.Client
+
+	mu       sync.Mutex
+	resolved map[int]avro.Schema
+}
+
+// NewAvroDecoder checks that AvroSchema can read messages written with the
+// latest schema of subject, and returns registry.ErrIncompatible otherwise.
+func NewAvroDecoder(ctx context.Context, client *registry.Client, subject string) (*AvroDecoder, error) {
+	decoder := &AvroDecoder{client: client, resolved: make(map[int]avro.Schema)}
+	latest, err := client.Latest(ctx, subject)
+	if registry.IsNotFound(err) {
+		return decoder, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	schema, err := resolveAvro(latest.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("%w with %s version %d: %s", registry.ErrIncompatible, subject, latest.Version, err)
+	}
+	decoder.resolved[latest.Id] = schema
+	return decoder, nil
+}
+
+// Decode reads an envelope in the wire format. The schema it was written
+// with is fetched from the registry the first time its ID is seen.
+func (d *AvroDecoder) Decode(data []byte) (Envelope, error) {
+	id, payload, err := registry.Unframe(data)
+	if err != nil {
+		return Envelope{}, err
+	}
+	d.mu.Lock()
+	schema, ok := d.resolved[id]
+	d.mu.Unlock()
+	if !ok {
+		writer, err := d.client.Schema(context.Background(), id)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("Unable to fetch schema %d: %w", id, err)
+		}
+		schema, err = resolveAvro(writer)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("Unable to read schema %d: %w", id, err)
+		}
+		d.mu.Lock()
+		d.resolved[id] = schema
+		d.mu.Unlock()
+	}
+	return decodeAvro(schema, payload)
+}
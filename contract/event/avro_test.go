@@ -0,0 +1,112 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"weather-contract/event"
+	"weather-contract/event/eventtest"
+	"weather-contract/registry"
+
+	"github.com/hamba/avro/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAvroRoundTrip checks that every storm type survives the Avro encoding
+// with all of its fields.
+func TestAvroRoundTrip(t *testing.T) {
+	server := httptest.NewServer(registry.NewMock())
+	defer server.Close()
+	client := registry.NewClient(server.URL)
+	encoder, err := event.NewAvroEncoder(context.Background(), client, "transformed-weather-data-value")
+	assert.Nil(t, err)
+	decoder, err := event.NewAvroDecoder(context.Background(), client, "transformed-weather-data-value")
+	assert.Nil(t, err)
+
+	for _, envelope := range eventtest.Envelopes() {
+		data, err := encoder.Encode(envelope)
+		assert.Nil(t, err)
+		assert.True(t, registry.IsFramed(data))
+		json, err := event.Encode(envelope)
+		assert.Nil(t, err)
+		assert.Less(t, len(data), len(json)/2, envelope.Type)
+
+		decoded, err := decoder.Decode(data)
+		assert.Nil(t, err)
+		assert.Equal(t, envelope, decoded)
+	}
+
+	_, err = decoder.Decode([]byte(`{"schema_version": 1}`))
+	assert.Equal(t, registry.ErrNotFramed, err)
+	_, err = decoder.Decode(registry.Frame(42, []byte{2}))
+	assert.ErrorContains(t, err, "Unable to fetch schema 42: ")
+}
+
+// TestAvroSchemaEvolution reads messages of a newer schema that adds a field,
+// and refuses to start against one that drops a field the current schema
+// needs.
+func TestAvroSchemaEvolution(t *testing.T) {
+	server := httptest.NewServer(registry.NewMock())
+	defer server.Close()
+	client := registry.NewClient(server.URL)
+	ctx := context.Background()
+	newer := strings.Replace(event.AvroSchema(), `{"name": "convective_day", "type": "string"},`,
+		`{"name": "convective_day", "type": "string"}, {"name": "office", "type": "string", "default": ""},`, 1)
+	_, err := client.Register(ctx, "newer-value", event.AvroSchema())
+	assert.Nil(t, err)
+	newerId, err := client.Register(ctx, "newer-value", newer)
+	assert.Nil(t, err)
+
+	decoder, err := event.NewAvroDecoder(ctx, client, "newer-value")
+	assert.Nil(t, err)
+	envelope := eventtest.Envelopes()[0]
+	schema, err := avro.ParseWithCache(newer, "", &avro.SchemaCache{})
+	assert.Nil(t, err)
+	data, err := avro.Marshal(schema, newerEnvelope{
+		SchemaVersion: envelope.SchemaVersion,
+		EventId:       envelope.EventId,
+		Type:          envelope.Type,
+		Source:        envelope.Source,
+		EmittedAt:     &envelope.EmittedAt,
+		EventTime:     envelope.EventTime,
+		ConvectiveDay: envelope.ConvectiveDay,
+		Office:        "OUN",
+		Hail:          envelope.Hail,
+	})
+	assert.Nil(t, err)
+	decoded, err := decoder.Decode(registry.Frame(newerId, data))
+	assert.Nil(t, err)
+	assert.Equal(t, envelope, decoded)
+
+	// The current schema still reads the newer one, but not one without the
+	// source field, which neither service starts against.
+	_, err = event.NewAvroEncoder(ctx, client, "newer-value")
+	assert.Nil(t, err)
+	incompatible := strings.Replace(event.AvroSchema(), `{"name": "source", "type": "string"},`, "", 1)
+	_, err = client.Register(ctx, "incompatible-value", incompatible)
+	assert.Nil(t, err)
+	_, err = event.NewAvroDecoder(ctx, client, "incompatible-value")
+	assert.True(t, errors.Is(err, registry.ErrIncompatible))
+	_, err = event.NewAvroEncoder(ctx, client, "incompatible-value")
+	assert.True(t, errors.Is(err, registry.ErrIncompatible))
+}
+
+// newerEnvelope is the envelope of a later schema version with an office
+// field.
+type newerEnvelope struct {
+	SchemaVersion int            `avro:"schema_version"`
+	EventId       string         `avro:"event_id"`
+	Type          string         `avro:"type"`
+	Source        string         `avro:"source"`
+	EmittedAt     *time.Time     `avro:"emitted_at"`
+	EventTime     time.Time      `avro:"event_time"`
+	ConvectiveDay string         `avro:"convective_day"`
+	Office        string         `avro:"office"`
+	Hail          *event.Hail    `avro:"hail"`
+	Wind          *event.Wind    `avro:"wind"`
+	Tornado       *event.Tornado `avro:"tornado"`
+}
@@ -0,0 +1,247 @@
+// Package event defines the versioned envelope in which the etl publishes
+// transformed storm reports and the api consumes them.
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SchemaVersion is the version of the envelope written by this package. A
+// change that older consumers can't read bumps it.
+const SchemaVersion = 1
+
+// Storm types of an envelope.
+const (
+	TypeHail    string = "hail"
+	TypeWind    string = "wind"
+	TypeTornado string = "tornado"
+)
+
+// ErrUnversioned is returned for messages published before the envelope.
+var ErrUnversioned = errors.New("Message has no schema version")
+
+// Envelope is a transformed storm report. Exactly one of Hail, Wind and
+// Tornado is set, the one matching Type.
+type Envelope struct {
+	SchemaVersion int
+	// EventId is derived from the natural key of the report, so a report
+	// re-sent by the collector keeps its ID.
+	EventId string
+	Type    string
+	// Source is the report-day convention of the raw report, spc or calendar.
+	Source string
+	// EmittedAt is when the collector published the raw report, zero when
+	// unknown.
+	EmittedAt time.Time
+	// EventTime is the absolute UTC time of the event, ConvectiveDay the
+	// report day it was listed under.
+	EventTime     time.Time
+	ConvectiveDay string
+
+	Hail    *Hail
+	Wind    *Wind
+	Tornado *Tornado
+}
+
+// Report holds what every storm report has.
+type Report struct {
+	Location string  `json:"location" avro:"location"`
+	County   string  `json:"county" avro:"county"`
+	State    string  `json:"state" avro:"state"`
+	Lat      float64 `json:"lat" avro:"lat"`
+	Lon      float64 `json:"lon" avro:"lon"`
+	Comments string  `json:"comments" avro:"comments"`
+}
+
+type Hail struct {
+	Report
+	// Size is the SPC size in hundredths of an inch. SizeIn and SizeMm are
+	// nil when it is unknown.
+	Size   string   `json:"size" avro:"size"`
+	SizeIn *float64 `json:"size_in" avro:"size_in"`
+	SizeMm *float64 `json:"size_mm" avro:"size_mm"`
+}
+
+type Wind struct {
+	Report
+	// Speed is the SPC speed in mph, with an E (estimated) or M (measured)
+	// prefix. SpeedMph and SpeedKts are nil when SpeedUnknown is set.
+	Speed          string   `json:"speed" avro:"speed"`
+	SpeedMph       *float64 `json:"speed_mph" avro:"speed_mph"`
+	SpeedKts       *float64 `json:"speed_kts" avro:"speed_kts"`
+	SpeedEstimated bool     `json:"speed_estimated" avro:"speed_estimated"`
+	SpeedUnknown   bool     `json:"speed_unknown" avro:"speed_unknown"`
+}
+
+type Tornado struct {
+	Report
+	// FScale is the SPC rating. Rating is nil for unrated tornadoes,
+	// RatingScale is EF or F.
+	FScale      string `json:"f_scale" avro:"f_scale"`
+	Rating      *int   `json:"rating" avro:"rating"`
+	RatingScale string `json:"rating_scale" avro:"rating_scale"`
+}
+
+// envelopeJson is the JSON form of an Envelope.
+type envelopeJson struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventId       string          `json:"event_id"`
+	Type          string          `json:"type"`
+	Source        string          `json:"source"`
+	EmittedAt     *time.Time      `json:"emitted_at,omitempty"`
+	EventTime     time.Time       `json:"event_time"`
+	ConvectiveDay string          `json:"convective_day"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+// payload returns the payload matching the type of e.
+func (e Envelope) payload() (interface{}, error) {
+	var payload interface{}
+	var set bool
+	switch e.Type {
+	case TypeHail:
+		payload, set = e.Hail, e.Hail != nil
+	case TypeWind:
+		payload, set = e.Wind, e.Wind != nil
+	case TypeTornado:
+		payload, set = e.Tornado, e.Tornado != nil
+	default:
+		return nil, errors.New("Unknown storm type " + e.Type)
+	}
+	if !set {
+		return nil, errors.New("Envelope has no " + e.Type + " payload")
+	}
+	return payload, nil
+}
+
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	payload, err := e.payload()
+	if err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	out := envelopeJson{
+		SchemaVersion: e.SchemaVersion,
+		EventId:       e.EventId,
+		Type:          e.Type,
+		Source:        e.Source,
+		EventTime:     e.EventTime.UTC(),
+		ConvectiveDay: e.ConvectiveDay,
+		Payload:       raw,
+	}
+	if !e.EmittedAt.IsZero() {
+		emittedAt := e.EmittedAt.UTC()
+		out.EmittedAt = &emittedAt
+	}
+	return json.Marshal(out)
+}
+
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	var in envelopeJson
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	*e = Envelope{
+		SchemaVersion: in.SchemaVersion,
+		EventId:       in.EventId,
+		Type:          in.Type,
+		Source:        in.Source,
+		EventTime:     in.EventTime,
+		ConvectiveDay: in.ConvectiveDay,
+	}
+	if in.EmittedAt != nil {
+		e.EmittedAt = *in.EmittedAt
+	}
+	var payload interface{}
+	switch in.Type {
+	case TypeHail:
+		e.Hail = &Hail{}
+		payload = e.Hail
+	case TypeWind:
+		e.Wind = &Wind{}
+		payload = e.Wind
+	case TypeTornado:
+		e.Tornado = &Tornado{}
+		payload = e.Tornado
+	default:
+		return errors.New("Unknown storm type " + in.Type)
+	}
+	if len(in.Payload) == 0 || string(in.Payload) == "null" {
+		return errors.New("Envelope has no " + in.Type + " payload")
+	}
+	return json.Unmarshal(in.Payload, payload)
+}
+
+// Validate checks that e can be read by consumers of SchemaVersion.
+func (e Envelope) Validate() error {
+	if e.SchemaVersion < 1 || e.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("Unsupported schema version %d, expected 1 to %d", e.SchemaVersion, SchemaVersion)
+	}
+	if e.EventId == "" {
+		return errors.New("Envelope has no event ID")
+	}
+	if e.EventTime.IsZero() {
+		return errors.New("Envelope has no event time")
+	}
+	if _, err := e.payload(); err != nil {
+		return err
+	}
+	payloads := 0
+	for _, set := range []bool{e.Hail != nil, e.Wind != nil, e.Tornado != nil} {
+		if set {
+			payloads++
+		}
+	}
+	if payloads > 1 {
+		return errors.New("Envelope has more than one payload")
+	}
+	return nil
+}
+
+// Encode validates e and returns its JSON form.
+func Encode(e Envelope) ([]byte, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Encoder writes envelopes in the format of a topic.
+type Encoder interface {
+	Encode(e Envelope) ([]byte, error)
+}
+
+// JsonEncoder writes envelopes with Encode.
+type JsonEncoder struct{}
+
+func (JsonEncoder) Encode(e Envelope) ([]byte, error) {
+	return Encode(e)
+}
+
+// Decode reads and validates an envelope. Messages published before the
+// envelope return ErrUnversioned.
+func Decode(data []byte) (Envelope, error) {
+	var version struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return Envelope{}, errors.New("Unable to parse message: " + err.Error())
+	}
+	if version.SchemaVersion == nil {
+		return Envelope{}, ErrUnversioned
+	}
+	if *version.SchemaVersion < 1 || *version.SchemaVersion > SchemaVersion {
+		return Envelope{}, fmt.Errorf("Unsupported schema version %d, expected 1 to %d", *version.SchemaVersion, SchemaVersion)
+	}
+	var e Envelope
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Envelope{}, errors.New("Unable to parse message: " + err.Error())
+	}
+	return e, e.Validate()
+}
@@ -0,0 +1,74 @@
+package event_test
+
+import (
+	"os"
+	"testing"
+
+	"weather-contract/event"
+	"weather-contract/event/eventtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRoundTrip pins the wire format of every storm type to the files in
+// testdata, which consumers still on an older build have to keep reading.
+func TestRoundTrip(t *testing.T) {
+	for _, envelope := range eventtest.Envelopes() {
+		expected, err := os.ReadFile("testdata/" + envelope.Type + ".json")
+		assert.Nil(t, err)
+
+		data, err := event.Encode(envelope)
+		assert.Nil(t, err)
+		assert.JSONEq(t, string(expected), string(data), envelope.Type)
+
+		decoded, err := event.Decode(expected)
+		assert.Nil(t, err)
+		assert.Equal(t, envelope, decoded)
+	}
+}
+
+type decodeCase struct {
+	message     string
+	expectedErr string
+}
+
+func TestDecode(t *testing.T) {
+	testCases := []decodeCase{
+		{message: `not json`, expectedErr: "Unable to parse message: invalid character 'o' in literal null (expecting 'u')"},
+		{message: `{"StormType": "hail", "EventId": "4f1c", "Size": "175"}`, expectedErr: event.ErrUnversioned.Error()},
+		{message: `{"schema_version": 2, "event_id": "4f1c", "type": "hail", "event_time": "2024-05-06T20:10:00Z", "payload": {}}`,
+			expectedErr: "Unsupported schema version 2, expected 1 to 1"},
+		{message: `{"schema_version": 1, "event_id": "4f1c", "type": "hail", "event_time": "2024-05-06T20:10:00Z", "payload": {"size": "175"}}`},
+		{message: `{"schema_version": 1, "event_id": "4f1c", "type": "funnel", "event_time": "2024-05-06T20:10:00Z", "payload": {}}`,
+			expectedErr: "Unable to parse message: Unknown storm type funnel"},
+		{message: `{"schema_version": 1, "event_id": "4f1c", "type": "hail", "event_time": "2024-05-06T20:10:00Z"}`,
+			expectedErr: "Unable to parse message: Envelope has no hail payload"},
+		{message: `{"schema_version": 1, "type": "hail", "event_time": "2024-05-06T20:10:00Z", "payload": {}}`,
+			expectedErr: "Envelope has no event ID"},
+		{message: `{"schema_version": 1, "event_id": "4f1c", "type": "hail", "payload": {}}`,
+			expectedErr: "Envelope has no event time"},
+		// Coordinates are numbers, not strings.
+		{message: `{"schema_version": 1, "event_id": "4f1c", "type": "tornado", "event_time": "2024-05-06T22:05:00Z", "payload": {"lat": "36.53"}}`,
+			expectedErr: "Unable to parse message: json: cannot unmarshal string into Go struct field Tornado.lat of type float64"},
+	}
+	for _, tc := range testCases {
+		_, err := event.Decode([]byte(tc.message))
+		if tc.expectedErr == "" {
+			assert.Nil(t, err, tc.message)
+		} else {
+			assert.EqualError(t, err, tc.expectedErr, tc.message)
+		}
+	}
+}
+
+func TestEncodeRejectsInvalidEnvelopes(t *testing.T) {
+	envelope := eventtest.Envelopes()[0]
+	envelope.Wind = eventtest.Envelopes()[1].Wind
+	_, err := event.Encode(envelope)
+	assert.EqualError(t, err, "Envelope has more than one payload")
+
+	envelope = eventtest.Envelopes()[2]
+	envelope.SchemaVersion = 0
+	_, err = event.Encode(envelope)
+	assert.EqualError(t, err, "Unsupported schema version 0, expected 1 to 1")
+}
@@ -0,0 +1,67 @@
+// Package eventtest provides envelopes of every storm type for the contract
+// tests of the services that publish and consume them.
+package eventtest
+
+import (
+	"time"
+
+	"weather-contract/event"
+)
+
+func float(value float64) *float64 {
+	return &value
+}
+
+// Envelopes returns a hail, a wind and a tornado envelope with every field
+// set.
+func Envelopes() []event.Envelope {
+	rating := 2
+	return []event.Envelope{
+		{
+			SchemaVersion: event.SchemaVersion,
+			EventId:       "4f1c2b0e9d8a7c6b5a4f3e2d1c0b9a88",
+			Type:          event.TypeHail,
+			Source:        "spc",
+			EmittedAt:     time.Date(2024, 5, 7, 0, 0, 0, 123000000, time.UTC),
+			EventTime:     time.Date(2024, 5, 6, 20, 10, 0, 0, time.UTC),
+			ConvectiveDay: "2024-05-06",
+			Hail: &event.Hail{
+				Report: event.Report{Location: "2 N NORMAN", County: "CLEVELAND", State: "OK", Lat: 35.22, Lon: -97.44, Comments: "Golf ball hail. (OUN)"},
+				Size:   "175",
+				SizeIn: float(1.75),
+				SizeMm: float(44.5),
+			},
+		},
+		{
+			SchemaVersion: event.SchemaVersion,
+			EventId:       "9a0b1c2d3e4f5a6b7c8d9e0f1a2b3c44",
+			Type:          event.TypeWind,
+			Source:        "calendar",
+			EmittedAt:     time.Date(2024, 5, 7, 3, 0, 0, 0, time.UTC),
+			EventTime:     time.Date(2024, 5, 7, 1, 30, 0, 0, time.UTC),
+			ConvectiveDay: "2024-05-07",
+			Wind: &event.Wind{
+				Report:         event.Report{Location: "MOORE", County: "CLEVELAND", State: "OK", Lat: 35.34, Lon: -97.49, Comments: "Large tree limbs down. (OUN)"},
+				Speed:          "E60",
+				SpeedMph:       float(60),
+				SpeedKts:       float(52.1),
+				SpeedEstimated: true,
+			},
+		},
+		{
+			SchemaVersion: event.SchemaVersion,
+			EventId:       "c3d4e5f6a7b8c9d0e1f2a3b4c5d6e7f8",
+			Type:          event.TypeTornado,
+			Source:        "spc",
+			EmittedAt:     time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC),
+			EventTime:     time.Date(2024, 5, 6, 22, 5, 0, 0, time.UTC),
+			ConvectiveDay: "2024-05-06",
+			Tornado: &event.Tornado{
+				Report:      event.Report{Location: "4 SW BARNSDALL", County: "OSAGE", State: "OK", Lat: 36.53, Lon: -96.19, Comments: "EF2 damage to homes. (TSA)"},
+				FScale:      "EF2",
+				Rating:      &rating,
+				RatingScale: "EF",
+			},
+		},
+	}
+}
@@ -0,0 +1,178 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+// Mock is an in-memory registry of Avro schemas serving the endpoints the
+// Client uses, for tests and local runs. Like the default of the Confluent
+// registry it enforces backward compatibility: a new version of a subject
+// must be able to read messages written with the latest one.
+type Mock struct {
+	mu       sync.Mutex
+	schemas  []string
+	subjects map[string][]int
+}
+
+func NewMock() *Mock {
+	return &Mock{subjects: make(map[string][]int)}
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parts := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(parts) == 3 && parts[0] == "schemas" && parts[1] == "ids":
+		id, err := strconv.Atoi(parts[2])
+		if err != nil || id < 1 || id > len(m.schemas) {
+			writeError(w, http.StatusNotFound, 40403, "Schema "+parts[2]+" not found")
+			return
+		}
+		writeJson(w, map[string]string{"schema": m.schemas[id-1]})
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[0] == "subjects" && parts[2] == "versions" && parts[3] == "latest":
+		subject, latest, ok := m.latest(w, parts[1])
+		if !ok {
+			return
+		}
+		versions := m.subjects[subject]
+		writeJson(w, Subject{Subject: subject, Version: len(versions), Id: versions[len(versions)-1], Schema: latest})
+	case r.Method == http.MethodPost && len(parts) == 3 && parts[0] == "subjects" && parts[2] == "versions":
+		subject, err := url.PathUnescape(parts[1])
+		if err != nil {
+			writeError(w, http.StatusNotFound, 40401, "Subject '"+parts[1]+"' not found.")
+			return
+		}
+		schema, ok := readSchema(w, r)
+		if !ok {
+			return
+		}
+		m.register(w, subject, schema)
+	case r.Method == http.MethodPost && len(parts) == 5 && parts[0] == "compatibility" && parts[1] == "subjects" && parts[4] == "latest":
+		_, latest, ok := m.latest(w, parts[2])
+		if !ok {
+			return
+		}
+		schema, ok := readSchema(w, r)
+		if !ok {
+			return
+		}
+		result := map[string]interface{}{"is_compatible": true, "messages": []string{}}
+		if err := backwardCompatible(schema, latest); err != nil {
+			result = map[string]interface{}{"is_compatible": false, "messages": []string{err.Error()}}
+		}
+		writeJson(w, result)
+	default:
+		writeError(w, http.StatusNotFound, 404, "HTTP 404 Not Found")
+	}
+}
+
+// latest returns the latest schema of the escaped subject, or writes a not
+// found error.
+func (m *Mock) latest(w http.ResponseWriter, escaped string) (string, string, bool) {
+	subject, err := url.PathUnescape(escaped)
+	versions := m.subjects[subject]
+	if err != nil || len(versions) == 0 {
+		writeError(w, http.StatusNotFound, 40401, "Subject '"+escaped+"' not found.")
+		return "", "", false
+	}
+	return subject, m.schemas[versions[len(versions)-1]-1], true
+}
+
+func (m *Mock) register(w http.ResponseWriter, subject string, schema string) {
+	parsed, err := parse(schema)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema: "+err.Error())
+		return
+	}
+	// Schemas are told apart by their canonical form, as the registry does,
+	// and stored as they were sent.
+	canonical := parsed.String()
+	versions := m.subjects[subject]
+	for _, id := range versions {
+		if m.canonical(id) == canonical {
+			writeJson(w, map[string]int{"id": id})
+			return
+		}
+	}
+	if len(versions) > 0 {
+		if err := backwardCompatible(schema, m.schemas[versions[len(versions)-1]-1]); err != nil {
+			writeError(w, http.StatusConflict, 409, "Schema being registered is incompatible with an earlier schema for subject \""+subject+"\": "+err.Error())
+			return
+		}
+	}
+	id := 0
+	for i := range m.schemas {
+		if m.canonical(i+1) == canonical {
+			id = i + 1
+			break
+		}
+	}
+	if id == 0 {
+		m.schemas = append(m.schemas, schema)
+		id = len(m.schemas)
+	}
+	m.subjects[subject] = append(versions, id)
+	writeJson(w, map[string]int{"id": id})
+}
+
+func (m *Mock) canonical(id int) string {
+	schema, err := parse(m.schemas[id-1])
+	if err != nil {
+		return ""
+	}
+	return schema.String()
+}
+
+// backwardCompatible checks that schema can read messages written with
+// latest.
+func backwardCompatible(schema string, latest string) error {
+	reader, err := parse(schema)
+	if err != nil {
+		return err
+	}
+	writer, err := parse(latest)
+	if err != nil {
+		return err
+	}
+	return avro.NewSchemaCompatibility().Compatible(reader, writer)
+}
+
+// parse parses schema on its own, since named types differ between versions.
+func parse(schema string) (avro.Schema, error) {
+	return avro.ParseWithCache(schema, "", &avro.SchemaCache{})
+}
+
+func readSchema(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var body struct {
+		Schema     string `json:"schema"`
+		SchemaType string `json:"schemaType"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Schema == "" {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "Invalid schema")
+		return "", false
+	}
+	if body.SchemaType != "" && body.SchemaType != "AVRO" {
+		writeError(w, http.StatusUnprocessableEntity, 42201, "Only Avro schemas are supported")
+		return "", false
+	}
+	return body.Schema, true
+}
+
+func writeJson(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, code int, message string) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Error{Code: code, Message: message})
+}
@@ -0,0 +1,177 @@
+// Package registry is a client of the Confluent schema registry REST API and
+// of its wire format, in which every message starts with the ID of the schema
+// it was written with.
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrIncompatible is returned for a schema that breaks the compatibility of
+// its subject.
+var ErrIncompatible = errors.New("Schema is incompatible")
+
+const contentType = "application/vnd.schemaregistry.v1+json"
+
+// Error is an error response of the registry.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("Schema registry returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a registry response for a subject,
+// version or schema that does not exist.
+func IsNotFound(err error) bool {
+	var registryErr *Error
+	return errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusNotFound
+}
+
+// Subject is a version of a schema registered under a subject.
+type Subject struct {
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	Id      int    `json:"id"`
+	Schema  string `json:"schema"`
+}
+
+// Client talks to a registry over HTTP. Schemas looked up by ID never change,
+// so they are cached.
+type Client struct {
+	url  string
+	http *http.Client
+
+	mu      sync.Mutex
+	schemas map[int]string
+}
+
+// NewClient returns a client of the registry at address. User info in the
+// address is sent as basic auth.
+func NewClient(address string) *Client {
+	return &Client{
+		url:     strings.TrimSuffix(address, "/"),
+		http:    &http.Client{Timeout: 10 * time.Second},
+		schemas: make(map[int]string),
+	}
+}
+
+// Register registers schema under subject, or finds it when it already is,
+// and returns its ID.
+func (c *Client) Register(ctx context.Context, subject string, schema string) (int, error) {
+	var registered struct {
+		Id int `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", map[string]string{"schema": schema}, &registered)
+	var registryErr *Error
+	if errors.As(err, &registryErr) && registryErr.StatusCode == http.StatusConflict {
+		return 0, fmt.Errorf("%w with %s: %s", ErrIncompatible, subject, registryErr.Message)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return registered.Id, nil
+}
+
+// Schema returns the schema registered with id.
+func (c *Client) Schema(ctx context.Context, id int) (string, error) {
+	c.mu.Lock()
+	schema, ok := c.schemas[id]
+	c.mu.Unlock()
+	if ok {
+		return schema, nil
+	}
+	var found struct {
+		Schema string `json:"schema"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &found); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.schemas[id] = found.Schema
+	c.mu.Unlock()
+	return found.Schema, nil
+}
+
+// Latest returns the latest version registered under subject.
+func (c *Client) Latest(ctx context.Context, subject string) (Subject, error) {
+	var latest Subject
+	err := c.do(ctx, http.MethodGet, "/subjects/"+url.PathEscape(subject)+"/versions/latest", nil, &latest)
+	return latest, err
+}
+
+// CheckCompatibility checks schema against the latest version of subject at
+// the compatibility level of the registry, and returns ErrIncompatible with
+// the reasons when it fails. Any schema is compatible with a new subject.
+func (c *Client) CheckCompatibility(ctx context.Context, subject string, schema string) error {
+	var result struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest?verbose=true"
+	err := c.do(ctx, http.MethodPost, path, map[string]string{"schema": schema}, &result)
+	if IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !result.IsCompatible {
+		return fmt.Errorf("%w with %s: %s", ErrIncompatible, subject, strings.Join(result.Messages, "; "))
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, reader)
+	if err != nil {
+		return errors.New("Unable to build schema registry request: " + err.Error())
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if req.URL.User != nil {
+		password, _ := req.URL.User.Password()
+		req.SetBasicAuth(req.URL.User.Username(), password)
+		req.URL.User = nil
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.New("Unable to reach schema registry: " + err.Error())
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		registryErr := &Error{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(registryErr); err != nil || registryErr.Message == "" {
+			registryErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return registryErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.New("Unable to read schema registry response: " + err.Error())
+	}
+	return nil
+}
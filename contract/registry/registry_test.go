@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	reportV1 = `{"type": "record", "name": "Report", "fields": [{"name": "location", "type": "string"}]}`
+	// reportV2 adds a field with a default, so it reads messages of v1.
+	reportV2 = `{"type": "record", "name": "Report", "fields": [{"name": "location", "type": "string"},
+		{"name": "county", "type": "string", "default": ""}]}`
+	// reportV3 adds a field without one.
+	reportV3 = `{"type": "record", "name": "Report", "fields": [{"name": "location", "type": "string"},
+		{"name": "state", "type": "string"}]}`
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(NewMock())
+	defer server.Close()
+	client := NewClient(server.URL)
+	ctx := context.Background()
+
+	_, err := client.Latest(ctx, "reports-value")
+	assert.True(t, IsNotFound(err))
+	assert.Nil(t, client.CheckCompatibility(ctx, "reports-value", reportV3))
+
+	v1, err := client.Register(ctx, "reports-value", reportV1)
+	assert.Nil(t, err)
+	again, err := client.Register(ctx, "reports-value", reportV1)
+	assert.Nil(t, err)
+	assert.Equal(t, v1, again)
+
+	assert.Nil(t, client.CheckCompatibility(ctx, "reports-value", reportV2))
+	v2, err := client.Register(ctx, "reports-value", reportV2)
+	assert.Nil(t, err)
+	assert.NotEqual(t, v1, v2)
+
+	err = client.CheckCompatibility(ctx, "reports-value", reportV3)
+	assert.True(t, errors.Is(err, ErrIncompatible))
+	assert.Contains(t, err.Error(), "Schema is incompatible with reports-value: ")
+	_, err = client.Register(ctx, "reports-value", reportV3)
+	assert.True(t, errors.Is(err, ErrIncompatible))
+
+	latest, err := client.Latest(ctx, "reports-value")
+	assert.Nil(t, err)
+	assert.Equal(t, Subject{Subject: "reports-value", Version: 2, Id: v2, Schema: reportV2}, latest)
+	schema, err := client.Schema(ctx, v1)
+	assert.Nil(t, err)
+	assert.Equal(t, reportV1, schema)
+	_, err = client.Schema(ctx, 42)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestClientUnreachable(t *testing.T) {
+	server := httptest.NewServer(NewMock())
+	server.Close()
+	_, err := NewClient(server.URL).Register(context.Background(), "reports-value", reportV1)
+	assert.ErrorContains(t, err, "Unable to reach schema registry: ")
+}
+
+type frameCase struct {
+	data        []byte
+	expectedId  int
+	expectedErr error
+}
+
+func TestUnframe(t *testing.T) {
+	testCases := []frameCase{
+		{data: Frame(7, []byte{2, 4}), expectedId: 7},
+		{data: Frame(70000, nil), expectedId: 70000},
+		{data: []byte(`{"schema_version": 1}`), expectedErr: ErrNotFramed},
+		{data: []byte{0, 0, 1}, expectedErr: ErrNotFramed},
+	}
+	for _, tc := range testCases {
+		id, payload, err := Unframe(tc.data)
+		assert.Equal(t, tc.expectedErr, err)
+		if tc.expectedErr == nil {
+			assert.Equal(t, tc.expectedId, id)
+			assert.Equal(t, tc.data[5:], payload)
+		}
+	}
+}
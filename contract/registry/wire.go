@@ -0,0 +1,38 @@
+package registry
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The wire format is a zero magic byte, the schema ID as a big-endian uint32
+// and the encoded message.
+const (
+	magicByte  = 0
+	headerSize = 5
+)
+
+// ErrNotFramed is returned for messages that are not in the wire format.
+var ErrNotFramed = errors.New("Message is not in the schema registry wire format")
+
+// IsFramed reports whether data starts with the wire format header. JSON
+// never starts with a zero byte.
+func IsFramed(data []byte) bool {
+	return len(data) >= headerSize && data[0] == magicByte
+}
+
+// Frame prefixes payload with the ID of the schema it was written with.
+func Frame(id int, payload []byte) []byte {
+	data := make([]byte, headerSize, headerSize+len(payload))
+	data[0] = magicByte
+	binary.BigEndian.PutUint32(data[1:headerSize], uint32(id))
+	return append(data, payload...)
+}
+
+// Unframe returns the schema ID and the payload of a message.
+func Unframe(data []byte) (int, []byte, error) {
+	if !IsFramed(data) {
+		return 0, nil, ErrNotFramed
+	}
+	return int(binary.BigEndian.Uint32(data[1:headerSize])), data[headerSize:], nil
+}
@@ -0,0 +1,226 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Statuses of a health report and its checks.
+const (
+	StatusOk          string = "ok"
+	StatusFail        string = "fail"
+	StatusUnavailable string = "unavailable"
+)
+
+// partition identifies a partition of a topic.
+type partition struct {
+	topic     string
+	partition int32
+}
+
+// ConsumerHealth records the progress of the consumer loop for the health
+// checks. Times are unix nanoseconds, lastRead zero until a message is read.
+type ConsumerHealth struct {
+	lastPoll      atomic.Int64
+	lastRead      atomic.Int64
+	lastProcessed atomic.Int64
+	mu            sync.Mutex
+	// lag is the lag of each partition when its last message was read.
+	lag map[partition]int64
+}
+
+func NewConsumerHealth() *ConsumerHealth {
+	h := &ConsumerHealth{lag: make(map[partition]int64)}
+	now := time.Now().UnixNano()
+	h.lastPoll.Store(now)
+	h.lastProcessed.Store(now)
+	return h
+}
+
+// Polled records that the loop is about to poll the consumer.
+func (h *ConsumerHealth) Polled() {
+	h.lastPoll.Store(time.Now().UnixNano())
+}
+
+// Read records a message along with the lag of its partition, negative when
+// unknown.
+func (h *ConsumerHealth) Read(msg *kafka.Message, lag int64) {
+	h.lastRead.Store(time.Now().UnixNano())
+	if lag < 0 || msg.TopicPartition.Topic == nil {
+		return
+	}
+	h.mu.Lock()
+	h.lag[partition{topic: *msg.TopicPartition.Topic, partition: msg.TopicPartition.Partition}] = lag
+	h.mu.Unlock()
+}
+
+// Processed records that the messages read so far have been handled, in
+// whatever sense the service gives it.
+func (h *ConsumerHealth) Processed() {
+	h.lastProcessed.Store(time.Now().UnixNano())
+}
+
+// waiting reports whether messages are left to process, either read and not
+// yet handled or behind the last one read from a partition.
+func (h *ConsumerHealth) waiting() bool {
+	if h.lastRead.Load() > h.lastProcessed.Load() {
+		return true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, lag := range h.lag {
+		if lag > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckPoll fails once the loop has gone longer than maxInterval without
+// polling.
+func (h *ConsumerHealth) CheckPoll(maxInterval time.Duration) Check {
+	age := time.Since(time.Unix(0, h.lastPoll.Load())).Round(time.Millisecond)
+	detail := fmt.Sprintf("Last polled %s ago", age)
+	if age > maxInterval {
+		return Failed(detail, fmt.Errorf("Consumer has not polled for over %s", maxInterval))
+	}
+	return Passed(detail)
+}
+
+// CheckLastMessage fails when messages are waiting and none has been
+// processed for longer than maxAge. An idle topic stays ready.
+func (h *ConsumerHealth) CheckLastMessage(maxAge time.Duration) Check {
+	age := time.Since(time.Unix(0, h.lastProcessed.Load())).Round(time.Millisecond)
+	detail := fmt.Sprintf("Last processed %s ago", age)
+	if age > maxAge && h.waiting() {
+		return Failed(detail, fmt.Errorf("Messages are waiting and none was processed for over %s", maxAge))
+	}
+	return Passed(detail)
+}
+
+// HealthChecks holds the thresholds of /healthz and /readyz.
+type HealthChecks struct {
+	// Timeout bounds each dependency check.
+	Timeout time.Duration
+	// MaxPollInterval is how long the consumer loop may go without polling
+	// before the process is reported dead.
+	MaxPollInterval time.Duration
+	// MaxMessageAge is how long messages may wait without any being
+	// processed before the process is reported unready.
+	MaxMessageAge time.Duration
+	// RequireAssignment reports a consumer without partitions unready.
+	RequireAssignment bool
+}
+
+func ParseHealthEnv() (HealthChecks, error) {
+	config := HealthChecks{RequireAssignment: true}
+	var err error
+	config.Timeout, err = parseDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second)
+	if err != nil {
+		return config, err
+	}
+	config.MaxPollInterval, err = parseDuration("HEALTH_MAX_POLL_INTERVAL", 30*time.Second)
+	if err != nil {
+		return config, err
+	}
+	config.MaxMessageAge, err = parseDuration("HEALTH_MAX_MESSAGE_AGE", 5*time.Minute)
+	if err != nil {
+		return config, err
+	}
+	if requireAssignment := os.Getenv("HEALTH_REQUIRE_ASSIGNMENT"); requireAssignment != "" {
+		config.RequireAssignment, err = strconv.ParseBool(requireAssignment)
+		if err != nil {
+			return config, errors.New("HEALTH_REQUIRE_ASSIGNMENT must be true or false.")
+		}
+	}
+	return config, nil
+}
+
+// parseDuration reads a positive duration such as "500ms" or "10s" from key.
+func parseDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.New(key + " must be a positive duration such as 500ms or 10s.")
+	}
+	return duration, nil
+}
+
+// Check is the outcome of one dependency of a health report.
+type Check struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string           `json:"status"`
+	Checks map[string]Check `json:"checks"`
+}
+
+// NewHealthReport sets the status of the report from its checks.
+func NewHealthReport(checks map[string]Check) HealthReport {
+	report := HealthReport{Status: StatusOk, Checks: checks}
+	for _, check := range checks {
+		if check.Status != StatusOk {
+			report.Status = StatusUnavailable
+		}
+	}
+	return report
+}
+
+func Passed(detail string) Check {
+	return Check{Status: StatusOk, Detail: detail}
+}
+
+func Failed(detail string, err error) Check {
+	return Check{Status: StatusFail, Detail: detail, Error: err.Error()}
+}
+
+// MetadataReader is implemented by consumers that can ask the brokers for
+// cluster metadata, as *kafka.Consumer does.
+type MetadataReader interface {
+	GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error)
+}
+
+// AssignmentReader is implemented by consumers that know their assigned
+// partitions, as *kafka.Consumer does.
+type AssignmentReader interface {
+	Assignment() ([]kafka.TopicPartition, error)
+}
+
+// CheckBrokers fails when no broker answers within timeout.
+func CheckBrokers(consumer MetadataReader, timeout time.Duration) Check {
+	metadata, err := consumer.GetMetadata(nil, false, int(timeout.Milliseconds()))
+	if err != nil {
+		return Failed("", err)
+	}
+	if len(metadata.Brokers) == 0 {
+		return Failed("", errors.New("No brokers are available"))
+	}
+	return Passed(fmt.Sprintf("%d brokers", len(metadata.Brokers)))
+}
+
+// CheckAssignment fails when the assignment can't be read, or is empty and
+// required.
+func CheckAssignment(consumer AssignmentReader, required bool) Check {
+	partitions, err := consumer.Assignment()
+	if err != nil {
+		return Failed("", err)
+	}
+	detail := fmt.Sprintf("%d partitions assigned", len(partitions))
+	if len(partitions) == 0 && required {
+		return Failed(detail, errors.New("No partitions are assigned"))
+	}
+	return Passed(detail)
+}
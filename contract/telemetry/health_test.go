@@ -0,0 +1,62 @@
+package telemetry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+type lastMessageCase struct {
+	// processedAgo and readAgo move the last processed and read messages
+	// back in time, zero leaving them as they are.
+	processedAgo   time.Duration
+	readAgo        time.Duration
+	lag            int64
+	expectedStatus string
+}
+
+func TestCheckLastMessage(t *testing.T) {
+	testCases := []lastMessageCase{
+		{expectedStatus: StatusOk},
+		// An idle topic stays ready however long ago the last message was.
+		{processedAgo: time.Hour, expectedStatus: StatusOk},
+		// A message read since has waited too long.
+		{processedAgo: time.Hour, readAgo: 30 * time.Minute, expectedStatus: StatusFail},
+		// So have the messages behind the last one read.
+		{processedAgo: time.Hour, readAgo: 2 * time.Hour, lag: 3, expectedStatus: StatusFail},
+		{processedAgo: time.Hour, readAgo: 2 * time.Hour, lag: -1, expectedStatus: StatusOk},
+	}
+	topic := "transformed-weather-data"
+	for _, tc := range testCases {
+		health := NewConsumerHealth()
+		if tc.readAgo > 0 {
+			health.Read(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}}, tc.lag)
+			health.lastRead.Store(time.Now().Add(-tc.readAgo).UnixNano())
+		}
+		if tc.processedAgo > 0 {
+			health.lastProcessed.Store(time.Now().Add(-tc.processedAgo).UnixNano())
+		}
+		check := health.CheckLastMessage(time.Minute)
+		assert.Equal(t, tc.expectedStatus, check.Status)
+		if tc.expectedStatus == StatusFail {
+			assert.Equal(t, "Messages are waiting and none was processed for over 1m0s", check.Error)
+		}
+	}
+}
+
+func TestCheckPoll(t *testing.T) {
+	health := NewConsumerHealth()
+	assert.Equal(t, StatusOk, health.CheckPoll(time.Minute).Status)
+
+	health.lastPoll.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	check := health.CheckPoll(time.Minute)
+	assert.Equal(t, StatusFail, check.Status)
+	assert.Equal(t, "Consumer has not polled for over 1m0s", check.Error)
+	report := NewHealthReport(map[string]Check{"consumer": check, "kafka": Passed("1 brokers")})
+	assert.Equal(t, StatusUnavailable, report.Status)
+
+	health.Polled()
+	assert.Equal(t, StatusOk, health.CheckPoll(time.Minute).Status)
+}
@@ -0,0 +1,72 @@
+package telemetry
+
+import (
+	"errors"
+	"os"
+	"sync/atomic"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NewLogger builds the JSON logger of the process at LOG_LEVEL, info by
+// default.
+func NewLogger() (*zap.Logger, error) {
+	level := zapcore.InfoLevel
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		var err error
+		level, err = zapcore.ParseLevel(value)
+		if err != nil {
+			return nil, errors.New("LOG_LEVEL must be debug, info, warn or error.")
+		}
+	}
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
+	return config.Build()
+}
+
+// PayloadSampler picks the messages whose raw payload is logged: one in
+// every `every`, none when it is 0.
+type PayloadSampler struct {
+	every uint64
+	count atomic.Uint64
+}
+
+func NewPayloadSampler(every int) *PayloadSampler {
+	return &PayloadSampler{every: uint64(every)}
+}
+
+func (s *PayloadSampler) sample() bool {
+	return s.every > 0 && (s.count.Add(1)-1)%s.every == 0
+}
+
+// MessageFields describe where a message was read from.
+func MessageFields(msg *kafka.Message) []zap.Field {
+	return []zap.Field{
+		zap.String("topic", MessageTopic(msg)),
+		zap.Int32("partition", msg.TopicPartition.Partition),
+		zap.Int64("offset", int64(msg.TopicPartition.Offset)),
+	}
+}
+
+// LogReceived logs msg at debug level, with its payload when sampled.
+func LogReceived(logger *zap.Logger, payloads *PayloadSampler, msg *kafka.Message) {
+	entry := logger.Check(zap.DebugLevel, "Received message")
+	if entry == nil {
+		return
+	}
+	fields := append(MessageFields(msg), zap.ByteString("key", msg.Key))
+	if payloads.sample() {
+		fields = append(fields, zap.ByteString("payload", msg.Value))
+	}
+	entry.Write(fields...)
+}
+
+// MessageTopic is the topic msg was read from, empty when unknown.
+func MessageTopic(msg *kafka.Message) string {
+	if msg.TopicPartition.Topic == nil {
+		return ""
+	}
+	return *msg.TopicPartition.Topic
+}
@@ -0,0 +1,44 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPayloadSampler(t *testing.T) {
+	sampler := NewPayloadSampler(3)
+	var sampled []bool
+	for i := 0; i < 4; i++ {
+		sampled = append(sampled, sampler.sample())
+	}
+	assert.Equal(t, []bool{true, false, false, true}, sampled)
+	assert.False(t, NewPayloadSampler(0).sample())
+}
+
+func TestLogReceived(t *testing.T) {
+	topic := "raw-weather-reports"
+	msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 2, Offset: 7}, Value: []byte(`{"Size": "175"}`)}
+
+	// Raw values are only logged at debug level.
+	core, logs := observer.New(zapcore.InfoLevel)
+	LogReceived(zap.New(core), NewPayloadSampler(1), msg)
+	assert.Equal(t, 0, logs.Len())
+
+	core, logs = observer.New(zapcore.DebugLevel)
+	payloads := NewPayloadSampler(2)
+	LogReceived(zap.New(core), payloads, msg)
+	LogReceived(zap.New(core), payloads, msg)
+	entries := logs.AllUntimed()
+	assert.Len(t, entries, 2)
+	first := entries[0].ContextMap()
+	assert.Equal(t, topic, first["topic"])
+	assert.Equal(t, int32(2), first["partition"])
+	assert.Equal(t, int64(7), first["offset"])
+	assert.Equal(t, `{"Size": "175"}`, first["payload"])
+	assert.NotContains(t, entries[1].ContextMap(), "payload")
+}
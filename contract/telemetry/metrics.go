@@ -0,0 +1,58 @@
+package telemetry
+
+import (
+	"strconv"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ConsumerMetrics count the messages a service reads and the lag of their
+// partitions.
+type ConsumerMetrics struct {
+	Consumed prometheus.Counter
+	Lag      *prometheus.GaugeVec
+}
+
+// NewConsumerMetrics registers the consumer metrics of the service whose
+// metric names start with prefix, as weather_etl does. help describes the
+// messages it reads.
+func NewConsumerMetrics(prefix string, help string) ConsumerMetrics {
+	return ConsumerMetrics{
+		Consumed: promauto.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "_messages_consumed_total",
+			Help: help,
+		}),
+		Lag: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: prefix + "_consumer_lag",
+			Help: "Messages between the last one consumed and the end of its partition.",
+		}, []string{"topic", "partition"}),
+	}
+}
+
+// watermarkReader is implemented by consumers that keep the high watermarks
+// of their partitions, as *kafka.Consumer does from its fetch responses.
+type watermarkReader interface {
+	GetWatermarkOffsets(topic string, partition int32) (low int64, high int64, err error)
+}
+
+// Record counts msg and returns the lag of its partition, -1 when unknown.
+func (m ConsumerMetrics) Record(consumer interface{}, msg *kafka.Message) int64 {
+	m.Consumed.Inc()
+	watermarks, ok := consumer.(watermarkReader)
+	if !ok || msg.TopicPartition.Topic == nil {
+		return -1
+	}
+	topic, partition := *msg.TopicPartition.Topic, msg.TopicPartition.Partition
+	_, high, err := watermarks.GetWatermarkOffsets(topic, partition)
+	if err != nil || high < 0 {
+		return -1
+	}
+	lag := high - int64(msg.TopicPartition.Offset) - 1
+	if lag < 0 {
+		lag = 0
+	}
+	m.Lag.WithLabelValues(topic, strconv.Itoa(int(partition))).Set(float64(lag))
+	return lag
+}
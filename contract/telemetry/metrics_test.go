@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMetrics = NewConsumerMetrics("weather_test", "Messages read in tests.")
+
+// watermarks reports the same high watermark, or error, for every partition.
+type watermarks struct {
+	high int64
+	err  error
+}
+
+func (w watermarks) GetWatermarkOffsets(topic string, partition int32) (int64, int64, error) {
+	return 0, w.high, w.err
+}
+
+type recordCase struct {
+	consumer    interface{}
+	offset      kafka.Offset
+	expectedLag int64
+}
+
+func TestRecord(t *testing.T) {
+	topic := "transformed-weather-data"
+	testCases := []recordCase{
+		{consumer: watermarks{high: 10}, offset: 4, expectedLag: 5},
+		{consumer: watermarks{high: 10}, offset: 9, expectedLag: 0},
+		// The watermark of a fetch response can trail the message read.
+		{consumer: watermarks{high: 10}, offset: 12, expectedLag: 0},
+		{consumer: watermarks{high: -1}, offset: 4, expectedLag: -1},
+		{consumer: watermarks{err: errors.New("Local: Unknown partition")}, offset: 4, expectedLag: -1},
+		{consumer: struct{}{}, offset: 4, expectedLag: -1},
+	}
+	for _, tc := range testCases {
+		consumed := testutil.ToFloat64(testMetrics.Consumed)
+		msg := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: tc.offset}}
+		assert.Equal(t, tc.expectedLag, testMetrics.Record(tc.consumer, msg))
+		assert.Equal(t, consumed+1, testutil.ToFloat64(testMetrics.Consumed))
+		if tc.expectedLag >= 0 {
+			assert.Equal(t, float64(tc.expectedLag), testutil.ToFloat64(testMetrics.Lag.WithLabelValues(topic, "1")))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Package telemetrytest provides the telemetry settings and metric helpers of
+// the services' health check and metrics tests.
+package telemetrytest
+
+import (
+	"testing"
+	"time"
+
+	"weather-contract/telemetry"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+// HealthChecks returns thresholds that a freshly started process passes and
+// that require an assignment.
+func HealthChecks() telemetry.HealthChecks {
+	return telemetry.HealthChecks{Timeout: time.Second, MaxPollInterval: time.Minute, MaxMessageAge: time.Minute, RequireAssignment: true}
+}
+
+// SampleCount is how many values a histogram has observed.
+func SampleCount(t testing.TB, histogram prometheus.Observer) uint64 {
+	var metric dto.Metric
+	assert.Nil(t, histogram.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,159 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace exporters selected by TRACE_EXPORTER.
+const (
+	TraceExporterOtlp   = "otlp"
+	TraceExporterStdout = "stdout"
+	TraceExporterFile   = "file"
+	TraceExporterNone   = "none"
+)
+
+// Tracing selects where spans are exported. The OTLP exporter is configured
+// through the standard OTEL_EXPORTER_OTLP_* variables.
+type Tracing struct {
+	Exporter string
+	// File is the path spans are appended to with the file exporter.
+	File string
+}
+
+// ParseTracingEnv exports over OTLP when a collector endpoint is set, to
+// TRACE_FILE when only that is set and nowhere otherwise, unless
+// TRACE_EXPORTER says differently. Spans only go to stdout when asked, as
+// they would be mixed in with the logs.
+func ParseTracingEnv() (Tracing, error) {
+	config := Tracing{Exporter: TraceExporterNone, File: "traces.json"}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		config.Exporter = TraceExporterOtlp
+	} else if os.Getenv("TRACE_FILE") != "" {
+		config.Exporter = TraceExporterFile
+	}
+	if exporter := os.Getenv("TRACE_EXPORTER"); exporter != "" {
+		switch exporter {
+		case TraceExporterOtlp, TraceExporterStdout, TraceExporterFile, TraceExporterNone:
+			config.Exporter = exporter
+		default:
+			return config, errors.New("TRACE_EXPORTER must be otlp, stdout, file or none.")
+		}
+	}
+	if file := os.Getenv("TRACE_FILE"); file != "" {
+		config.File = file
+	}
+	return config, nil
+}
+
+// Propagator carries the trace context of a report in the W3C traceparent
+// and baggage headers of its Kafka messages.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// InitTracing registers the global tracer provider of service, exporting as
+// config says. The returned function flushes the remaining spans and stops
+// the exporter.
+func InitTracing(config Tracing, service string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+	if config.Exporter == TraceExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch config.Exporter {
+	case TraceExporterOtlp:
+		exporter, err = otlptracehttp.New(context.Background())
+	case TraceExporterFile:
+		file, err = os.OpenFile(config.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, errors.New("Unable to open trace file: " + err.Error())
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		exporter, err = stdouttrace.New()
+	}
+	if err != nil {
+		return nil, errors.New("Unable to create trace exporter: " + err.Error())
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults.
+	res, err := resource.New(context.Background(),
+		resource.WithAttributes(semconv.ServiceName(service)), resource.WithFromEnv())
+	if err != nil {
+		return nil, errors.New("Unable to describe trace resource: " + err.Error())
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// HeaderCarrier reads and writes trace context in Kafka message headers.
+type HeaderCarrier struct {
+	Headers *[]kafka.Header
+}
+
+func (c HeaderCarrier) Get(key string) string {
+	for _, header := range *c.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key string, value string) {
+	for i, header := range *c.Headers {
+		if header.Key == key {
+			(*c.Headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.Headers = append(*c.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.Headers))
+	for _, header := range *c.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
+
+// MessageAttributes describe where a message was read from.
+func MessageAttributes(msg *kafka.Message) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKafka,
+		semconv.MessagingDestinationName(MessageTopic(msg)),
+		semconv.MessagingDestinationPartitionID(strconv.Itoa(int(msg.TopicPartition.Partition))),
+		semconv.MessagingKafkaMessageOffset(int(msg.TopicPartition.Offset)),
+	}
+}
+
+// EndSpan ends span, marking it failed when err is set.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,45 @@
+package telemetry
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestHeaderCarrier(t *testing.T) {
+	headers := []kafka.Header{{Key: "traceparent", Value: []byte("old")}}
+	carrier := HeaderCarrier{Headers: &headers}
+	carrier.Set("traceparent", testTraceParent)
+	carrier.Set("baggage", "storm=hail")
+	assert.Equal(t, testTraceParent, carrier.Get("traceparent"))
+	assert.Equal(t, "", carrier.Get("tracestate"))
+	assert.Equal(t, []string{"traceparent", "baggage"}, carrier.Keys())
+}
+
+type tracingEnvCase struct {
+	endpoint         string
+	exporter         string
+	file             string
+	expectedExporter string
+}
+
+func TestParseTracingEnv(t *testing.T) {
+	testCases := []tracingEnvCase{
+		{expectedExporter: TraceExporterNone},
+		{file: "traces.json", expectedExporter: TraceExporterFile},
+		{endpoint: "http://localhost:4318", file: "traces.json", expectedExporter: TraceExporterOtlp},
+		{exporter: TraceExporterStdout, file: "traces.json", expectedExporter: TraceExporterStdout},
+	}
+	for _, tc := range testCases {
+		t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tc.endpoint)
+		t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+		t.Setenv("TRACE_EXPORTER", tc.exporter)
+		t.Setenv("TRACE_FILE", tc.file)
+		config, err := ParseTracingEnv()
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expectedExporter, config.Exporter)
+	}
+}
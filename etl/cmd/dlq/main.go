@@ -0,0 +1,168 @@
+// Command dlq inspects the ETL dead-letter topic and re-injects selected
+// messages into the raw report topic once the cause has been fixed.
+//
+//	go run cmd/dlq/main.go list [-stage STAGE] [-payload]
+//	go run cmd/dlq/main.go replay [-stage STAGE] [-offsets P:O,P:O] [-all] [-dry-run]
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"weather-etl/internal/storm"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: dlq <command> [flags]
+
+commands:
+  list     show dead-lettered messages and why they failed
+  replay   re-inject selected dead-lettered messages into KAFKA_CONSUMER_TOPIC
+`
+
+type position struct {
+	partition int32
+	offset    int64
+}
+
+// parseOffsets parses a comma separated list of partition:offset pairs.
+func parseOffsets(value string) (map[position]bool, error) {
+	offsets := make(map[position]bool)
+	if value == "" {
+		return offsets, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(pair), ":")
+		if len(parts) != 2 {
+			return nil, errors.New("offset " + pair + " must be in the format partition:offset")
+		}
+		partition, err := strconv.ParseInt(parts[0], 10, 32)
+		if err != nil {
+			return nil, errors.New("invalid partition in " + pair)
+		}
+		offset, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid offset in " + pair)
+		}
+		offsets[position{partition: int32(partition), offset: offset}] = true
+	}
+	return offsets, nil
+}
+
+func list(config storm.Kakfa, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	stage := flags.String("stage", "", "only show messages that failed at this stage")
+	showPayload := flags.Bool("payload", false, "print the original payload of each message")
+	timeout := flags.Duration("timeout", 10*time.Second, "time to wait for the broker")
+	flags.Parse(args)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "PARTITION:OFFSET\tSOURCE\tSTAGE\tFAILED AT\tERROR")
+	count := 0
+	err := storm.ReadDeadLetters(config, *timeout, func(dl storm.DeadLetter) error {
+		if *stage != "" && dl.Stage != *stage {
+			return nil
+		}
+		count++
+		fmt.Fprintf(writer, "%d:%d\t%s/%d/%d\t%s\t%s\t%s\n",
+			dl.Partition, dl.Offset, dl.SourceTopic, dl.SourcePartition, dl.SourceOffset,
+			dl.Stage, dl.FailedAt.Format(time.RFC3339), dl.Error)
+		if *showPayload {
+			fmt.Fprintf(writer, "\t%s\n", string(dl.Payload))
+		}
+		return nil
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d dead-lettered messages on %s\n", count, config.DeadLetterTopic)
+	return nil
+}
+
+func replay(config storm.Kakfa, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	stage := flags.String("stage", "", "replay messages that failed at this stage")
+	offsetList := flags.String("offsets", "", "replay these partition:offset pairs, comma separated")
+	all := flags.Bool("all", false, "replay every dead-lettered message")
+	dryRun := flags.Bool("dry-run", false, "show what would be replayed without producing")
+	timeout := flags.Duration("timeout", 10*time.Second, "time to wait for the broker")
+	flags.Parse(args)
+
+	offsets, err := parseOffsets(*offsetList)
+	if err != nil {
+		return err
+	}
+	if !*all && *stage == "" && len(offsets) == 0 {
+		return errors.New("replay needs -offsets, -stage or -all")
+	}
+
+	producer, err := kafka.NewProducer(&kafka.ConfigMap{
+		"bootstrap.servers": config.Broker})
+	if err != nil {
+		return errors.New("Unable to create kakfa producer")
+	}
+	defer producer.Close()
+
+	count := 0
+	err = storm.ReadDeadLetters(config, *timeout, func(dl storm.DeadLetter) error {
+		if *stage != "" && dl.Stage != *stage {
+			return nil
+		}
+		if len(offsets) > 0 && !offsets[position{partition: dl.Partition, offset: dl.Offset}] {
+			return nil
+		}
+		count++
+		fmt.Printf("replaying %d:%d (%s) to %s\n", dl.Partition, dl.Offset, dl.Stage, config.ConsumerTopic)
+		if *dryRun {
+			return nil
+		}
+		return storm.ReplayDeadLetter(producer, config.ConsumerTopic, config.DeadLetterTopic, dl)
+	})
+	if err != nil {
+		return err
+	}
+	if remaining := producer.Flush(int(timeout.Milliseconds())); remaining > 0 {
+		return fmt.Errorf("%d replayed messages were not delivered", remaining)
+	}
+	fmt.Printf("%d messages replayed to %s\n", count, config.ConsumerTopic)
+	return nil
+}
+
+func main() {
+	err := godotenv.Load()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if len(os.Args) < 2 {
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	config, err := storm.ParseEnv()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "list":
+		err = list(config, os.Args[2:])
+	case "replay":
+		err = replay(config, os.Args[2:])
+	default:
+		fmt.Print(usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"weather-contract/telemetry"
 	"weather-etl/internal/storm"
 
 	"github.com/joho/godotenv"
+	"go.uber.org/zap"
 )
 
 func main() {
@@ -15,14 +22,76 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	process, err := storm.InitProcess()
+	logger, err := telemetry.NewLogger()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	process.Start(ctx)
+	defer logger.Sync()
+	tracingConfig, err := telemetry.ParseTracingEnv()
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	shutdownTracing, err := telemetry.InitTracing(tracingConfig, "weather-etl")
+	if err != nil {
+		logger.Fatal("Unable to initialize tracing.", zap.Error(err))
+	}
+	// Export the spans of the last messages before exiting.
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Unable to flush traces.", zap.Error(err))
+		}
+	}()
+
+	// Cancel on SIGINT or SIGTERM so the process drains, flushes and commits
+	// before exiting.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	process, err := storm.InitProcess(logger)
+	if err != nil {
+		logger.Fatal("Unable to initialize the process.", zap.Error(err))
+	}
+	serverConfig, err := storm.ParseServerEnv()
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	healthConfig, err := telemetry.ParseHealthEnv()
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	// Serve metrics and health until the process has stopped.
+	server := &http.Server{
+		Addr:    serverConfig.Addr,
+		Handler: storm.NewServeMux(storm.NewHealthChecker(process, healthConfig)),
+	}
+	defer server.Close()
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("HTTP server stopped.", zap.Error(err))
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// A second signal kills the process immediately.
+		stop()
+		select {
+		case err = <-done:
+		case <-time.After(process.ShutdownTimeout):
+			logger.Fatal("Timed out waiting for the service to stop.")
+		}
+	}
+	if err != nil {
+		logger.Fatal("Service stopped.", zap.Error(err))
+	}
 }
@@ -3,15 +3,48 @@ package storm
 import (
 	"errors"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Kakfa struct {
-	Broker        string
-	ConsumerTopic string
-	ProducerTopic string
-	GroupId       string
+	Broker          string
+	ConsumerTopic   string
+	ProducerTopic   string
+	DeadLetterTopic string
+	GroupId         string
+	// ExactlyOnce consumes, transforms and produces inside Kafka transactions
+	// so consumed offsets are committed atomically with the produced messages.
+	ExactlyOnce          bool
+	TransactionalId      string
+	TransactionBatchSize int
+	// Transient delivery failures are retried ProduceMaxRetries times, backing
+	// off exponentially from ProduceRetryBackoff.
+	ProduceMaxRetries   int
+	ProduceRetryBackoff time.Duration
+	// Shutdown waits up to DrainTimeout for messages already read to be
+	// transformed, FlushTimeout for them to be delivered and ShutdownTimeout
+	// for the whole process to stop.
+	DrainTimeout    time.Duration
+	FlushTimeout    time.Duration
+	ShutdownTimeout time.Duration
+	// PayloadSampling logs the raw payload of one consumed message in every
+	// PayloadSampling at debug level, none when 0.
+	PayloadSampling int
+	// Encoding is the format of the transformed messages. Avro messages
+	// carry the ID their schema is registered under in SchemaSubject of the
+	// registry at SchemaRegistryUrl.
+	Encoding          string
+	SchemaRegistryUrl string
+	SchemaSubject     string
 }
 
+// Encodings of the transformed messages selected by MESSAGE_ENCODING.
+const (
+	EncodingJson = "json"
+	EncodingAvro = "avro"
+)
+
 func ParseEnv() (Kakfa, error) {
 	var kafkaConfig Kakfa
 	kafkaConfig.ConsumerTopic = os.Getenv("KAFKA_CONSUMER_TOPIC")
@@ -22,6 +55,10 @@ func ParseEnv() (Kakfa, error) {
 	if kafkaConfig.ProducerTopic == "" {
 		return kafkaConfig, errors.New("kafka producer topic is not set.")
 	}
+	kafkaConfig.DeadLetterTopic = os.Getenv("KAFKA_DLQ_TOPIC")
+	if kafkaConfig.DeadLetterTopic == "" {
+		kafkaConfig.DeadLetterTopic = kafkaConfig.ConsumerTopic + "-dlq"
+	}
 	kafkaConfig.Broker = os.Getenv("KAFKA_ENDPOINT")
 	if kafkaConfig.Broker == "" {
 		kafkaConfig.Broker = "localhost:9092"
@@ -30,5 +67,104 @@ func ParseEnv() (Kakfa, error) {
 	if kafkaConfig.GroupId == "" {
 		kafkaConfig.GroupId = "go-weather-etl"
 	}
+	if exactlyOnce := os.Getenv("KAFKA_EXACTLY_ONCE"); exactlyOnce != "" {
+		enabled, err := strconv.ParseBool(exactlyOnce)
+		if err != nil {
+			return kafkaConfig, errors.New("kafka exactly once must be true or false.")
+		}
+		kafkaConfig.ExactlyOnce = enabled
+	}
+	kafkaConfig.TransactionalId = os.Getenv("KAFKA_TRANSACTIONAL_ID")
+	if kafkaConfig.TransactionalId == "" {
+		kafkaConfig.TransactionalId = kafkaConfig.GroupId + "-txn"
+	}
+	kafkaConfig.TransactionBatchSize = 100
+	if batchSize := os.Getenv("KAFKA_TRANSACTION_BATCH_SIZE"); batchSize != "" {
+		size, err := strconv.Atoi(batchSize)
+		if err != nil || size < 1 {
+			return kafkaConfig, errors.New("kafka transaction batch size must be a positive integer.")
+		}
+		kafkaConfig.TransactionBatchSize = size
+	}
+	kafkaConfig.ProduceMaxRetries = 5
+	if maxRetries := os.Getenv("KAFKA_PRODUCE_MAX_RETRIES"); maxRetries != "" {
+		retries, err := strconv.Atoi(maxRetries)
+		if err != nil || retries < 0 {
+			return kafkaConfig, errors.New("kafka produce max retries must be a non-negative integer.")
+		}
+		kafkaConfig.ProduceMaxRetries = retries
+	}
+	backoff, err := parseDuration("KAFKA_PRODUCE_RETRY_BACKOFF", 500*time.Millisecond)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.ProduceRetryBackoff = backoff
+	drainTimeout, err := parseDuration("ETL_DRAIN_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.DrainTimeout = drainTimeout
+	flushTimeout, err := parseDuration("KAFKA_FLUSH_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.FlushTimeout = flushTimeout
+	shutdownTimeout, err := parseDuration("ETL_SHUTDOWN_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return kafkaConfig, err
+	}
+	kafkaConfig.ShutdownTimeout = shutdownTimeout
+	kafkaConfig.PayloadSampling = 100
+	if sampling := os.Getenv("LOG_PAYLOAD_SAMPLING"); sampling != "" {
+		every, err := strconv.Atoi(sampling)
+		if err != nil || every < 0 {
+			return kafkaConfig, errors.New("LOG_PAYLOAD_SAMPLING must be a non-negative integer.")
+		}
+		kafkaConfig.PayloadSampling = every
+	}
+	kafkaConfig.Encoding = EncodingJson
+	if encoding := os.Getenv("MESSAGE_ENCODING"); encoding != "" {
+		if encoding != EncodingJson && encoding != EncodingAvro {
+			return kafkaConfig, errors.New("MESSAGE_ENCODING must be json or avro.")
+		}
+		kafkaConfig.Encoding = encoding
+	}
+	kafkaConfig.SchemaRegistryUrl = os.Getenv("SCHEMA_REGISTRY_URL")
+	if kafkaConfig.Encoding == EncodingAvro && kafkaConfig.SchemaRegistryUrl == "" {
+		return kafkaConfig, errors.New("SCHEMA_REGISTRY_URL is required with the avro encoding.")
+	}
+	// The registry's default subject name strategy.
+	kafkaConfig.SchemaSubject = os.Getenv("SCHEMA_REGISTRY_SUBJECT")
+	if kafkaConfig.SchemaSubject == "" {
+		kafkaConfig.SchemaSubject = kafkaConfig.ProducerTopic + "-value"
+	}
 	return kafkaConfig, nil
 }
+
+// parseDuration reads a positive duration such as "500ms" or "10s" from key.
+func parseDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, errors.New(key + " must be a positive duration such as 500ms or 10s.")
+	}
+	return duration, nil
+}
+
+// Server configures the HTTP listener serving the metrics and health of the
+// process.
+type Server struct {
+	Addr string
+}
+
+func ParseServerEnv() (Server, error) {
+	var serverConfig Server
+	serverConfig.Addr = os.Getenv("HTTP_ADDR")
+	if serverConfig.Addr == "" {
+		serverConfig.Addr = ":8081"
+	}
+	return serverConfig, nil
+}
@@ -0,0 +1,315 @@
+package storm
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"weather-contract/telemetry"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+)
+
+const maxRetryBackoff = 30 * time.Second
+
+// delivery is attached to every produced message as its Opaque so the
+// delivery report loop knows what the message was produced from and how
+// often it has been retried.
+type delivery struct {
+	Source  *kafka.Message
+	Attempt int
+	// DeadLetter is set on the dead letter of Source, which is dropped
+	// rather than dead lettered again when it can't be delivered.
+	DeadLetter bool
+	// StormType and EmitTs describe the report of a transformed message.
+	StormType string
+	EmitTs    int64
+}
+
+// ErrorSink receives produced messages that permanently failed delivery. It
+// returns an error when it could not take the message over.
+type ErrorSink interface {
+	Send(msg *kafka.Message, err error) error
+}
+
+// deadLetterSink dead letters the raw report behind an undelivered message so
+// it can be replayed. Undelivered dead letters can only be logged.
+type deadLetterSink struct {
+	producer Producer
+	topic    string
+}
+
+func (s deadLetterSink) Send(msg *kafka.Message, err error) error {
+	d, ok := msg.Opaque.(*delivery)
+	if !ok || d.Source == nil {
+		return errors.New("Undelivered message has no report to dead letter")
+	}
+	if d.DeadLetter {
+		return errors.New("Unable to deliver dead letter: " + err.Error())
+	}
+	cause := MessageError{Stage: StageDelivery, Err: errors.New("Unable to deliver message: " + err.Error())}
+	return deadLetter(s.producer, d.Source, s.topic, cause)
+}
+
+// DeliveryStats counts the outcome of produced messages.
+type DeliveryStats struct {
+	Delivered atomic.Int64
+	Retried   atomic.Int64
+	Failed    atomic.Int64
+}
+
+// deliveryTracker reads producer delivery reports, retrying transient
+// failures with exponential backoff and handing permanent ones to the sink.
+type deliveryTracker struct {
+	producer Producer
+	sink     ErrorSink
+	stats    *DeliveryStats
+	health   *telemetry.ConsumerHealth
+	logger   *zap.Logger
+	// transactional trackers leave failures to abort the open transaction.
+	transactional bool
+	maxRetries    int
+	backoff       time.Duration
+	// offsets stores the offset of a report once it is settled, nil when
+	// offsets are committed with transactions.
+	offsets *pendingOffsets
+
+	pending atomic.Int64
+	mu      sync.RWMutex
+	closed  bool
+}
+
+// run handles delivery reports until the producer is closed.
+func (t *deliveryTracker) run() {
+	for event := range t.producer.Events() {
+		switch ev := event.(type) {
+		case *kafka.Message:
+			t.handleReport(ev)
+		case kafka.Error:
+			t.logger.Error("Producer error.", zap.Error(ev))
+		}
+	}
+}
+
+func (t *deliveryTracker) handleReport(msg *kafka.Message) {
+	err := msg.TopicPartition.Error
+	if err == nil {
+		t.stats.Delivered.Add(1)
+		t.health.Processed()
+		recordDelivered(msg)
+		t.settle(msg)
+		return
+	}
+	if t.transactional {
+		t.stats.Failed.Add(1)
+		deliveryFailures.Inc()
+		t.logger.Warn("Delivery failed, the transaction will be aborted.", append(telemetry.MessageFields(msg), zap.Error(err))...)
+		return
+	}
+	attempt := 0
+	if d, ok := msg.Opaque.(*delivery); ok {
+		attempt = d.Attempt
+	}
+	if attempt < t.maxRetries && isTransient(err) {
+		t.stats.Retried.Add(1)
+		deliveryRetries.Inc()
+		t.scheduleRetry(msg, attempt+1)
+		return
+	}
+	t.stats.Failed.Add(1)
+	deliveryFailures.Inc()
+	t.logger.Error("Delivery failed.", append(telemetry.MessageFields(msg), zap.Int("retries", attempt), zap.Error(err))...)
+	t.fail(msg, err)
+}
+
+// fail hands an undelivered message to the sink. A report whose message the
+// sink can't take over is given up on, and settled so that the partition
+// moves on.
+func (t *deliveryTracker) fail(msg *kafka.Message, err error) {
+	if err := t.sink.Send(msg, err); err != nil {
+		t.logger.Error("Dropping undelivered message.", append(telemetry.MessageFields(msg), zap.Error(err))...)
+		t.settle(msg)
+	}
+}
+
+// read starts tracking a report whose transformed message or dead letter is
+// about to be produced.
+func (t *deliveryTracker) read(report *kafka.Message) {
+	if t.offsets != nil {
+		t.offsets.read(report)
+	}
+}
+
+// settle stores the offset of the report behind msg. Nothing is stored once
+// the tracker has been flushed, as the final commit has been made.
+func (t *deliveryTracker) settle(msg *kafka.Message) {
+	d, ok := msg.Opaque.(*delivery)
+	if !ok || d.Source == nil {
+		return
+	}
+	t.settleReport(d.Source)
+}
+
+// settleReport stores the offset of a report that produced no message.
+func (t *deliveryTracker) settleReport(report *kafka.Message) {
+	if t.offsets == nil {
+		return
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	if err := t.offsets.settle(report); err != nil {
+		t.logger.Error("Error storing offset.", append(telemetry.MessageFields(report), zap.Error(err))...)
+	}
+}
+
+// scheduleRetry produces msg again after the backoff for attempt.
+func (t *deliveryTracker) scheduleRetry(msg *kafka.Message, attempt int) {
+	var d delivery
+	if previous, ok := msg.Opaque.(*delivery); ok {
+		d = *previous
+	}
+	d.Attempt = attempt
+	retry := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     msg.TopicPartition.Topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: msg.Headers,
+		Opaque:  &d,
+	}
+	t.pending.Add(1)
+	time.AfterFunc(retryBackoff(t.backoff, attempt), func() {
+		defer t.pending.Add(-1)
+		t.mu.RLock()
+		defer t.mu.RUnlock()
+		if t.closed {
+			t.logger.Warn("Dropping retry after shutdown.", telemetry.MessageFields(retry)...)
+			return
+		}
+		if err := t.producer.Produce(retry, nil); err != nil {
+			t.stats.Failed.Add(1)
+			deliveryFailures.Inc()
+			t.fail(retry, err)
+		}
+	})
+}
+
+// flush waits up to timeout for queued messages and scheduled retries to be
+// delivered, then stops further retries. It returns how many were left over.
+func (t *deliveryTracker) flush(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	remaining := 0
+	for {
+		remaining = t.producer.Flush(100) + int(t.pending.Load())
+		if remaining == 0 || time.Now().After(deadline) {
+			break
+		}
+	}
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+	return remaining
+}
+
+// partition identifies a partition of a topic.
+type partition struct {
+	topic     string
+	partition int32
+}
+
+// pendingOffsets tracks the reports read from each partition until their
+// transformed message or dead letter is acknowledged. Deliveries complete out
+// of order, so the offset stored for a partition stops at its first pending
+// report and a crash replays it rather than committing past it.
+type pendingOffsets struct {
+	consumer Consumer
+
+	mu         sync.Mutex
+	partitions map[partition]*partitionOffsets
+}
+
+type partitionOffsets struct {
+	pending map[kafka.Offset]bool
+	// next is the offset after the last settled report.
+	next kafka.Offset
+}
+
+func newPendingOffsets(consumer Consumer) *pendingOffsets {
+	return &pendingOffsets{consumer: consumer, partitions: make(map[partition]*partitionOffsets)}
+}
+
+func (o *pendingOffsets) read(report *kafka.Message) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := partition{topic: telemetry.MessageTopic(report), partition: report.TopicPartition.Partition}
+	offsets, ok := o.partitions[key]
+	if !ok {
+		offsets = &partitionOffsets{pending: make(map[kafka.Offset]bool)}
+		o.partitions[key] = offsets
+	}
+	offsets.pending[report.TopicPartition.Offset] = true
+}
+
+// settle stores the offset up to which every report of the partition of
+// report has been settled.
+func (o *pendingOffsets) settle(report *kafka.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := partition{topic: telemetry.MessageTopic(report), partition: report.TopicPartition.Partition}
+	offsets, ok := o.partitions[key]
+	if !ok || !offsets.pending[report.TopicPartition.Offset] {
+		return nil
+	}
+	delete(offsets.pending, report.TopicPartition.Offset)
+	if report.TopicPartition.Offset+1 > offsets.next {
+		offsets.next = report.TopicPartition.Offset + 1
+	}
+	store := offsets.next
+	for offset := range offsets.pending {
+		if offset < store {
+			store = offset
+		}
+	}
+	_, err := o.consumer.StoreOffsets([]kafka.TopicPartition{{
+		Topic:     report.TopicPartition.Topic,
+		Partition: report.TopicPartition.Partition,
+		Offset:    store,
+	}})
+	return err
+}
+
+// retryBackoff doubles base for every attempt after the first.
+func retryBackoff(base time.Duration, attempt int) time.Duration {
+	backoff := base
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff
+}
+
+// isTransient reports whether a delivery error is worth retrying.
+func isTransient(err error) bool {
+	var kafkaErr kafka.Error
+	if !errors.As(err, &kafkaErr) {
+		return false
+	}
+	if kafkaErr.IsRetriable() {
+		return true
+	}
+	switch kafkaErr.Code() {
+	case kafka.ErrMsgTimedOut, kafka.ErrTimedOut, kafka.ErrTransport, kafka.ErrAllBrokersDown,
+		kafka.ErrQueueFull, kafka.ErrLeaderNotAvailable, kafka.ErrNotLeaderForPartition,
+		kafka.ErrRequestTimedOut, kafka.ErrNotEnoughReplicas, kafka.ErrNotEnoughReplicasAfterAppend:
+		return true
+	}
+	return false
+}
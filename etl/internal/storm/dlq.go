@@ -0,0 +1,217 @@
+package storm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Stages at which a raw report can be rejected by the ETL.
+const (
+	StageParse     string = "parse"
+	StageEventTime string = "event_time"
+	StageInvalid   string = "invalid_storm"
+	StageMarshal   string = "marshal"
+	StageProduce   string = "produce"
+	StageDelivery  string = "delivery"
+	StageUnknown   string = "unknown"
+)
+
+// Kafka header keys carried on dead-lettered messages.
+const (
+	HeaderSourceTopic     string = "dlq-source-topic"
+	HeaderSourcePartition string = "dlq-source-partition"
+	HeaderSourceOffset    string = "dlq-source-offset"
+	HeaderFailureStage    string = "dlq-failure-stage"
+	HeaderError           string = "dlq-error"
+	HeaderFailedAt        string = "dlq-failed-at"
+	HeaderReplayedFrom    string = "dlq-replayed-from"
+)
+
+// MessageError records the stage at which a message was rejected.
+type MessageError struct {
+	Stage string
+	Err   error
+}
+
+func (e MessageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e MessageError) Unwrap() error {
+	return e.Err
+}
+
+// DeadLetter is a rejected raw report read back from the dead-letter topic.
+type DeadLetter struct {
+	Partition       int32
+	Offset          int64
+	SourceTopic     string
+	SourcePartition int32
+	SourceOffset    int64
+	Stage           string
+	Error           string
+	FailedAt        time.Time
+	Payload         []byte
+}
+
+// failureStage returns the stage recorded on err, or StageUnknown.
+func failureStage(err error) string {
+	var msgErr MessageError
+	if errors.As(err, &msgErr) {
+		return msgErr.Stage
+	}
+	return StageUnknown
+}
+
+// newDeadLetterMessage wraps the original payload of msg for the dead-letter
+// topic, describing where it came from and why it failed in the headers.
+func newDeadLetterMessage(msg *kafka.Message, topic string, cause error) *kafka.Message {
+	var sourceTopic string
+	if msg.TopicPartition.Topic != nil {
+		sourceTopic = *msg.TopicPartition.Topic
+	}
+	return &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: kafka.PartitionAny,
+		},
+		Key:   msg.Key,
+		Value: msg.Value,
+		Headers: []kafka.Header{
+			{Key: HeaderSourceTopic, Value: []byte(sourceTopic)},
+			{Key: HeaderSourcePartition, Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Partition), 10))},
+			{Key: HeaderSourceOffset, Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))},
+			{Key: HeaderFailureStage, Value: []byte(failureStage(cause))},
+			{Key: HeaderError, Value: []byte(cause.Error())},
+			{Key: HeaderFailedAt, Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+		},
+	}
+}
+
+// deadLetter publishes a rejected message to the dead-letter topic.
+func deadLetter(kp Producer, msg *kafka.Message, topic string, cause error) error {
+	messagesRejected.WithLabelValues(failureStage(cause)).Inc()
+	dlqMsg := newDeadLetterMessage(msg, topic, cause)
+	dlqMsg.Opaque = &delivery{Source: msg, DeadLetter: true}
+	if err := kp.Produce(dlqMsg, nil); err != nil {
+		return errors.New("Unable to publish to " + topic + ": " + err.Error())
+	}
+	return nil
+}
+
+// ParseDeadLetter reads the failure details back out of a dead-lettered message.
+func ParseDeadLetter(msg *kafka.Message) (DeadLetter, error) {
+	dl := DeadLetter{
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Payload:   msg.Value,
+	}
+	for _, header := range msg.Headers {
+		value := string(header.Value)
+		switch header.Key {
+		case HeaderSourceTopic:
+			dl.SourceTopic = value
+		case HeaderSourcePartition:
+			partition, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return dl, errors.New("Unable to parse source partition header: " + err.Error())
+			}
+			dl.SourcePartition = int32(partition)
+		case HeaderSourceOffset:
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return dl, errors.New("Unable to parse source offset header: " + err.Error())
+			}
+			dl.SourceOffset = offset
+		case HeaderFailureStage:
+			dl.Stage = value
+		case HeaderError:
+			dl.Error = value
+		case HeaderFailedAt:
+			failedAt, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return dl, errors.New("Unable to parse failed at header: " + err.Error())
+			}
+			dl.FailedAt = failedAt
+		}
+	}
+	if dl.Stage == "" {
+		return dl, errors.New("Message is missing the " + HeaderFailureStage + " header")
+	}
+	return dl, nil
+}
+
+// ReadDeadLetters reads every message currently on the dead-letter topic from
+// the beginning, without committing offsets, and calls fn for each one.
+func ReadDeadLetters(config Kakfa, timeout time.Duration, fn func(DeadLetter) error) error {
+	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+		"bootstrap.servers":    config.Broker,
+		"group.id":             config.GroupId + "-dlq",
+		"enable.auto.commit":   false,
+		"enable.partition.eof": true,
+		"auto.offset.reset":    "smallest"})
+	if err != nil {
+		return errors.New("Unable to create kakfa consumer")
+	}
+	defer consumer.Close()
+
+	metadata, err := consumer.GetMetadata(&config.DeadLetterTopic, false, int(timeout.Milliseconds()))
+	if err != nil {
+		return errors.New("Unable to read metadata for " + config.DeadLetterTopic + ": " + err.Error())
+	}
+	topicMetadata, ok := metadata.Topics[config.DeadLetterTopic]
+	if !ok || len(topicMetadata.Partitions) == 0 {
+		return nil
+	}
+	var partitions []kafka.TopicPartition
+	for _, partition := range topicMetadata.Partitions {
+		partitions = append(partitions, kafka.TopicPartition{
+			Topic:     &config.DeadLetterTopic,
+			Partition: partition.ID,
+			Offset:    kafka.OffsetBeginning,
+		})
+	}
+	if err := consumer.Assign(partitions); err != nil {
+		return errors.New("Unable to assign " + config.DeadLetterTopic + " partitions: " + err.Error())
+	}
+
+	remaining := len(partitions)
+	for remaining > 0 {
+		switch event := consumer.Poll(int(timeout.Milliseconds())).(type) {
+		case nil:
+			return fmt.Errorf("Timed out reading %s with %d partitions left", config.DeadLetterTopic, remaining)
+		case kafka.PartitionEOF:
+			remaining--
+		case kafka.Error:
+			return errors.New("Error reading dead letters: " + event.Error())
+		case *kafka.Message:
+			dl, err := ParseDeadLetter(event)
+			if err != nil {
+				return fmt.Errorf("Unable to parse dead letter at %d/%d: %v", event.TopicPartition.Partition, event.TopicPartition.Offset, err)
+			}
+			if err := fn(dl); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReplayDeadLetter re-injects the original payload of a dead letter into topic.
+func ReplayDeadLetter(kp Producer, topic string, dlqTopic string, dl DeadLetter) error {
+	replayedFrom := fmt.Sprintf("%s/%d/%d", dlqTopic, dl.Partition, dl.Offset)
+	return kp.Produce(&kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &topic,
+			Partition: kafka.PartitionAny,
+		},
+		Value: dl.Payload,
+		Headers: []kafka.Header{
+			{Key: HeaderReplayedFrom, Value: []byte(replayedFrom)},
+		},
+	}, nil)
+}
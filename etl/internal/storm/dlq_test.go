@@ -0,0 +1,40 @@
+package storm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterRoundTrip(t *testing.T) {
+	sourceTopic := "raw-weather-reports"
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &sourceTopic,
+			Partition: 2,
+			Offset:    41,
+		},
+		Value: []byte(`{"Time": "12"}`),
+	}
+	cause := MessageError{Stage: StageEventTime, Err: errors.New("Unable to parse HH in Time field")}
+
+	dlqMsg := newDeadLetterMessage(msg, "raw-weather-reports-dlq", cause)
+	assert.Equal(t, "raw-weather-reports-dlq", *dlqMsg.TopicPartition.Topic)
+
+	dl, err := ParseDeadLetter(dlqMsg)
+	assert.Nil(t, err)
+	assert.Equal(t, sourceTopic, dl.SourceTopic)
+	assert.Equal(t, int32(2), dl.SourcePartition)
+	assert.Equal(t, int64(41), dl.SourceOffset)
+	assert.Equal(t, StageEventTime, dl.Stage)
+	assert.Equal(t, "Unable to parse HH in Time field", dl.Error)
+	assert.Equal(t, msg.Value, dl.Payload)
+	assert.False(t, dl.FailedAt.IsZero())
+}
+
+func TestParseDeadLetterMissingStage(t *testing.T) {
+	_, err := ParseDeadLetter(&kafka.Message{Value: []byte("{}")})
+	assert.EqualError(t, err, "Message is missing the dlq-failure-stage header")
+}
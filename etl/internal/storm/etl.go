@@ -1,14 +1,23 @@
 package storm
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"strconv"
+	"strings"
 	"time"
+	"weather-contract/event"
+	"weather-contract/telemetry"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 // StormData represents the incoming raw weather data.
@@ -25,6 +34,8 @@ type MsgData struct {
 	Comments string  `json:"Comments"`
 	Speed    *string `json:"Speed,omitempty"`
 	EventTs  int64   `json:"EventTs"`
+	// Source selects the report-day convention, SourceSpc when empty.
+	Source string `json:"Source,omitempty"`
 }
 
 const (
@@ -36,59 +47,160 @@ const (
 
 type WeatherData interface {
 	GetType() string
+	GetEventId() string
+	// GetEmitTs is when the collector emitted the report, in milliseconds.
+	GetEmitTs() int64
+	// Envelope is the message the report is published in.
+	Envelope() event.Envelope
+}
+
+// newEnvelope fills in what the envelopes of every storm type have.
+func newEnvelope(stormType string, eventId string, source string, emitTs int64, eventTs int64, convectiveDay string) event.Envelope {
+	envelope := event.Envelope{
+		SchemaVersion: event.SchemaVersion,
+		EventId:       eventId,
+		Type:          stormType,
+		Source:        source,
+		EventTime:     time.Unix(eventTs, 0).UTC(),
+		ConvectiveDay: convectiveDay,
+	}
+	if emitTs > 0 {
+		envelope.EmittedAt = time.UnixMilli(emitTs).UTC()
+	}
+	return envelope
 }
 
 type WindStorm struct {
-	Time     int64   `json:"Time"`
-	EmitTs   int64   `json:"EmitTs"`
-	Location string  `json:"Location"`
-	County   string  `json:"County"`
-	State    string  `json:"State"`
-	Lat      float64 `json:"Lat"`
-	Lon      float64 `json:"Lon"`
-	Comments string  `json:"Comments"`
-	Speed    string  `json:"Speed"`
-	Type     string  `json:"StormType"`
+	Time     int64
+	EmitTs   int64
+	Location string
+	County   string
+	State    string
+	Lat      float64
+	Lon      float64
+	Comments string
+	Speed    string
+	// SpeedMph and SpeedKts are nil when SpeedUnknown is set.
+	SpeedMph       *float64
+	SpeedKts       *float64
+	SpeedEstimated bool
+	SpeedUnknown   bool
+	Type           string
+	EventId        string
+	// ConvectiveDay is the source's report day, Time the absolute UTC time.
+	ConvectiveDay string
+	Source        string
 }
 
 func (w WindStorm) GetType() string {
 	return Wind
 }
 
+func (w WindStorm) GetEventId() string {
+	return w.EventId
+}
+
+func (w WindStorm) GetEmitTs() int64 {
+	return w.EmitTs
+}
+
+func (w WindStorm) Envelope() event.Envelope {
+	envelope := newEnvelope(event.TypeWind, w.EventId, w.Source, w.EmitTs, w.Time, w.ConvectiveDay)
+	envelope.Wind = &event.Wind{
+		Report:         event.Report{Location: w.Location, County: w.County, State: w.State, Lat: w.Lat, Lon: w.Lon, Comments: w.Comments},
+		Speed:          w.Speed,
+		SpeedMph:       w.SpeedMph,
+		SpeedKts:       w.SpeedKts,
+		SpeedEstimated: w.SpeedEstimated,
+		SpeedUnknown:   w.SpeedUnknown,
+	}
+	return envelope
+}
+
 type HailStorm struct {
-	Time     int64   `json:"Time"`
-	Location string  `json:"Location"`
-	County   string  `json:"County"`
-	State    string  `json:"State"`
-	Lat      float64 `json:"Lat"`
-	Lon      float64 `json:"Lon"`
-	Comments string  `json:"Comments"`
-	Size     string  `json:"Size"`
-	EmitTs   int64   `json:"EmitTs"`
-	Type     string  `json:"StormType"`
+	Time     int64
+	Location string
+	County   string
+	State    string
+	Lat      float64
+	Lon      float64
+	Comments string
+	Size     string
+	// SizeIn and SizeMm are nil when the size is unknown.
+	SizeIn        *float64
+	SizeMm        *float64
+	EmitTs        int64
+	Type          string
+	EventId       string
+	ConvectiveDay string
+	Source        string
 }
 
 func (h HailStorm) GetType() string {
 	return Hail
 }
 
+func (h HailStorm) GetEventId() string {
+	return h.EventId
+}
+
+func (h HailStorm) GetEmitTs() int64 {
+	return h.EmitTs
+}
+
+func (h HailStorm) Envelope() event.Envelope {
+	envelope := newEnvelope(event.TypeHail, h.EventId, h.Source, h.EmitTs, h.Time, h.ConvectiveDay)
+	envelope.Hail = &event.Hail{
+		Report: event.Report{Location: h.Location, County: h.County, State: h.State, Lat: h.Lat, Lon: h.Lon, Comments: h.Comments},
+		Size:   h.Size,
+		SizeIn: h.SizeIn,
+		SizeMm: h.SizeMm,
+	}
+	return envelope
+}
+
 type TornadoStorm struct {
-	Time     int64   `json:"Time"`
-	Location string  `json:"Location"`
-	County   string  `json:"County"`
-	State    string  `json:"State"`
-	Lat      float64 `json:"Lat,string"`
-	Lon      float64 `json:"Lon,string"`
-	Comments string  `json:"Comments"`
-	FScale   string  `json:"F_Scale"`
-	EmitTs   int64   `json:"EmitTs"`
-	Type     string  `json:"StormType"`
+	Time     int64
+	Location string
+	County   string
+	State    string
+	Lat      float64
+	Lon      float64
+	Comments string
+	FScale   string
+	// Rating is nil for unrated tornadoes, RatingScale is EF or F.
+	Rating        *int
+	RatingScale   string
+	EmitTs        int64
+	Type          string
+	EventId       string
+	ConvectiveDay string
+	Source        string
 }
 
 func (t TornadoStorm) GetType() string {
 	return Tornado
 }
 
+func (t TornadoStorm) GetEventId() string {
+	return t.EventId
+}
+
+func (t TornadoStorm) GetEmitTs() int64 {
+	return t.EmitTs
+}
+
+func (t TornadoStorm) Envelope() event.Envelope {
+	envelope := newEnvelope(event.TypeTornado, t.EventId, t.Source, t.EmitTs, t.Time, t.ConvectiveDay)
+	envelope.Tornado = &event.Tornado{
+		Report:      event.Report{Location: t.Location, County: t.County, State: t.State, Lat: t.Lat, Lon: t.Lon, Comments: t.Comments},
+		FScale:      t.FScale,
+		Rating:      t.Rating,
+		RatingScale: t.RatingScale,
+	}
+	return envelope
+}
+
 type InvalidStorm struct {
 	Error error
 }
@@ -97,6 +209,27 @@ func (is InvalidStorm) GetType() string {
 	return Invalid
 }
 
+func (is InvalidStorm) GetEventId() string {
+	return ""
+}
+
+func (is InvalidStorm) GetEmitTs() int64 {
+	return 0
+}
+
+func (is InvalidStorm) Envelope() event.Envelope {
+	return event.Envelope{}
+}
+
+// eventId derives a deterministic ID from the natural key of a report so the
+// same report re-sent by the collector always maps to the same event.
+func eventId(stormType string, eventTs int64, lat float64, lon float64, location string, magnitude string) string {
+	naturalKey := fmt.Sprintf("%s|%d|%.4f|%.4f|%s|%s", stormType, eventTs, lat, lon,
+		strings.ToUpper(strings.TrimSpace(location)), strings.ToUpper(strings.TrimSpace(magnitude)))
+	sum := sha256.Sum256([]byte(naturalKey))
+	return hex.EncodeToString(sum[:16])
+}
+
 func standardizeEventTime(timeStr string, eventDate time.Time) (int64, error) {
 	var eventTime int64
 	if len(timeStr) != 4 {
@@ -115,12 +248,16 @@ func standardizeEventTime(timeStr string, eventDate time.Time) (int64, error) {
 }
 
 func determineStormData(sd MsgData) (WeatherData, error) {
-	timeEventTs := time.Unix(sd.EventTs/1000, (sd.EventTs%1000)*int64(time.Millisecond))
-	eventTs, err := standardizeEventTime(sd.Time, timeEventTs)
+	timeEventTs := time.Unix(sd.EventTs/1000, (sd.EventTs%1000)*int64(time.Millisecond)).UTC()
+	if sd.Source == "" {
+		sd.Source = SourceSpc
+	}
+	eventTs, err := reportTime(sd.Time, timeEventTs, sd.Source)
 
 	if err != nil {
 		return InvalidStorm{}, err
 	}
+	convectiveDay := timeEventTs.Format(convectiveDayFormat)
 	if sd.FScale != nil {
 		tornadoData := TornadoStorm{
 			Comments: sd.Comments,
@@ -132,8 +269,15 @@ func determineStormData(sd MsgData) (WeatherData, error) {
 			County:   sd.County,
 			EmitTs:   sd.EmitTs,
 			Time:     eventTs,
+
+			ConvectiveDay: convectiveDay,
+			Source:        sd.Source,
 		}
+		rating := parseTornadoRating(*sd.FScale)
+		tornadoData.Rating = rating.Rating
+		tornadoData.RatingScale = rating.Scale
 		tornadoData.Type = tornadoData.GetType()
+		tornadoData.EventId = eventId(tornadoData.Type, eventTs, sd.Lat, sd.Lon, sd.Location, *sd.FScale)
 		return tornadoData, nil
 	} else if sd.Speed != nil {
 		windData := WindStorm{
@@ -146,8 +290,17 @@ func determineStormData(sd MsgData) (WeatherData, error) {
 			Speed:    *sd.Speed,
 			EmitTs:   sd.EmitTs,
 			Time:     eventTs,
+
+			ConvectiveDay: convectiveDay,
+			Source:        sd.Source,
 		}
+		speed := parseWindSpeed(*sd.Speed)
+		windData.SpeedMph = speed.Mph
+		windData.SpeedKts = speed.Knots
+		windData.SpeedEstimated = speed.Estimated
+		windData.SpeedUnknown = speed.Unknown
 		windData.Type = windData.GetType()
+		windData.EventId = eventId(windData.Type, eventTs, sd.Lat, sd.Lon, sd.Location, *sd.Speed)
 		return windData, nil
 	} else if sd.Size != nil {
 		hailData := HailStorm{
@@ -160,65 +313,103 @@ func determineStormData(sd MsgData) (WeatherData, error) {
 			Size:     *sd.Size,
 			Time:     eventTs,
 			EmitTs:   sd.EmitTs,
+
+			ConvectiveDay: convectiveDay,
+			Source:        sd.Source,
 		}
+		size := parseHailSize(*sd.Size)
+		hailData.SizeIn = size.Inches
+		hailData.SizeMm = size.Millimeters
 		hailData.Type = hailData.GetType()
+		hailData.EventId = eventId(hailData.Type, eventTs, sd.Lat, sd.Lon, sd.Location, *sd.Size)
 		return hailData, nil
 	} else {
 		return InvalidStorm{}, nil
 	}
 }
 
-func MarshalJson(sd WeatherData) ([]byte, error) {
-	switch storm := sd.(type) {
-	case TornadoStorm:
-		jsonData, err := json.Marshal(storm)
-		if err != nil {
-			return []byte{}, errors.New("Unable to marshal tornado data")
-		}
-		return jsonData, nil
-	case HailStorm:
-		jsonData, err := json.Marshal(storm)
-		if err != nil {
-			return []byte{}, errors.New("Unable to marshal tornado data")
-		}
-		return jsonData, nil
-	case WindStorm:
-		jsonData, err := json.Marshal(storm)
-		if err != nil {
-			return []byte{}, errors.New("Unable to marshal tornado data")
-		}
-		return jsonData, nil
-	case InvalidStorm:
-		return []byte{}, errors.New("Invalid message type")
-	default:
+// Marshal encodes sd in the envelope shared with the api.
+func Marshal(sd WeatherData, encoder event.Encoder) ([]byte, error) {
+	if sd.GetType() == Invalid {
 		return []byte{}, errors.New("Invalid message type")
 	}
+	data, err := encoder.Encode(sd.Envelope())
+	if err != nil {
+		return []byte{}, errors.New("Unable to marshal " + sd.GetType() + " data: " + err.Error())
+	}
+	return data, nil
 }
 
-func handleMessage(kp *kafka.Producer, msg *kafka.Message, topic string) error {
+// transformMessage converts a raw report into its storm data and the message
+// encoder writes it in. Any error is a MessageError describing the stage the report was
+// rejected at.
+func transformMessage(msg *kafka.Message, encoder event.Encoder) (WeatherData, []byte, error) {
 	var stormData MsgData
-	// Print the Kafka message metadata and value for debugging
-	log.Printf(fmt.Sprintf("Received message: Topic: %s, Partition: %d, Offset: %d, Value: %s\n",
-		*msg.TopicPartition.Topic, msg.TopicPartition.Partition, msg.TopicPartition.Offset, string(msg.Value)))
 	if err := json.Unmarshal(msg.Value, &stormData); err != nil {
-		return errors.New("Unable to parse message: " + err.Error())
+		return nil, []byte{}, MessageError{Stage: StageParse, Err: errors.New("Unable to parse message: " + err.Error())}
 	}
 	sd, err := determineStormData(stormData)
 	if err != nil {
-		return errors.New("Unable to determine storm data due to " + err.Error())
+		return nil, []byte{}, MessageError{Stage: StageEventTime, Err: errors.New("Unable to determine storm data due to " + err.Error())}
+	}
+	if sd.GetType() == Invalid {
+		return nil, []byte{}, MessageError{Stage: StageInvalid, Err: errors.New("Message is not a wind, hail or tornado report")}
 	}
-	jsonData, err := MarshalJson(sd)
+	data, err := Marshal(sd, encoder)
+	if err != nil {
+		return nil, []byte{}, MessageError{Stage: StageMarshal, Err: err}
+	}
+	return sd, data, nil
+}
+
+// handleMessage transforms a raw report and produces it to ProducerTopic. It
+// continues the trace of the report when the collector sent one, or starts
+// it, and passes it on in the headers of the transformed message.
+func (p Process) handleMessage(msg *kafka.Message) (err error) {
+	ctx, span := p.Tracer.Start(telemetry.Propagator.Extract(context.Background(), telemetry.HeaderCarrier{Headers: &msg.Headers}),
+		"transform "+telemetry.MessageTopic(msg), trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(telemetry.MessageAttributes(msg)...))
+	defer func() {
+		if err != nil {
+			span.SetAttributes(attribute.String("weather.rejected_stage", failureStage(err)))
+		}
+		telemetry.EndSpan(span, err)
+	}()
+	telemetry.LogReceived(p.Logger, p.payloads, msg)
+	sd, data, err := transformMessage(msg, p.Encoder)
 	if err != nil {
 		return err
 	}
-	kp.Produce(&kafka.Message{
+	span.SetAttributes(attribute.String("weather.storm_type", sd.GetType()), attribute.String("weather.event_id", sd.GetEventId()))
+
+	// Keying by event ID keeps every copy of a report on the same partition
+	out := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{
-			Topic:     &topic,
+			Topic:     &p.ProducerTopic,
 			Partition: kafka.PartitionAny,
 		},
-		Value: jsonData,
-	}, nil)
+		Key:    []byte(sd.GetEventId()),
+		Value:  data,
+		Opaque: &delivery{Source: msg, StormType: sd.GetType(), EmitTs: sd.GetEmitTs()},
+	}
+	ctx, publish := p.Tracer.Start(ctx, "publish "+p.ProducerTopic, trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingSystemKafka, semconv.MessagingDestinationName(p.ProducerTopic)))
+	telemetry.Propagator.Inject(ctx, telemetry.HeaderCarrier{Headers: &out.Headers})
+	err = p.Producer.Produce(out, nil)
+	telemetry.EndSpan(publish, err)
+	if err != nil {
+		return MessageError{Stage: StageProduce, Err: errors.New("Unable to produce message: " + err.Error())}
+	}
 
-	log.Println("Processed message and push to " + topic)
+	p.Logger.Debug("Transformed message.", append(telemetry.MessageFields(msg),
+		zap.String("storm_type", sd.GetType()), zap.String("event_id", sd.GetEventId()),
+		zap.String("trace_id", span.SpanContext().TraceID().String()))...)
 	return nil
 }
+
+// rejected logs a message about to be dead lettered, leaving its payload to
+// the dead-letter topic.
+func (p Process) rejected(msg *kafka.Message, err error) {
+	p.Logger.Warn("Rejected message.", append(telemetry.MessageFields(msg),
+		zap.String("stage", failureStage(err)), zap.Error(err))...)
+}
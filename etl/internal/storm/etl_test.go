@@ -1,9 +1,13 @@
 package storm
 
 import (
+	"errors"
 	"testing"
 	"time"
+	"weather-contract/event"
+	"weather-contract/event/eventtest"
 
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,3 +45,272 @@ func TestStandardizeEventTime(t *testing.T) {
 		}
 	}
 }
+
+type transformCase struct {
+	value         string
+	expectedStage string
+}
+
+func TestTransformMessageStage(t *testing.T) {
+	tests := []transformCase{
+		{
+			value:         `{"Time": "1233", "EventTs": 1704067200000, "Size": "175", "Lat": "35.1", "Lon": "-97.4"}`,
+			expectedStage: "",
+		},
+		{
+			value:         `not json`,
+			expectedStage: StageParse,
+		},
+		{
+			value:         `{"Time": "12", "EventTs": 1704067200000, "Size": "175", "Lat": "35.1", "Lon": "-97.4"}`,
+			expectedStage: StageEventTime,
+		},
+		{
+			value:         `{"Time": "1233", "EventTs": 1704067200000, "Lat": "35.1", "Lon": "-97.4"}`,
+			expectedStage: StageInvalid,
+		},
+	}
+	for _, tc := range tests {
+		_, _, err := transformMessage(&kafka.Message{Value: []byte(tc.value)}, event.JsonEncoder{})
+		if tc.expectedStage == "" {
+			assert.Nil(t, err)
+		} else {
+			assert.Equal(t, tc.expectedStage, failureStage(err))
+		}
+	}
+}
+
+// TestTransformMessageContract checks that raw reports of every storm type
+// are published as the envelopes the api is tested against.
+func TestTransformMessageContract(t *testing.T) {
+	raw := map[string]string{
+		event.TypeHail: `{"Time": "2010", "EmitTs": 1715040000123, "EventTs": 1714953600000, "Size": "175", "Location": "2 N NORMAN", "County": "CLEVELAND", "State": "OK",
+			"Lat": "35.22", "Lon": "-97.44", "Comments": "Golf ball hail. (OUN)"}`,
+		event.TypeWind: `{"Time": "0130", "EmitTs": 1715050800000, "EventTs": 1715040000000, "Source": "calendar", "Speed": "E60", "Location": "MOORE", "County": "CLEVELAND", "State": "OK",
+			"Lat": "35.34", "Lon": "-97.49", "Comments": "Large tree limbs down. (OUN)"}`,
+		event.TypeTornado: `{"Time": "2205", "EmitTs": 1715040000000, "EventTs": 1714953600000, "FScale": "EF2", "Location": "4 SW BARNSDALL", "County": "OSAGE", "State": "OK",
+			"Lat": "36.53", "Lon": "-96.19", "Comments": "EF2 damage to homes. (TSA)"}`,
+	}
+	for _, expected := range eventtest.Envelopes() {
+		sd, jsonData, err := transformMessage(&kafka.Message{Value: []byte(raw[expected.Type])}, event.JsonEncoder{})
+		assert.Nil(t, err)
+		published, err := event.Decode(jsonData)
+		assert.Nil(t, err)
+		assert.Equal(t, sd.GetEventId(), published.EventId)
+		// The event IDs of the fixtures are made up.
+		published.EventId = expected.EventId
+		assert.Equal(t, expected, published)
+	}
+}
+
+func TestNextOffsets(t *testing.T) {
+	topic := "raw-weather-reports"
+	batch := []*kafka.Message{
+		{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 7}},
+		{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 1, Offset: 3}},
+		{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 9}},
+		{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 8}},
+	}
+	offsets := make(map[int32]kafka.Offset)
+	for _, tp := range nextOffsets(batch) {
+		assert.Equal(t, topic, *tp.Topic)
+		offsets[tp.Partition] = tp.Offset
+	}
+	assert.Equal(t, map[int32]kafka.Offset{0: 10, 1: 4}, offsets)
+}
+
+func TestPendingOffsets(t *testing.T) {
+	topic := "raw-weather-reports"
+	report := func(partition int32, offset kafka.Offset) *kafka.Message {
+		return &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition, Offset: offset}}
+	}
+	consumer := NewMemoryConsumer(topic)
+	offsets := newPendingOffsets(consumer)
+	for _, offset := range []kafka.Offset{7, 8, 9} {
+		offsets.read(report(0, offset))
+	}
+	offsets.read(report(1, 3))
+
+	// 8 and 9 are acknowledged before 7, which stops the stored offset.
+	assert.Nil(t, offsets.settle(report(0, 9)))
+	assert.Nil(t, offsets.settle(report(0, 8)))
+	assert.Nil(t, offsets.settle(report(1, 3)))
+	assert.Equal(t, kafka.Offset(4), consumer.stored)
+	assert.Nil(t, offsets.settle(report(0, 7)))
+	assert.Equal(t, kafka.Offset(10), consumer.stored)
+	_, err := consumer.Commit()
+	assert.Nil(t, err)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	base := 500 * time.Millisecond
+	assert.Equal(t, 500*time.Millisecond, retryBackoff(base, 1))
+	assert.Equal(t, time.Second, retryBackoff(base, 2))
+	assert.Equal(t, 4*time.Second, retryBackoff(base, 4))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(base, 20))
+}
+
+func TestIsTransient(t *testing.T) {
+	assert.True(t, isTransient(kafka.NewError(kafka.ErrMsgTimedOut, "timed out", false)))
+	assert.True(t, isTransient(kafka.NewError(kafka.ErrAllBrokersDown, "brokers down", false)))
+	assert.False(t, isTransient(kafka.NewError(kafka.ErrMsgSizeTooLarge, "too large", false)))
+	assert.False(t, isTransient(errors.New("not a kafka error")))
+}
+
+func TestEventId(t *testing.T) {
+	id := eventId(Hail, 1704112380, 35.1, -97.4, "Norman", "175")
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, eventId(Hail, 1704112380, 35.1, -97.4, " NORMAN ", "175"))
+	assert.NotEqual(t, id, eventId(Hail, 1704112380, 35.1, -97.4, "Norman", "200"))
+	assert.NotEqual(t, id, eventId(Wind, 1704112380, 35.1, -97.4, "Norman", "175"))
+	assert.NotEqual(t, id, eventId(Hail, 1704112440, 35.1, -97.4, "Norman", "175"))
+}
+
+type backfillCase struct {
+	hourMinute string
+	location   string
+	lat        float64
+	lon        float64
+	size       string
+	// expectedId is the event_id 0002_add_event_id.up.sql in the api gives the
+	// row the baseline saved for the report, whose event_time kept the HHMM on
+	// the report date.
+	expectedId string
+}
+
+func TestEventIdMatchesBackfill(t *testing.T) {
+	reportDate := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	testCases := []backfillCase{
+		// Saved at 2024-05-06 01:30:00 and moved to 2024-05-07 01:30:00.
+		{hourMinute: "0130", location: " Norman ", lat: 35.2226, lon: -97.4395, size: "175", expectedId: "5bcbeec34bf8aee41878e8901603738b"},
+		{hourMinute: "1430", location: "Moore", lat: 35.3395, lon: -97.4867, size: "100", expectedId: "a7cd85a8cd07b0892dae6e519d5e4ffd"},
+	}
+	for _, tc := range testCases {
+		sd, err := determineStormData(MsgData{
+			Time:     tc.hourMinute,
+			EventTs:  reportDate.UnixMilli(),
+			Location: tc.location,
+			Lat:      tc.lat,
+			Lon:      tc.lon,
+			Size:     &tc.size,
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expectedId, sd.GetEventId())
+	}
+}
+
+type reportTimeCase struct {
+	hourMinute     string
+	source         string
+	expectedResult time.Time
+}
+
+func TestReportTime(t *testing.T) {
+	reportDate := time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC)
+	tests := []reportTimeCase{
+		{
+			hourMinute:     "1713",
+			source:         SourceSpc,
+			expectedResult: time.Date(2024, 9, 14, 17, 13, 0, 0, time.UTC),
+		},
+		{
+			hourMinute:     "1200",
+			source:         SourceSpc,
+			expectedResult: time.Date(2024, 9, 14, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			hourMinute:     "0245",
+			source:         SourceSpc,
+			expectedResult: time.Date(2024, 9, 15, 2, 45, 0, 0, time.UTC),
+		},
+		{
+			hourMinute:     "1159",
+			source:         SourceSpc,
+			expectedResult: time.Date(2024, 9, 15, 11, 59, 0, 0, time.UTC),
+		},
+		{
+			hourMinute:     "0245",
+			source:         SourceCalendar,
+			expectedResult: time.Date(2024, 9, 14, 2, 45, 0, 0, time.UTC),
+		},
+	}
+	for _, tc := range tests {
+		result, err := reportTime(tc.hourMinute, reportDate, tc.source)
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expectedResult.Unix(), result)
+	}
+
+	_, err := reportTime("0245", reportDate, "nws")
+	assert.EqualError(t, err, "Unknown report source nws")
+}
+
+func TestDetermineStormDataConvectiveDay(t *testing.T) {
+	size := "175"
+	sd, err := determineStormData(MsgData{
+		Time:    "0245",
+		EventTs: time.Date(2024, 9, 14, 0, 0, 0, 0, time.UTC).UnixMilli(),
+		Size:    &size,
+	})
+	assert.Nil(t, err)
+	hail := sd.(HailStorm)
+	assert.Equal(t, "2024-09-14", hail.ConvectiveDay)
+	assert.Equal(t, SourceSpc, hail.Source)
+	assert.Equal(t, time.Date(2024, 9, 15, 2, 45, 0, 0, time.UTC).Unix(), hail.Time)
+}
+
+func TestParseHailSize(t *testing.T) {
+	size := parseHailSize("175")
+	assert.Equal(t, 1.75, *size.Inches)
+	assert.Equal(t, 44.5, *size.Millimeters)
+
+	size = parseHailSize("UNK")
+	assert.Nil(t, size.Inches)
+	assert.Nil(t, size.Millimeters)
+}
+
+func TestParseWindSpeed(t *testing.T) {
+	speed := parseWindSpeed("60")
+	assert.Equal(t, 60.0, *speed.Mph)
+	assert.Equal(t, 52.1, *speed.Knots)
+	assert.False(t, speed.Estimated)
+	assert.False(t, speed.Unknown)
+
+	speed = parseWindSpeed("E70")
+	assert.Equal(t, 70.0, *speed.Mph)
+	assert.True(t, speed.Estimated)
+
+	speed = parseWindSpeed("M58")
+	assert.Equal(t, 58.0, *speed.Mph)
+	assert.False(t, speed.Estimated)
+
+	speed = parseWindSpeed("UNK")
+	assert.Nil(t, speed.Mph)
+	assert.Nil(t, speed.Knots)
+	assert.True(t, speed.Unknown)
+}
+
+type ratingCase struct {
+	raw            string
+	expectedRating *int
+	expectedScale  string
+}
+
+func TestParseTornadoRating(t *testing.T) {
+	two, three := 2, 3
+	tests := []ratingCase{
+		{raw: "EF2", expectedRating: &two, expectedScale: ScaleEnhancedFujita},
+		{raw: "ef-2", expectedRating: &two, expectedScale: ScaleEnhancedFujita},
+		{raw: "F3", expectedRating: &three, expectedScale: ScaleFujita},
+		{raw: "EFU", expectedRating: nil, expectedScale: ScaleEnhancedFujita},
+		{raw: "UNK", expectedRating: nil, expectedScale: ""},
+		{raw: "EF9", expectedRating: nil, expectedScale: ScaleEnhancedFujita},
+		{raw: "FOO", expectedRating: nil, expectedScale: ""},
+		{raw: "EFX", expectedRating: nil, expectedScale: ""},
+		{raw: "F+2", expectedRating: nil, expectedScale: ""},
+	}
+	for _, tc := range tests {
+		rating := parseTornadoRating(tc.raw)
+		assert.Equal(t, tc.expectedRating, rating.Rating, tc.raw)
+		assert.Equal(t, tc.expectedScale, rating.Scale, tc.raw)
+	}
+}
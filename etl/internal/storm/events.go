@@ -3,28 +3,57 @@ package storm
 import (
 	"context"
 	"errors"
-	"log"
 	"time"
+	"weather-contract/event"
+	"weather-contract/registry"
+	"weather-contract/telemetry"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 type Process struct {
-	Consumer      *kafka.Consumer
-	Producer      *kafka.Producer
-	ProducerTopic string
+	Consumer        Consumer
+	Producer        Producer
+	ProducerTopic   string
+	DeadLetterTopic string
+	// ExactlyOnce selects the transactional consume-transform-produce loop.
+	ExactlyOnce          bool
+	TransactionBatchSize int
+	DrainTimeout         time.Duration
+	FlushTimeout         time.Duration
+	ShutdownTimeout      time.Duration
+	Stats                *DeliveryStats
+	Health               *telemetry.ConsumerHealth
+	Logger               *zap.Logger
+	Tracer               trace.Tracer
+	Encoder              event.Encoder
+	payloads             *telemetry.PayloadSampler
+	tracker              *deliveryTracker
 }
 
-func InitProcess() (Process, error) {
+func InitProcess(logger *zap.Logger) (Process, error) {
 	config, err := ParseEnv()
 	if err != nil {
 		return Process{}, err
 	}
 	// Initialize Kafka consumer
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
+	consumerConfig := &kafka.ConfigMap{
 		"bootstrap.servers": config.Broker,
 		"group.id":          config.GroupId,
-		"auto.offset.reset": "smallest"})
+		"auto.offset.reset": "smallest"}
+	if config.ExactlyOnce {
+		// Offsets are committed through the producer transaction instead.
+		consumerConfig.SetKey("enable.auto.commit", false)
+		consumerConfig.SetKey("isolation.level", "read_committed")
+	} else {
+		// Offsets are stored once a message has been handled so that a
+		// shutdown only commits what was actually processed.
+		consumerConfig.SetKey("enable.auto.offset.store", false)
+	}
+	consumer, err := kafka.NewConsumer(consumerConfig)
 	if err != nil {
 		return Process{}, errors.New("Unable to create kakfa consumer")
 	}
@@ -33,57 +62,193 @@ func InitProcess() (Process, error) {
 	if err := consumer.Subscribe(config.ConsumerTopic, nil); err != nil {
 		return Process{}, errors.New("Unable to subscribed to " + config.ConsumerTopic + " topic")
 	}
-	producer, err := kafka.NewProducer(&kafka.ConfigMap{
-		"bootstrap.servers": config.Broker})
+	producerConfig := &kafka.ConfigMap{
+		"bootstrap.servers": config.Broker}
+	if config.ExactlyOnce {
+		producerConfig.SetKey("transactional.id", config.TransactionalId)
+	}
+	producer, err := kafka.NewProducer(producerConfig)
 	if err != nil {
 		return Process{}, errors.New("Unable to create kakfa producer")
 	}
+	if config.ExactlyOnce {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := producer.InitTransactions(ctx); err != nil {
+			return Process{}, errors.New("Unable to initialize kafka transactions: " + err.Error())
+		}
+	}
+	return NewProcess(consumer, producer, config, logger)
+}
+
+// NewProcess wires a process around a consumer and producer. ExactlyOnce
+// needs both of them to be transactional.
+func NewProcess(consumer Consumer, producer Producer, config Kakfa, logger *zap.Logger) (Process, error) {
+	if config.ExactlyOnce {
+		_, transactionalConsumer := consumer.(TransactionalConsumer)
+		_, transactionalProducer := producer.(TransactionalProducer)
+		if !transactionalConsumer || !transactionalProducer {
+			return Process{}, errors.New("Exactly once mode needs a transactional consumer and producer")
+		}
+	}
+	encoder, err := newEncoder(config)
+	if err != nil {
+		return Process{}, err
+	}
+	stats := &DeliveryStats{}
+	health := telemetry.NewConsumerHealth()
+	tracker := &deliveryTracker{
+		producer:      producer,
+		sink:          deadLetterSink{producer: producer, topic: config.DeadLetterTopic},
+		stats:         stats,
+		health:        health,
+		logger:        logger,
+		transactional: config.ExactlyOnce,
+		maxRetries:    config.ProduceMaxRetries,
+		backoff:       config.ProduceRetryBackoff,
+	}
+	if !config.ExactlyOnce {
+		tracker.offsets = newPendingOffsets(consumer)
+	}
 
 	return Process{
-		Consumer:      consumer,
-		Producer:      producer,
-		ProducerTopic: config.ProducerTopic,
+		Consumer:             consumer,
+		Producer:             producer,
+		ProducerTopic:        config.ProducerTopic,
+		DeadLetterTopic:      config.DeadLetterTopic,
+		ExactlyOnce:          config.ExactlyOnce,
+		TransactionBatchSize: config.TransactionBatchSize,
+		DrainTimeout:         config.DrainTimeout,
+		FlushTimeout:         config.FlushTimeout,
+		ShutdownTimeout:      config.ShutdownTimeout,
+		Stats:                stats,
+		Health:               health,
+		Logger:               logger,
+		Tracer:               otel.Tracer(tracerName),
+		Encoder:              encoder,
+		payloads:             telemetry.NewPayloadSampler(config.PayloadSampling),
+		tracker:              tracker,
 	}, nil
 }
 
+// newEncoder returns the encoder of config.Encoding. The Avro schema is
+// registered up front, so a change the registry rules out as incompatible
+// stops the etl from starting.
+func newEncoder(config Kakfa) (event.Encoder, error) {
+	if config.Encoding != EncodingAvro {
+		return event.JsonEncoder{}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	encoder, err := event.NewAvroEncoder(ctx, registry.NewClient(config.SchemaRegistryUrl), config.SchemaSubject)
+	if err != nil {
+		return nil, errors.New("Unable to register the Avro schema: " + err.Error())
+	}
+	return encoder, nil
+}
+
 func (p Process) Start(ctx context.Context) error {
+	go p.tracker.run()
+	if p.ExactlyOnce {
+		return p.startTransactional(ctx)
+	}
 	defer p.Consumer.Close()
 	defer p.Producer.Close()
 
-	log.Println("Service is running... Listening for messages...")
+	p.Logger.Info("Service is running... Listening for messages...")
 	messageChan := make(chan *kafka.Message, 100) // Buffered channel for incoming messages
+	consumed := make(chan struct{})
+	processed := make(chan struct{})
+	// stop abandons the messages still buffered once draining times out.
+	stop := make(chan struct{})
 
 	// Goroutine to consume messages and send them to the channel
 	go func() {
+		defer close(consumed)
+		defer close(messageChan)
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			default:
+				p.Health.Polled()
 				msg, err := p.Consumer.ReadMessage(100 * time.Millisecond)
 				if err != nil {
 					if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrTimedOut {
 						continue
 					}
-					log.Printf("Error consuming message: %v\n", err)
+					p.Logger.Error("Error consuming message.", zap.Error(err))
 					continue
 				}
-				messageChan <- msg
+				p.Health.Read(msg, consumerMetrics.Record(p.Consumer, msg))
+				select {
+				case messageChan <- msg:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}
 	}()
 
-	// Goroutine to process messages from the channel
+	// Goroutine to process messages from the channel. Their offsets are
+	// stored by the delivery tracker once what they produced is delivered.
 	go func() {
-		for msg := range messageChan {
-			if err := handleMessage(p.Producer, msg, p.ProducerTopic); err != nil {
-				log.Printf("Error processing message: %v\n", err)
+		defer close(processed)
+		for {
+			var msg *kafka.Message
+			var ok bool
+			select {
+			case <-stop:
+				return
+			case msg, ok = <-messageChan:
+				if !ok {
+					return
+				}
+			}
+			p.tracker.read(msg)
+			if err := p.handleMessage(msg); err != nil {
+				p.rejected(msg, err)
+				if err := deadLetter(p.Producer, msg, p.DeadLetterTopic, err); err != nil {
+					p.Logger.Error("Error dead lettering message.", append(telemetry.MessageFields(msg), zap.Error(err))...)
+					p.tracker.settleReport(msg)
+				}
 			}
 		}
 	}()
 
 	// Block until context is canceled
 	<-ctx.Done()
-	log.Println("Received shutdown signal. Stopping service.")
+	p.Logger.Info("Received shutdown signal. Stopping service.")
+
+	// Drain the messages already read before flushing what they produced
+	select {
+	case <-processed:
+	case <-time.After(p.DrainTimeout):
+		p.Logger.Warn("Timed out draining in-flight messages, the offsets of those not handled will not be committed.")
+		close(stop)
+		<-processed
+	}
+	<-consumed
+	p.flush()
+	p.commit()
 	return nil
 }
+
+// commit synchronously commits the offsets of every handled message.
+func (p Process) commit() {
+	if _, err := p.Consumer.Commit(); err != nil {
+		if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrNoOffset {
+			return
+		}
+		p.Logger.Error("Error committing offsets.", zap.Error(err))
+	}
+}
+
+// flush waits up to FlushTimeout for outstanding messages to be delivered.
+func (p Process) flush() {
+	if remaining := p.tracker.flush(p.FlushTimeout); remaining > 0 {
+		p.Logger.Warn("Messages were not delivered before shutdown.", zap.Int("remaining", remaining))
+	}
+	p.Logger.Info("Producer flushed.", zap.Int64("delivered", p.Stats.Delivered.Load()),
+		zap.Int64("retried", p.Stats.Retried.Load()), zap.Int64("failed", p.Stats.Failed.Load()))
+}
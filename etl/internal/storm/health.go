@@ -0,0 +1,69 @@
+package storm
+
+import (
+	"encoding/json"
+	"net/http"
+	"weather-contract/telemetry"
+
+	"go.uber.org/zap"
+)
+
+// HealthChecker serves the liveness and readiness of the process.
+type HealthChecker struct {
+	Consumer Consumer
+	Health   *telemetry.ConsumerHealth
+	Config   telemetry.HealthChecks
+	Logger   *zap.Logger
+}
+
+func NewHealthChecker(process Process, config telemetry.HealthChecks) HealthChecker {
+	return HealthChecker{
+		Consumer: process.Consumer,
+		Health:   process.Health,
+		Config:   config,
+		Logger:   process.Logger,
+	}
+}
+
+// register adds /healthz and /readyz to mux.
+func (c HealthChecker) register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		c.respond(w, c.Live())
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		c.respond(w, c.Ready())
+	})
+}
+
+func (c HealthChecker) respond(w http.ResponseWriter, report telemetry.HealthReport) {
+	status := http.StatusOK
+	if report.Status != telemetry.StatusOk {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		c.Logger.Warn("Error writing health report.", zap.Error(err))
+	}
+}
+
+// Live fails once the consumer loop has stopped polling, as when messages
+// already read are stuck waiting to be transformed.
+func (c HealthChecker) Live() telemetry.HealthReport {
+	return telemetry.NewHealthReport(map[string]telemetry.Check{"consumer": c.Health.CheckPoll(c.Config.MaxPollInterval)})
+}
+
+// Ready checks the brokers, the partition assignment and how long messages
+// have been waiting to be processed.
+func (c HealthChecker) Ready() telemetry.HealthReport {
+	checks := map[string]telemetry.Check{
+		"last_message": c.Health.CheckLastMessage(c.Config.MaxMessageAge),
+	}
+	if assignment, ok := c.Consumer.(telemetry.AssignmentReader); ok {
+		checks["assignment"] = telemetry.CheckAssignment(assignment, c.Config.RequireAssignment)
+	}
+	if metadata, ok := c.Consumer.(telemetry.MetadataReader); ok {
+		checks["kafka"] = telemetry.CheckBrokers(metadata, c.Config.Timeout)
+	}
+	return telemetry.NewHealthReport(checks)
+}
@@ -0,0 +1,72 @@
+package storm
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"weather-contract/telemetry"
+	"weather-contract/telemetry/telemetrytest"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// brokenConsumer reaches no broker and has no partitions.
+type brokenConsumer struct {
+	*MemoryConsumer
+}
+
+func (brokenConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return nil, kafka.NewError(kafka.ErrTransport, "Broker transport failure", false)
+}
+
+func (brokenConsumer) Assignment() ([]kafka.TopicPartition, error) {
+	return nil, nil
+}
+
+type healthCase struct {
+	consumer       Consumer
+	expectedStatus int
+	expectedFailed []string
+}
+
+func TestReady(t *testing.T) {
+	testCases := []healthCase{
+		{consumer: NewMemoryConsumer(testRawTopic), expectedStatus: http.StatusOK},
+		{consumer: brokenConsumer{NewMemoryConsumer(testRawTopic)}, expectedStatus: http.StatusServiceUnavailable,
+			expectedFailed: []string{"assignment", "kafka"}},
+	}
+	for _, tc := range testCases {
+		process, err := NewProcess(tc.consumer, NewMemoryProducer(), testConfig(), zap.NewNop())
+		assert.Nil(t, err)
+		recorder := httptest.NewRecorder()
+		NewServeMux(NewHealthChecker(process, telemetrytest.HealthChecks())).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		assert.Equal(t, tc.expectedStatus, recorder.Code)
+
+		var report telemetry.HealthReport
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &report))
+		assert.Len(t, report.Checks, 3)
+		var failedChecks []string
+		for _, name := range []string{"assignment", "kafka", "last_message"} {
+			if report.Checks[name].Status == telemetry.StatusFail {
+				failedChecks = append(failedChecks, name)
+				assert.NotEmpty(t, report.Checks[name].Error)
+			}
+		}
+		assert.Equal(t, tc.expectedFailed, failedChecks)
+	}
+}
+
+func TestLive(t *testing.T) {
+	process, err := NewProcess(NewMemoryConsumer(testRawTopic), NewMemoryProducer(), testConfig(), zap.NewNop())
+	assert.Nil(t, err)
+	checker := NewHealthChecker(process, telemetrytest.HealthChecks())
+	assert.Equal(t, telemetry.StatusOk, checker.Live().Status)
+
+	recorder := httptest.NewRecorder()
+	NewServeMux(checker).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"consumer":{"status":"ok"`)
+}
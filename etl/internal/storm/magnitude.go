@@ -0,0 +1,110 @@
+package storm
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	mmPerInch    = 25.4
+	knotsPerMph  = 0.868976
+	unknownValue = "UNK"
+)
+
+// Tornado rating scale families.
+const (
+	ScaleEnhancedFujita string = "EF"
+	ScaleFujita         string = "F"
+)
+
+// HailSize is a hail diameter parsed from SPC hundredths of an inch, so "175"
+// is 1.75 in. Both fields are nil when the size is unknown.
+type HailSize struct {
+	Inches      *float64
+	Millimeters *float64
+}
+
+// WindSpeed is a wind gust parsed from an SPC speed in mph. A leading "E"
+// marks an estimated gust and a leading "M" a measured one.
+type WindSpeed struct {
+	Mph       *float64
+	Knots     *float64
+	Estimated bool
+	Unknown   bool
+}
+
+// TornadoRating is a parsed F or EF rating. Rating is nil for unrated
+// tornadoes such as "EFU" and Scale is empty when not even the family is known.
+type TornadoRating struct {
+	Rating *int
+	Scale  string
+}
+
+func round(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+func parseHailSize(raw string) HailSize {
+	hundredths, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+	if err != nil || hundredths <= 0 {
+		return HailSize{}
+	}
+	inches := round(hundredths/100, 2)
+	millimeters := round(hundredths*mmPerInch/100, 1)
+	return HailSize{Inches: &inches, Millimeters: &millimeters}
+}
+
+func parseWindSpeed(raw string) WindSpeed {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	var speed WindSpeed
+	switch {
+	case strings.HasPrefix(value, "E"):
+		speed.Estimated = true
+		value = value[1:]
+	case strings.HasPrefix(value, "M"):
+		value = value[1:]
+	}
+	mph, err := strconv.ParseFloat(value, 64)
+	if err != nil || mph <= 0 {
+		return WindSpeed{Unknown: true}
+	}
+	knots := round(mph*knotsPerMph, 1)
+	speed.Mph = &mph
+	speed.Knots = &knots
+	return speed
+}
+
+func parseTornadoRating(raw string) TornadoRating {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	var rating TornadoRating
+	var scale string
+	switch {
+	case value == "" || value == unknownValue:
+		return rating
+	case strings.HasPrefix(value, ScaleEnhancedFujita):
+		scale = ScaleEnhancedFujita
+	case strings.HasPrefix(value, ScaleFujita):
+		scale = ScaleFujita
+	default:
+		return rating
+	}
+	// The family only counts when followed by a digit or U, so "FOO" is not
+	// taken for an F rating.
+	rest := strings.TrimPrefix(value[len(scale):], "-")
+	if rest == "U" {
+		rating.Scale = scale
+		return rating
+	}
+	number, err := strconv.Atoi(rest)
+	if err != nil || len(rest) != 1 {
+		return rating
+	}
+	rating.Scale = scale
+	if number > 5 {
+		return rating
+	}
+	rating.Rating = &number
+	return rating
+}
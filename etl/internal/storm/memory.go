@@ -0,0 +1,212 @@
+package storm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// MemoryConsumer is a Consumer of a single partition held in memory, so the
+// process can run in tests without a broker.
+type MemoryConsumer struct {
+	topic    string
+	mu       sync.Mutex
+	messages []*kafka.Message
+	next     int
+	// stored is the offset the next commit commits, committed the one after
+	// the last committed message.
+	stored    kafka.Offset
+	committed kafka.Offset
+	added     chan struct{}
+	closed    bool
+}
+
+func NewMemoryConsumer(topic string) *MemoryConsumer {
+	return &MemoryConsumer{
+		topic:     topic,
+		stored:    kafka.OffsetInvalid,
+		committed: kafka.OffsetInvalid,
+		added:     make(chan struct{}, 1),
+	}
+}
+
+// Add appends a message to the partition.
+func (c *MemoryConsumer) Add(key []byte, value []byte, headers ...kafka.Header) {
+	c.mu.Lock()
+	c.messages = append(c.messages, &kafka.Message{
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &c.topic,
+			Partition: 0,
+			Offset:    kafka.Offset(len(c.messages)),
+		},
+		Key:       key,
+		Value:     value,
+		Headers:   headers,
+		Timestamp: time.Now(),
+	})
+	c.mu.Unlock()
+	select {
+	case c.added <- struct{}{}:
+	default:
+	}
+}
+
+// ReadMessage returns the next message, waiting up to timeout for one to be
+// added like a broker would.
+func (c *MemoryConsumer) ReadMessage(timeout time.Duration) (*kafka.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return nil, kafka.NewError(kafka.ErrState, "Consumer is closed", true)
+		}
+		if c.next < len(c.messages) {
+			msg := c.messages[c.next]
+			c.next++
+			c.mu.Unlock()
+			return msg, nil
+		}
+		c.mu.Unlock()
+		select {
+		case <-c.added:
+		case <-deadline:
+			return nil, kafka.NewError(kafka.ErrTimedOut, "Timed out", false)
+		}
+	}
+}
+
+// GetWatermarkOffsets returns the bounds of the partition, the high one
+// being the offset the next added message will get.
+func (c *MemoryConsumer) GetWatermarkOffsets(topic string, partition int32) (int64, int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if topic != c.topic || partition != 0 {
+		return 0, 0, kafka.NewError(kafka.ErrUnknownPartition, "Unknown partition", false)
+	}
+	return 0, int64(len(c.messages)), nil
+}
+
+// Assignment is the single partition of the topic.
+func (c *MemoryConsumer) Assignment() ([]kafka.TopicPartition, error) {
+	return []kafka.TopicPartition{{Topic: &c.topic, Partition: 0}}, nil
+}
+
+// GetMetadata describes a single broker holding the topic.
+func (c *MemoryConsumer) GetMetadata(topic *string, allTopics bool, timeoutMs int) (*kafka.Metadata, error) {
+	return &kafka.Metadata{
+		Brokers: []kafka.BrokerMetadata{{ID: 0, Host: "memory"}},
+		Topics: map[string]kafka.TopicMetadata{
+			c.topic: {Topic: c.topic, Partitions: []kafka.PartitionMetadata{{ID: 0}}},
+		},
+	}, nil
+}
+
+func (c *MemoryConsumer) StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, offset := range offsets {
+		c.stored = offset.Offset
+	}
+	return offsets, nil
+}
+
+func (c *MemoryConsumer) Commit() ([]kafka.TopicPartition, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stored == kafka.OffsetInvalid || c.stored == c.committed {
+		return nil, kafka.NewError(kafka.ErrNoOffset, "No offset stored", false)
+	}
+	c.committed = c.stored
+	return []kafka.TopicPartition{{Topic: &c.topic, Offset: c.committed}}, nil
+}
+
+// CommittedOffset is the offset a restarted consumer would resume from,
+// kafka.OffsetInvalid before the first commit.
+func (c *MemoryConsumer) CommittedOffset() kafka.Offset {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committed
+}
+
+func (c *MemoryConsumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// MemoryProducer is a Producer that keeps what it publishes in memory and
+// reports every message as delivered, unless DeliveryError fails it.
+type MemoryProducer struct {
+	// DeliveryError returns the delivery error of a message, nil to
+	// deliver it.
+	DeliveryError func(msg *kafka.Message) error
+
+	mu        sync.Mutex
+	published map[string][]*kafka.Message
+	events    chan kafka.Event
+	closed    bool
+}
+
+func NewMemoryProducer() *MemoryProducer {
+	return &MemoryProducer{
+		published: make(map[string][]*kafka.Message),
+		events:    make(chan kafka.Event, 1000),
+	}
+}
+
+func (p *MemoryProducer) Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return errors.New("Producer is closed")
+	}
+	topic := *msg.TopicPartition.Topic
+	report := *msg
+	report.TopicPartition.Partition = 0
+	if p.DeliveryError != nil {
+		report.TopicPartition.Error = p.DeliveryError(msg)
+	}
+	if report.TopicPartition.Error == nil {
+		report.TopicPartition.Offset = kafka.Offset(len(p.published[topic]))
+		p.published[topic] = append(p.published[topic], &report)
+	}
+	if deliveryChan != nil {
+		deliveryChan <- &report
+	} else {
+		p.events <- &report
+	}
+	return nil
+}
+
+func (p *MemoryProducer) Events() chan kafka.Event {
+	return p.events
+}
+
+// Flush waits for the delivery reports to be read.
+func (p *MemoryProducer) Flush(timeoutMs int) int {
+	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	for len(p.events) > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return len(p.events)
+}
+
+func (p *MemoryProducer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		close(p.events)
+	}
+}
+
+// Messages returns the messages delivered to topic in order.
+func (p *MemoryProducer) Messages(topic string) []*kafka.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*kafka.Message(nil), p.published[topic]...)
+}
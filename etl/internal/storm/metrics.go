@@ -0,0 +1,58 @@
+package storm
+
+import (
+	"net/http"
+	"time"
+	"weather-contract/telemetry"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	consumerMetrics  = telemetry.NewConsumerMetrics("weather_etl", "Raw reports read from the consumer topic.")
+	messagesProduced = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_etl_messages_produced_total",
+		Help: "Transformed reports delivered to the producer topic, by storm type.",
+	}, []string{"storm_type"})
+	messagesRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "weather_etl_messages_rejected_total",
+		Help: "Raw reports dead lettered, by the stage that rejected them.",
+	}, []string{"reason"})
+	deliveryRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "weather_etl_delivery_retries_total",
+		Help: "Deliveries retried after a transient failure.",
+	})
+	deliveryFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "weather_etl_delivery_failures_total",
+		Help: "Deliveries that failed for good.",
+	})
+	emitLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "weather_etl_emit_to_produced_seconds",
+		Help:    "Time from the collector emitting a report to its transformed message being delivered.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+	}, []string{"storm_type"})
+)
+
+// recordDelivered counts a delivered message, timing it from its report's
+// EmitTs when it is a transformed one.
+func recordDelivered(msg *kafka.Message) {
+	d, ok := msg.Opaque.(*delivery)
+	if !ok || d.StormType == "" {
+		return
+	}
+	messagesProduced.WithLabelValues(d.StormType).Inc()
+	if d.EmitTs > 0 {
+		emitLatency.WithLabelValues(d.StormType).Observe(time.Since(time.UnixMilli(d.EmitTs)).Seconds())
+	}
+}
+
+// NewServeMux serves the metrics and health of the process.
+func NewServeMux(checker HealthChecker) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	checker.register(mux)
+	return mux
+}
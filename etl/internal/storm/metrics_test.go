@@ -0,0 +1,45 @@
+package storm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"weather-contract/telemetry"
+	"weather-contract/telemetry/telemetrytest"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	// The metrics are shared by every test, so only their increase is checked.
+	consumed := testutil.ToFloat64(consumerMetrics.Consumed)
+	produced := testutil.ToFloat64(messagesProduced.WithLabelValues(Hail))
+	rejected := testutil.ToFloat64(messagesRejected.WithLabelValues(StageParse))
+	timed := telemetrytest.SampleCount(t, emitLatency.WithLabelValues(Hail))
+
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	process, err := NewProcess(consumer, producer, testConfig(), zap.NewNop())
+	assert.Nil(t, err)
+	stop := runProcess(t, process)
+	consumer.Add(nil, []byte(`{"Time": "2010", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Size": "175", "Lat": "35.22", "Lon": "-97.44"}`))
+	consumer.Add(nil, []byte(`not json`))
+	assert.Eventually(t, func() bool {
+		return process.Stats.Delivered.Load() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	assert.Equal(t, consumed+2, testutil.ToFloat64(consumerMetrics.Consumed))
+	assert.Equal(t, produced+1, testutil.ToFloat64(messagesProduced.WithLabelValues(Hail)))
+	assert.Equal(t, rejected+1, testutil.ToFloat64(messagesRejected.WithLabelValues(StageParse)))
+	assert.Equal(t, float64(0), testutil.ToFloat64(consumerMetrics.Lag.WithLabelValues(testRawTopic, "0")))
+	assert.Equal(t, timed+1, telemetrytest.SampleCount(t, emitLatency.WithLabelValues(Hail)))
+
+	recorder := httptest.NewRecorder()
+	NewServeMux(NewHealthChecker(process, telemetry.HealthChecks{})).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `weather_etl_messages_produced_total{storm_type="hail"}`)
+}
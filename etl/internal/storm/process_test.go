@@ -0,0 +1,180 @@
+package storm
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"weather-contract/event"
+	"weather-contract/registry"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const (
+	testRawTopic         = "raw-weather-reports"
+	testTransformedTopic = "transformed-weather-data"
+	testDeadLetterTopic  = "raw-weather-reports-dlq"
+)
+
+func testConfig() Kakfa {
+	return Kakfa{
+		ConsumerTopic:       testRawTopic,
+		ProducerTopic:       testTransformedTopic,
+		DeadLetterTopic:     testDeadLetterTopic,
+		ProduceRetryBackoff: time.Millisecond,
+		DrainTimeout:        time.Second,
+		FlushTimeout:        time.Second,
+		ShutdownTimeout:     time.Second,
+		Encoding:            EncodingJson,
+	}
+}
+
+// runProcess starts the process and returns a function that stops it and
+// waits for it to return.
+func runProcess(t *testing.T, process Process) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Start(ctx)
+	}()
+	return func() {
+		cancel()
+		select {
+		case err := <-done:
+			assert.Nil(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Process did not stop")
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	process, err := NewProcess(consumer, producer, testConfig(), zap.NewNop())
+	assert.Nil(t, err)
+	stop := runProcess(t, process)
+
+	consumer.Add(nil, []byte(`{"Time": "2010", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Size": "175", "Location": "NORMAN", "State": "OK", "Lat": "35.22", "Lon": "-97.44"}`))
+	consumer.Add(nil, []byte(`{"Time": "0130", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Speed": "E60", "Location": "MOORE", "State": "OK", "Lat": "35.34", "Lon": "-97.49"}`))
+	consumer.Add(nil, []byte(`not json`))
+	assert.Eventually(t, func() bool {
+		return len(producer.Messages(testTransformedTopic)) == 2 && len(producer.Messages(testDeadLetterTopic)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	transformed := producer.Messages(testTransformedTopic)
+	hail, err := event.Decode(transformed[0].Value)
+	assert.Nil(t, err)
+	assert.Equal(t, event.TypeHail, hail.Type)
+	assert.Equal(t, hail.EventId, string(transformed[0].Key))
+	assert.Equal(t, "2024-05-06", hail.ConvectiveDay)
+	wind, err := event.Decode(transformed[1].Value)
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-05-06", wind.ConvectiveDay)
+	assert.True(t, wind.Wind.SpeedEstimated)
+
+	dl, err := ParseDeadLetter(producer.Messages(testDeadLetterTopic)[0])
+	assert.Nil(t, err)
+	assert.Equal(t, StageParse, dl.Stage)
+	assert.Equal(t, int64(2), dl.SourceOffset)
+
+	assert.Equal(t, kafka.Offset(3), consumer.CommittedOffset())
+	assert.Equal(t, int64(3), process.Stats.Delivered.Load())
+}
+
+func TestProcessDeadLettersUndelivered(t *testing.T) {
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	producer.DeliveryError = func(msg *kafka.Message) error {
+		if *msg.TopicPartition.Topic == testTransformedTopic {
+			return kafka.NewError(kafka.ErrMsgSizeTooLarge, "Message too large", false)
+		}
+		return nil
+	}
+	process, err := NewProcess(consumer, producer, testConfig(), zap.NewNop())
+	assert.Nil(t, err)
+	stop := runProcess(t, process)
+
+	consumer.Add(nil, []byte(`{"Time": "2010", "EventTs": 1714953600000, "Size": "175", "Lat": "35.22", "Lon": "-97.44"}`))
+	assert.Eventually(t, func() bool {
+		return len(producer.Messages(testDeadLetterTopic)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	dl, err := ParseDeadLetter(producer.Messages(testDeadLetterTopic)[0])
+	assert.Nil(t, err)
+	assert.Equal(t, StageDelivery, dl.Stage)
+	assert.Equal(t, int64(1), process.Stats.Failed.Load())
+	assert.Equal(t, kafka.Offset(1), consumer.CommittedOffset())
+}
+
+func TestProcessCommitsOnlyDelivered(t *testing.T) {
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	producer.DeliveryError = func(msg *kafka.Message) error {
+		return kafka.NewError(kafka.ErrAllBrokersDown, "All brokers down", false)
+	}
+	config := testConfig()
+	config.ProduceMaxRetries = 1000
+	config.FlushTimeout = 50 * time.Millisecond
+	process, err := NewProcess(consumer, producer, config, zap.NewNop())
+	assert.Nil(t, err)
+	stop := runProcess(t, process)
+
+	consumer.Add(nil, []byte(`{"Time": "2010", "EventTs": 1714953600000, "Size": "175", "Lat": "35.22", "Lon": "-97.44"}`))
+	assert.Eventually(t, func() bool {
+		return process.Stats.Retried.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	assert.Equal(t, kafka.OffsetInvalid, consumer.CommittedOffset())
+}
+
+func TestNewProcessExactlyOnce(t *testing.T) {
+	config := testConfig()
+	config.ExactlyOnce = true
+	_, err := NewProcess(NewMemoryConsumer(testRawTopic), NewMemoryProducer(), config, zap.NewNop())
+	assert.Equal(t, errors.New("Exactly once mode needs a transactional consumer and producer"), err)
+}
+
+func TestProcessAvro(t *testing.T) {
+	server := httptest.NewServer(registry.NewMock())
+	defer server.Close()
+	config := testConfig()
+	config.Encoding = EncodingAvro
+	config.SchemaRegistryUrl = server.URL
+	config.SchemaSubject = testTransformedTopic + "-value"
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	process, err := NewProcess(consumer, producer, config, zap.NewNop())
+	assert.Nil(t, err)
+	stop := runProcess(t, process)
+
+	consumer.Add(nil, []byte(`{"Time": "2010", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Size": "175", "Location": "NORMAN", "State": "OK", "Lat": "35.22", "Lon": "-97.44"}`))
+	assert.Eventually(t, func() bool {
+		return len(producer.Messages(testTransformedTopic)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	decoder, err := event.NewAvroDecoder(context.Background(), registry.NewClient(server.URL), config.SchemaSubject)
+	assert.Nil(t, err)
+	hail, err := decoder.Decode(producer.Messages(testTransformedTopic)[0].Value)
+	assert.Nil(t, err)
+	assert.Equal(t, "NORMAN", hail.Hail.Location)
+	assert.Equal(t, 35.22, hail.Hail.Lat)
+
+	// A subject whose latest schema the etl's can't read stops it from
+	// starting.
+	_, err = registry.NewClient(server.URL).Register(context.Background(), "incompatible-value",
+		strings.Replace(event.AvroSchema(), `{"name": "source", "type": "string"},`, "", 1))
+	assert.Nil(t, err)
+	config.SchemaSubject = "incompatible-value"
+	_, err = NewProcess(NewMemoryConsumer(testRawTopic), NewMemoryProducer(), config, zap.NewNop())
+	assert.ErrorContains(t, err, "Unable to register the Avro schema: Schema is incompatible with incompatible-value: ")
+}
@@ -0,0 +1,41 @@
+package storm
+
+import (
+	"errors"
+	"time"
+)
+
+// Sources of raw reports, each with its own report-day convention.
+const (
+	// SourceSpc reports are grouped into convective days that run from
+	// 1200 UTC to 1159 UTC the next day, so a report stamped 0000-1159
+	// happened on the calendar date after its report day.
+	SourceSpc string = "spc"
+	// SourceCalendar reports are grouped by UTC calendar day.
+	SourceCalendar string = "calendar"
+)
+
+const convectiveDayFormat = "2006-01-02"
+
+// reportDayStartHour is the UTC hour at which each source's report day starts.
+var reportDayStartHour = map[string]int{
+	SourceSpc:      12,
+	SourceCalendar: 0,
+}
+
+// reportTime returns the absolute UTC time of an HHMM report time listed
+// under reportDate by source.
+func reportTime(timeStr string, reportDate time.Time, source string) (int64, error) {
+	startHour, ok := reportDayStartHour[source]
+	if !ok {
+		return 0, errors.New("Unknown report source " + source)
+	}
+	eventTime, err := standardizeEventTime(timeStr, reportDate)
+	if err != nil {
+		return 0, err
+	}
+	if time.Unix(eventTime, 0).UTC().Hour() < startHour {
+		eventTime += int64((24 * time.Hour).Seconds())
+	}
+	return eventTime, nil
+}
@@ -0,0 +1,3 @@
+package storm
+
+const tracerName = "weather-etl/internal/storm"
@@ -0,0 +1,65 @@
+package storm
+
+import (
+	"context"
+	"testing"
+	"time"
+	"weather-contract/telemetry"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestProcessTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	consumer := NewMemoryConsumer(testRawTopic)
+	producer := NewMemoryProducer()
+	process, err := NewProcess(consumer, producer, testConfig(), zap.NewNop())
+	assert.Nil(t, err)
+	process.Tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+	stop := runProcess(t, process)
+
+	// The first report continues the trace of the collector, the second
+	// starts one and the third is rejected.
+	consumer.Add(nil, []byte(`{"Time": "2010", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Size": "175", "Location": "NORMAN", "State": "OK", "Lat": "35.22", "Lon": "-97.44"}`),
+		kafka.Header{Key: "traceparent", Value: []byte(testTraceParent)})
+	consumer.Add(nil, []byte(`{"Time": "0130", "EmitTs": 1715025600000, "EventTs": 1714953600000, "Speed": "E60", "Location": "MOORE", "State": "OK", "Lat": "35.34", "Lon": "-97.49"}`))
+	consumer.Add(nil, []byte(`not json`))
+	assert.Eventually(t, func() bool {
+		return len(producer.Messages(testTransformedTopic)) == 2 && len(producer.Messages(testDeadLetterTopic)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	stop()
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 5)
+	var transforms, publishes []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.SpanKind() {
+		case trace.SpanKindConsumer:
+			transforms = append(transforms, span)
+		case trace.SpanKindProducer:
+			publishes = append(publishes, span)
+		}
+	}
+	assert.Len(t, transforms, 3)
+	assert.Len(t, publishes, 2)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", transforms[0].SpanContext().TraceID().String())
+	assert.True(t, transforms[0].Parent().IsRemote())
+	assert.False(t, transforms[1].Parent().IsValid())
+	assert.Equal(t, codes.Error, transforms[2].Status().Code)
+
+	// Each transformed message carries the context of its publish span.
+	for i, msg := range producer.Messages(testTransformedTopic) {
+		ctx := telemetry.Propagator.Extract(context.Background(), telemetry.HeaderCarrier{Headers: &msg.Headers})
+		assert.Equal(t, publishes[i].SpanContext().SpanID(), trace.SpanContextFromContext(ctx).SpanID())
+		assert.Equal(t, transforms[i].SpanContext().TraceID(), publishes[i].SpanContext().TraceID())
+	}
+}
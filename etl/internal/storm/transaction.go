@@ -0,0 +1,168 @@
+package storm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+)
+
+const transactionTimeout = 30 * time.Second
+
+// txnConsumer and txnProducer are the clients of the exactly once loop,
+// which NewProcess checked to be transactional.
+func (p Process) txnConsumer() TransactionalConsumer {
+	return p.Consumer.(TransactionalConsumer)
+}
+
+func (p Process) txnProducer() TransactionalProducer {
+	return p.Producer.(TransactionalProducer)
+}
+
+// startTransactional consumes raw reports in batches and produces their
+// transformed (or dead-lettered) messages in a Kafka transaction together with
+// the consumed offsets, so each report is reflected downstream exactly once.
+func (p Process) startTransactional(ctx context.Context) error {
+	defer p.Consumer.Close()
+	defer p.Producer.Close()
+
+	p.Logger.Info("Service is running in exactly once mode... Listening for messages...")
+	for {
+		select {
+		case <-ctx.Done():
+			p.Logger.Info("Received shutdown signal. Stopping service.")
+			p.flush()
+			return nil
+		default:
+			batch := p.readBatch(ctx)
+			if len(batch) == 0 {
+				continue
+			}
+			if err := p.txnProducer().BeginTransaction(); err != nil {
+				return errors.New("Unable to begin transaction: " + err.Error())
+			}
+			if err := p.processTransaction(batch); err != nil {
+				var kafkaErr kafka.Error
+				if errors.As(err, &kafkaErr) && kafkaErr.IsFatal() {
+					return errors.New("Fatal transaction error: " + err.Error())
+				}
+				p.Logger.Warn("Aborting transaction.", zap.Int("messages", len(batch)), zap.Error(err))
+				if err := p.abortTransaction(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// readBatch reads up to TransactionBatchSize messages, returning early once
+// the topic is drained.
+func (p Process) readBatch(ctx context.Context) []*kafka.Message {
+	var batch []*kafka.Message
+	for len(batch) < p.TransactionBatchSize && ctx.Err() == nil {
+		p.Health.Polled()
+		msg, err := p.Consumer.ReadMessage(100 * time.Millisecond)
+		if err != nil {
+			if kafkaErr, ok := err.(kafka.Error); ok && kafkaErr.Code() == kafka.ErrTimedOut {
+				break
+			}
+			p.Logger.Error("Error consuming message.", zap.Error(err))
+			continue
+		}
+		p.Health.Read(msg, consumerMetrics.Record(p.Consumer, msg))
+		batch = append(batch, msg)
+	}
+	return batch
+}
+
+// processTransaction produces the batch and its offsets in the open
+// transaction and commits it. It is not cancelled by shutdown so that a batch
+// already read is committed before the process stops.
+func (p Process) processTransaction(batch []*kafka.Message) error {
+	for _, msg := range batch {
+		if err := p.handleMessage(msg); err != nil {
+			p.rejected(msg, err)
+			if err := deadLetter(p.Producer, msg, p.DeadLetterTopic, err); err != nil {
+				return err
+			}
+		}
+	}
+
+	metadata, err := p.txnConsumer().GetConsumerGroupMetadata()
+	if err != nil {
+		return err
+	}
+	txnCtx, cancel := context.WithTimeout(context.Background(), transactionTimeout)
+	defer cancel()
+	if err := p.txnProducer().SendOffsetsToTransaction(txnCtx, nextOffsets(batch), metadata); err != nil {
+		return err
+	}
+	for {
+		err := p.txnProducer().CommitTransaction(txnCtx)
+		if err == nil {
+			return nil
+		}
+		var kafkaErr kafka.Error
+		if !errors.As(err, &kafkaErr) || !kafkaErr.IsRetriable() || txnCtx.Err() != nil {
+			return err
+		}
+		p.Logger.Warn("Retrying transaction commit.", zap.Error(err))
+	}
+}
+
+// abortTransaction aborts the open transaction and rewinds the consumer to
+// the last committed offsets so the aborted batch is consumed again.
+func (p Process) abortTransaction() error {
+	ctx, cancel := context.WithTimeout(context.Background(), transactionTimeout)
+	defer cancel()
+	if err := p.txnProducer().AbortTransaction(ctx); err != nil {
+		return errors.New("Unable to abort transaction: " + err.Error())
+	}
+
+	assignment, err := p.txnConsumer().Assignment()
+	if err != nil {
+		return errors.New("Unable to read consumer assignment: " + err.Error())
+	}
+	committed, err := p.txnConsumer().Committed(assignment, int(transactionTimeout.Milliseconds()))
+	if err != nil {
+		return errors.New("Unable to read committed offsets: " + err.Error())
+	}
+	for _, tp := range committed {
+		if tp.Offset < 0 {
+			tp.Offset = kafka.OffsetBeginning
+		}
+		if err := p.txnConsumer().Seek(tp, -1); err != nil {
+			return errors.New("Unable to rewind consumer: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// nextOffsets returns, per partition, the offset after the last message in batch.
+func nextOffsets(batch []*kafka.Message) []kafka.TopicPartition {
+	positions := make(map[string]map[int32]kafka.Offset)
+	for _, msg := range batch {
+		topic := *msg.TopicPartition.Topic
+		if positions[topic] == nil {
+			positions[topic] = make(map[int32]kafka.Offset)
+		}
+		next := msg.TopicPartition.Offset + 1
+		if next > positions[topic][msg.TopicPartition.Partition] {
+			positions[topic][msg.TopicPartition.Partition] = next
+		}
+	}
+	var offsets []kafka.TopicPartition
+	for topic, partitions := range positions {
+		for partition, offset := range partitions {
+			topic := topic
+			offsets = append(offsets, kafka.TopicPartition{
+				Topic:     &topic,
+				Partition: partition,
+				Offset:    offset,
+			})
+		}
+	}
+	return offsets
+}
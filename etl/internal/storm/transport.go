@@ -0,0 +1,48 @@
+package storm
+
+import (
+	"context"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Consumer reads raw reports. *kafka.Consumer implements it, as does
+// MemoryConsumer for tests.
+type Consumer interface {
+	ReadMessage(timeout time.Duration) (*kafka.Message, error)
+	// StoreOffsets sets the offsets the next Commit commits.
+	StoreOffsets(offsets []kafka.TopicPartition) ([]kafka.TopicPartition, error)
+	Commit() ([]kafka.TopicPartition, error)
+	Close() error
+}
+
+// Producer publishes transformed reports and dead letters. Delivery reports
+// are read from Events.
+type Producer interface {
+	Produce(msg *kafka.Message, deliveryChan chan kafka.Event) error
+	Events() chan kafka.Event
+	// Flush waits up to timeoutMs for outstanding messages and returns how
+	// many are left.
+	Flush(timeoutMs int) int
+	Close()
+}
+
+// TransactionalConsumer is what the exactly once loop needs on top of
+// Consumer to send offsets with a transaction and rewind after an abort.
+type TransactionalConsumer interface {
+	Consumer
+	GetConsumerGroupMetadata() (*kafka.ConsumerGroupMetadata, error)
+	Assignment() ([]kafka.TopicPartition, error)
+	Committed(partitions []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+	Seek(partition kafka.TopicPartition, ignoredTimeoutMs int) error
+}
+
+// TransactionalProducer is a Producer with Kafka transactions.
+type TransactionalProducer interface {
+	Producer
+	BeginTransaction() error
+	SendOffsetsToTransaction(ctx context.Context, offsets []kafka.TopicPartition, consumerMetadata *kafka.ConsumerGroupMetadata) error
+	CommitTransaction(ctx context.Context) error
+	AbortTransaction(ctx context.Context) error
+}